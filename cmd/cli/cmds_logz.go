@@ -1,9 +1,11 @@
 package cli
 
 import (
+	"context"
 	"fmt"
 	"github.com/faelmori/logz/internal/logger"
 	"github.com/spf13/cobra"
+	"net/url"
 	"os"
 	"os/signal"
 	"path/filepath"
@@ -183,7 +185,10 @@ func archiveLogsCmd() *cobra.Command {
 
 // watchLogsCmd monitors logs in real-time.
 func watchLogsCmd() *cobra.Command {
-	return &cobra.Command{
+	var remote, level, traceID, match, token, apiKey, format string
+	var sources, tags, meta []string
+
+	cmd := &cobra.Command{
 		Use:     "watch",
 		Aliases: []string{"w"},
 		Annotations: GetDescriptions(
@@ -191,6 +196,20 @@ func watchLogsCmd() *cobra.Command {
 			false,
 		),
 		Run: func(cmd *cobra.Command, args []string) {
+			if remote != "" {
+				query := url.Values{"source": sources, "tag": tags, "meta": meta}
+				query.Set("level", level)
+				query.Set("trace_id", traceID)
+				query.Set("match", match)
+				filter, err := logger.ParseStreamFilter(query)
+				if err != nil {
+					fmt.Printf("Error parsing filter: %v\n", err)
+					return
+				}
+				watchRemoteLogs(logger.StreamClientConfig{URL: remote, Token: token, APIKey: apiKey, Filter: filter}, format)
+				return
+			}
+
 			configManager := logger.NewConfigManager()
 			if configManager == nil {
 				fmt.Println("Error initializing ConfigManager.")
@@ -225,4 +244,41 @@ func watchLogsCmd() *cobra.Command {
 			time.Sleep(500 * time.Millisecond)
 		},
 	}
+
+	cmd.Flags().StringVarP(&remote, "remote", "r", "", "Address of a logz service to stream entries from")
+	cmd.Flags().StringVarP(&level, "level", "l", "", "Minimum level of the streamed entries")
+	cmd.Flags().StringSliceVarP(&sources, "source", "s", nil, "Sources of the streamed entries")
+	cmd.Flags().StringSliceVarP(&tags, "tag", "t", nil, "Tag of the streamed entries, as key:value")
+	cmd.Flags().StringSliceVarP(&meta, "meta", "m", nil, "Metadata of the streamed entries, as key:value")
+	cmd.Flags().StringVar(&traceID, "trace-id", "", "Trace ID of the streamed entries")
+	cmd.Flags().StringVar(&match, "match", "", "Match expression of the streamed entries, e.g. 'message=~timeout'")
+	cmd.Flags().StringVar(&token, "token", os.Getenv("LOGZ_TOKEN"), "Bearer token for the service (default $LOGZ_TOKEN)")
+	cmd.Flags().StringVar(&apiKey, "api-key", os.Getenv("LOGZ_API_KEY"), "API key for the service (default $LOGZ_API_KEY)")
+	cmd.Flags().StringVarP(&format, "format", "f", "text", "Output format of the streamed entries (text or json)")
+
+	return cmd
+}
+
+// watchRemoteLogs prints the entries streamed by a logz service until interrupted.
+func watchRemoteLogs(cfg logger.StreamClientConfig, format string) {
+	var formatter logger.LogFormatter = &logger.TextFormatter{}
+	if format == "json" {
+		formatter = &logger.JSONFormatter{}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	fmt.Printf("Streaming from %s (Ctrl+C to exit):\n", cfg.URL)
+	err := logger.WatchStream(ctx, cfg, func(entry *logger.LogEntry) {
+		line, err := formatter.Format(entry)
+		if err != nil {
+			fmt.Printf("Error formatting entry: %v\n", err)
+			return
+		}
+		fmt.Println(line)
+	})
+	if err != nil {
+		fmt.Printf("Error streaming logs: %v\n", err)
+	}
 }
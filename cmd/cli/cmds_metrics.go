@@ -1,10 +1,16 @@
 package cli
 
 import (
+	"bufio"
+	"encoding/json"
 	"fmt"
 	"github.com/faelmori/logz/internal/logger"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"os"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -24,11 +30,13 @@ func MetricsCmd() *cobra.Command {
 	cmd.AddCommand(removeMetricCmd())
 	cmd.AddCommand(listMetricsCmd())
 	cmd.AddCommand(watchMetricsCmd())
+	cmd.AddCommand(rulesMetricsCmd())
+	cmd.AddCommand(discoveryMetricsCmd())
 
 	return cmd
 }
 
-// enableMetricsCmd creates the command to enable Prometheus integration.
+// enableMetricsCmd creates the command to enable Prometheus integration in the running service.
 func enableMetricsCmd() *cobra.Command {
 	var port string
 	enMCmd := &cobra.Command{
@@ -36,33 +44,45 @@ func enableMetricsCmd() *cobra.Command {
 		Aliases: []string{"en"},
 		Short:   "Enable Prometheus integration",
 		Run: func(cmd *cobra.Command, args []string) {
-			pm := logger.GetPrometheusManager()
-			pm.Enable(port)
+			address, err := logger.NewAdminClient().EnableMetrics(port)
+			if err != nil {
+				fmt.Printf("Error enabling metrics: %v\n", err)
+				return
+			}
+			fmt.Printf("Prometheus metrics enabled on %s.\n", address)
 		},
 	}
 	enMCmd.Flags().StringVarP(&port, "port", "p", "2112", "Port to expose Prometheus metrics")
 	return enMCmd
 }
 
-// disableMetricsCmd creates the command to disable Prometheus integration.
+// disableMetricsCmd creates the command to disable Prometheus integration in the running service.
 func disableMetricsCmd() *cobra.Command {
 	return &cobra.Command{
 		Use:     "disable",
 		Aliases: []string{"dis"},
 		Short:   "Disable Prometheus integration",
 		Run: func(cmd *cobra.Command, args []string) {
-			pm := logger.GetPrometheusManager()
-			pm.Disable()
+			if err := logger.NewAdminClient().DisableMetrics(); err != nil {
+				fmt.Printf("Error disabling metrics: %v\n", err)
+				return
+			}
+			fmt.Println("Prometheus metrics disabled.")
 		},
 	}
 }
 
 // addMetricCmd creates the command to add or update a Prometheus metric.
 func addMetricCmd() *cobra.Command {
-	return &cobra.Command{
+	var metricType, help string
+	var labels map[string]string
+	var buckets, quantiles []float64
+
+	addCmd := &cobra.Command{
 		Use:     "add [name] [value]",
 		Aliases: []string{"a"},
 		Short:   "Add or update a Prometheus metric",
+		Long:    "Sets a gauge, increments a counter or observes a value in a histogram or summary, depending on --type",
 		Args:    cobra.ExactArgs(2),
 		Run: func(cmd *cobra.Command, args []string) {
 			name := args[0]
@@ -71,10 +91,33 @@ func addMetricCmd() *cobra.Command {
 				fmt.Printf("Invalid metric value: %v\n", valueErr)
 				return
 			}
-			pm := logger.GetPrometheusManager()
-			pm.AddMetric(name, value, nil)
+			typ, typeErr := logger.ParseMetricType(metricType)
+			if typeErr != nil {
+				fmt.Printf("Invalid metric type: %v\n", typeErr)
+				return
+			}
+
+			if err := logger.NewAdminClient().UpdateMetric(logger.MetricUpdate{
+				Name:      name,
+				Value:     value,
+				Type:      typ,
+				Help:      help,
+				Labels:    labels,
+				Buckets:   buckets,
+				Quantiles: quantiles,
+			}); err != nil {
+				fmt.Printf("Error updating metric: %v\n", err)
+				return
+			}
+			fmt.Printf("Metric '%s' (%s) updated with value: %s\n", name, typ, args[1])
 		},
 	}
+	addCmd.Flags().StringVarP(&metricType, "type", "t", "gauge", "Metric type: counter, gauge, histogram or summary")
+	addCmd.Flags().StringVarP(&help, "help-text", "H", "", "Help text exposed with the metric")
+	addCmd.Flags().StringToStringVarP(&labels, "label", "l", nil, "Labels of the series (key=value)")
+	addCmd.Flags().Float64SliceVar(&buckets, "buckets", nil, "Histogram bucket upper bounds")
+	addCmd.Flags().Float64SliceVar(&quantiles, "quantiles", nil, "Summary quantiles")
+	return addCmd
 }
 
 // removeMetricCmd creates the command to remove a Prometheus metric.
@@ -86,29 +129,49 @@ func removeMetricCmd() *cobra.Command {
 		Args:    cobra.ExactArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
 			name := args[0]
-			pm := logger.GetPrometheusManager()
-			pm.RemoveMetric(name)
+			if err := logger.NewAdminClient().RemoveMetric(name); err != nil {
+				fmt.Printf("Error removing metric: %v\n", err)
+				return
+			}
+			fmt.Printf("Metric '%s' removed.\n", name)
 		},
 	}
 }
 
-// listMetricsCmd creates the command to list all Prometheus metrics.
+// printMetrics prints the metrics sorted by name.
+func printMetrics(metrics map[string]float64) {
+	if len(metrics) == 0 {
+		fmt.Println("No metrics registered.")
+		return
+	}
+	names := make([]string, 0, len(metrics))
+	for name := range metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf(" - %s: %s\n", name, strconv.FormatFloat(metrics[name], 'g', -1, 64))
+	}
+}
+
+// listMetricsCmd creates the command to list all Prometheus metrics of the running service.
 func listMetricsCmd() *cobra.Command {
 	return &cobra.Command{
 		Use:     "list",
 		Aliases: []string{"l"},
 		Short:   "List all Prometheus metrics",
 		Run: func(cmd *cobra.Command, args []string) {
-			pm := logger.GetPrometheusManager()
-			metrics := pm.GetMetrics()
-			if len(metrics) == 0 {
-				fmt.Println("No metrics registered.")
+			status, err := logger.NewAdminClient().MetricsStatus()
+			if err != nil {
+				fmt.Printf("Error listing metrics: %v\n", err)
 				return
 			}
-			fmt.Println("Registered metrics:")
-			for name, value := range metrics {
-				fmt.Printf(" - %s: %f\n", name, value)
+			if status.Enabled {
+				fmt.Printf("Exporter: enabled on %s\n", status.Address)
+			} else {
+				fmt.Println("Exporter: disabled")
 			}
+			printMetrics(status.Metrics)
 		},
 	}
 }
@@ -121,23 +184,222 @@ func watchMetricsCmd() *cobra.Command {
 		Short:   "Watch Prometheus metrics in real time",
 		Run: func(cmd *cobra.Command, args []string) {
 			fmt.Println("Watching metrics (press Ctrl+C to exit):")
+			client := logger.NewAdminClient()
 			ticker := time.NewTicker(2 * time.Second)
 			defer ticker.Stop()
 			for {
 				select {
 				case <-ticker.C:
-					metrics := logger.GetPrometheusManager().GetMetrics()
-					fmt.Println("Current Metrics:")
-					if len(metrics) == 0 {
-						fmt.Println("  No metrics registered.")
-					} else {
-						for name, value := range metrics {
-							fmt.Printf(" - %s: %f\n", name, value)
-						}
+					status, err := client.MetricsStatus()
+					if err != nil {
+						fmt.Printf("Error loading metrics: %v\n", err)
+						continue
 					}
+					fmt.Println("Current Metrics:")
+					printMetrics(status.Metrics)
 					fmt.Println("-----")
 				}
 			}
 		},
 	}
 }
+
+// rulesMetricsCmd creates the command group for log-derived metric rules.
+func rulesMetricsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rules",
+		Short: "Inspect and test the metric rules derived from log entries",
+	}
+	cmd.AddCommand(listMetricRulesCmd())
+	cmd.AddCommand(testMetricRulesCmd())
+	return cmd
+}
+
+// loadRulesFromFlag compiles the rules of the given file, or of the active configuration when empty.
+func loadRulesFromFlag(rulesFile string) ([]*logger.MetricRule, error) {
+	if rulesFile == "" {
+		configManager := logger.NewConfigManager()
+		if configManager == nil {
+			return nil, fmt.Errorf("could not load the configuration")
+		}
+		return (*configManager).GetConfig().MetricRules(), nil
+	}
+	vpr := viper.New()
+	vpr.SetConfigFile(rulesFile)
+	if err := vpr.ReadInConfig(); err != nil {
+		return nil, err
+	}
+	return logger.LoadMetricRules(vpr)
+}
+
+// listMetricRulesCmd creates the command to list the configured metric rules.
+func listMetricRulesCmd() *cobra.Command {
+	var rulesFile string
+	listCmd := &cobra.Command{
+		Use:     "list",
+		Aliases: []string{"l"},
+		Short:   "List the configured metric rules",
+		Run: func(cmd *cobra.Command, args []string) {
+			rules, err := loadRulesFromFlag(rulesFile)
+			if err != nil {
+				fmt.Printf("Invalid metric rules: %v\n", err)
+			}
+			if len(rules) == 0 {
+				fmt.Println("No metric rules configured.")
+				return
+			}
+			for _, rule := range rules {
+				typ := rule.Config.Type
+				if typ == "" {
+					typ = string(logger.CounterMetric)
+				}
+				match := rule.Config.Match
+				if match == "" {
+					match = "*"
+				}
+				fmt.Printf(" - %s (%s): %s\n", rule.Config.Name, typ, match)
+			}
+		},
+	}
+	listCmd.Flags().StringVarP(&rulesFile, "rules", "r", "", "File with a metricRules list to use instead of the configuration")
+	return listCmd
+}
+
+// testMetricRulesCmd creates the command to run the metric rules against a log file.
+func testMetricRulesCmd() *cobra.Command {
+	var rulesFile string
+	testCmd := &cobra.Command{
+		Use:   "test [log file]",
+		Short: "Run the metric rules against a JSON log file and print the resulting metrics",
+		Long:  "Evaluates the rules against every JSON entry of the file without touching the persisted metrics",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			rules, err := loadRulesFromFlag(rulesFile)
+			if err != nil {
+				fmt.Printf("Invalid metric rules: %v\n", err)
+			}
+			if len(rules) == 0 {
+				fmt.Println("No metric rules to test.")
+				return
+			}
+
+			file, err := os.Open(args[0])
+			if err != nil {
+				fmt.Printf("Error opening log file: %v\n", err)
+				return
+			}
+			defer file.Close()
+
+			pm := logger.NewPrometheusManager()
+			matches := make(map[string]int, len(rules))
+			var total, skipped int
+			scanner := bufio.NewScanner(file)
+			scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+			for scanner.Scan() {
+				var entry logger.LogEntry
+				if json.Unmarshal(scanner.Bytes(), &entry) != nil {
+					skipped++
+					continue
+				}
+				total++
+				for _, rule := range rules {
+					matched, ruleErr := rule.Apply(pm, &entry)
+					if ruleErr != nil {
+						fmt.Printf("Line %d: %v\n", total+skipped, ruleErr)
+					}
+					if matched {
+						matches[rule.Config.Name]++
+					}
+				}
+			}
+			if err := scanner.Err(); err != nil {
+				fmt.Printf("Error reading log file: %v\n", err)
+				return
+			}
+
+			fmt.Printf("Evaluated %d entries (%d non-JSON lines skipped)\n", total, skipped)
+			for _, rule := range rules {
+				fmt.Printf(" - %s: %d matches\n", rule.Config.Name, matches[rule.Config.Name])
+			}
+			fmt.Println("-----")
+			if err := pm.WriteExposition(os.Stdout); err != nil {
+				fmt.Printf("Error writing metrics: %v\n", err)
+			}
+		},
+	}
+	testCmd.Flags().StringVarP(&rulesFile, "rules", "r", "", "File with a metricRules list to use instead of the configuration")
+	return testCmd
+}
+
+// discoveryMetricsCmd creates the command group for the Prometheus file_sd target file.
+func discoveryMetricsCmd() *cobra.Command {
+	var targetFile string
+	cmd := &cobra.Command{
+		Use:   "discovery",
+		Short: "List the logz instances in the Prometheus file_sd target file",
+		Long:  "The service lists its metrics exporter in the target file configured in \"metricsDiscovery\" while it runs",
+		Run: func(cmd *cobra.Command, args []string) {
+			file := discoveryFileFromFlag(targetFile)
+			groups, err := logger.ReadTargets(file)
+			if err != nil {
+				fmt.Printf("Error reading target file: %v\n", err)
+				return
+			}
+			fmt.Printf("Target file: %s\n", file)
+			if len(groups) == 0 {
+				fmt.Println("No targets registered.")
+				return
+			}
+			for _, group := range groups {
+				labels := make([]string, 0, len(group.Labels))
+				for k, v := range group.Labels {
+					labels = append(labels, k+"="+v)
+				}
+				sort.Strings(labels)
+				fmt.Printf(" - %s (%s) %s\n", strings.Join(group.Targets, ", "), logger.StatusOf(group), strings.Join(labels, ","))
+			}
+		},
+	}
+	cmd.PersistentFlags().StringVarP(&targetFile, "file", "f", "", "Target file to use instead of the configured one")
+	cmd.AddCommand(pruneDiscoveryCmd(&targetFile))
+	cmd.AddCommand(scrapeConfigDiscoveryCmd(&targetFile))
+	return cmd
+}
+
+// discoveryFileFromFlag returns the target file given on the command line, or the configured one.
+func discoveryFileFromFlag(targetFile string) string {
+	if targetFile != "" {
+		return targetFile
+	}
+	if configManager := logger.NewConfigManager(); configManager != nil {
+		return logger.DiscoveryFile((*configManager).GetConfig().MetricsDiscovery())
+	}
+	return logger.DiscoveryFile(nil)
+}
+
+// pruneDiscoveryCmd creates the command to remove the targets of instances that are no longer running.
+func pruneDiscoveryCmd(targetFile *string) *cobra.Command {
+	return &cobra.Command{
+		Use:   "prune",
+		Short: "Remove the targets of local instances that are no longer running",
+		Run: func(cmd *cobra.Command, args []string) {
+			removed, err := logger.PruneTargets(discoveryFileFromFlag(*targetFile))
+			if err != nil {
+				fmt.Printf("Error pruning target file: %v\n", err)
+				return
+			}
+			fmt.Printf("%d stale target(s) removed.\n", removed)
+		},
+	}
+}
+
+// scrapeConfigDiscoveryCmd creates the command to print the Prometheus scrape config reading the target file.
+func scrapeConfigDiscoveryCmd(targetFile *string) *cobra.Command {
+	return &cobra.Command{
+		Use:   "scrape-config",
+		Short: "Print the Prometheus scrape config for the target file",
+		Run: func(cmd *cobra.Command, args []string) {
+			fmt.Printf("scrape_configs:\n  - job_name: 'logz'\n    file_sd_configs:\n      - files: ['%s']\n", discoveryFileFromFlag(*targetFile))
+		},
+	}
+}
@@ -0,0 +1,128 @@
+package cli
+
+import (
+	"fmt"
+	"github.com/faelmori/logz/internal/logger"
+	"github.com/spf13/cobra"
+	"os"
+	"time"
+)
+
+// NotifiersCmd creates the main command for managing notifiers.
+func NotifiersCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "notifiers",
+		Aliases: []string{"ntf"},
+		Annotations: GetDescriptions(
+			[]string{"Manage notifiers and notification silences"},
+			false,
+		),
+	}
+	cmd.AddCommand(silenceCmd())
+	return cmd
+}
+
+// silenceCmd creates the command for managing notification silences.
+func silenceCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "silence",
+		Short: "Manage time-bounded notification silences",
+	}
+	cmd.AddCommand(addSilenceCmd())
+	cmd.AddCommand(listSilencesCmd())
+	cmd.AddCommand(expireSilenceCmd())
+	return cmd
+}
+
+// addSilenceCmd creates the command to add a silence.
+func addSilenceCmd() *cobra.Command {
+	var notifier, level, source, message, comment string
+	var duration time.Duration
+
+	cmd := &cobra.Command{
+		Use:     "add",
+		Aliases: []string{"a"},
+		Short:   "Silence notifications matching the given filters",
+		Run: func(cmd *cobra.Command, args []string) {
+			createdBy := os.Getenv("USER")
+			now := time.Now()
+			silence, err := logger.GetSilenceStore().Add(logger.Silence{
+				Notifier:  notifier,
+				Level:     logger.LogLevel(level),
+				Source:    source,
+				Message:   message,
+				Comment:   comment,
+				CreatedBy: createdBy,
+				StartsAt:  now,
+				EndsAt:    now.Add(duration),
+			})
+			if err != nil {
+				fmt.Printf("Error adding silence: %v\n", err)
+				return
+			}
+			fmt.Printf("Silence '%s' added until %s\n", silence.ID, silence.EndsAt.Format(time.RFC3339))
+		},
+	}
+
+	cmd.Flags().StringVarP(&notifier, "notifier", "n", "", "Notifier to silence (default all)")
+	cmd.Flags().StringVarP(&level, "level", "l", "", "Log level to silence")
+	cmd.Flags().StringVarP(&source, "source", "s", "", "Source to silence")
+	cmd.Flags().StringVarP(&message, "message", "m", "", "Regular expression matched against the message")
+	cmd.Flags().StringVarP(&comment, "comment", "c", "", "Reason for the silence")
+	cmd.Flags().DurationVarP(&duration, "duration", "d", time.Hour, "How long the silence lasts")
+
+	return cmd
+}
+
+// listSilencesCmd creates the command to list active and pending silences.
+func listSilencesCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:     "list",
+		Aliases: []string{"l"},
+		Short:   "List silences that have not expired",
+		Run: func(cmd *cobra.Command, args []string) {
+			silences := logger.GetSilenceStore().List()
+			if len(silences) == 0 {
+				fmt.Println("No silences registered.")
+				return
+			}
+			fmt.Println("Silences:")
+			for _, s := range silences {
+				fmt.Printf(" - %s: until %s", s.ID, s.EndsAt.Format(time.RFC3339))
+				if s.Notifier != "" {
+					fmt.Printf(" notifier=%s", s.Notifier)
+				}
+				if s.Level != "" {
+					fmt.Printf(" level=%s", s.Level)
+				}
+				if s.Source != "" {
+					fmt.Printf(" source=%s", s.Source)
+				}
+				if s.Message != "" {
+					fmt.Printf(" message=%q", s.Message)
+				}
+				if s.Comment != "" {
+					fmt.Printf(" (%s)", s.Comment)
+				}
+				fmt.Println()
+			}
+		},
+	}
+}
+
+// expireSilenceCmd creates the command to expire a silence immediately.
+func expireSilenceCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:     "expire [id]",
+		Aliases: []string{"e"},
+		Short:   "Expire a silence immediately",
+		Args:    cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := logger.GetSilenceStore().Expire(args[0]); err != nil {
+				fmt.Printf("Error expiring silence: %v\n", err)
+				return
+			}
+			fmt.Printf("Silence '%s' expired.\n", args[0])
+		},
+	}
+}
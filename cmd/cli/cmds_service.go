@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"github.com/faelmori/logz/internal/logger"
 	"github.com/spf13/cobra"
+	"sort"
+	"time"
 )
 
 // ServiceCmd creates the main command for managing the web service.
@@ -17,6 +19,7 @@ func ServiceCmd() *cobra.Command {
 	}
 	cmd.AddCommand(startServiceCmd())
 	cmd.AddCommand(stopServiceCmd())
+	cmd.AddCommand(reloadServiceCmd())
 	cmd.AddCommand(getServiceCmd())
 	cmd.AddCommand(spawnServiceCmd())
 	return cmd
@@ -24,7 +27,8 @@ func ServiceCmd() *cobra.Command {
 
 // startServiceCmd creates the command to start the web service.
 func startServiceCmd() *cobra.Command {
-	return &cobra.Command{
+	var timeout time.Duration
+	stCmd := &cobra.Command{
 		Use:   "start",
 		Short: "Start the web service",
 		Run: func(cmd *cobra.Command, args []string) {
@@ -35,31 +39,56 @@ func startServiceCmd() *cobra.Command {
 			}
 			cfgMgr := *configManager
 
-			config, err := cfgMgr.LoadConfig()
-			if err != nil {
+			if _, err := cfgMgr.LoadConfig(); err != nil {
 				fmt.Printf("Error loading configuration: %v\n", err)
 				return
 			}
 
-			if err := logger.Start(config.Port()); err != nil {
+			pid, err := logger.Start(timeout)
+			if err != nil {
 				fmt.Printf("Error starting service: %v\n", err)
 			} else {
-				fmt.Println("Service started successfully.")
+				fmt.Printf("Service started successfully with PID %d.\n", pid)
 			}
 		},
 	}
+	stCmd.Flags().DurationVarP(&timeout, "timeout", "t", 10*time.Second, "Time to wait for the service to be ready")
+	return stCmd
 }
 
 // stopServiceCmd creates the command to stop the web service.
 func stopServiceCmd() *cobra.Command {
-	return &cobra.Command{
+	var timeout time.Duration
+	spCmd := &cobra.Command{
 		Use:   "stop",
 		Short: "Stop the web service",
 		Run: func(cmd *cobra.Command, args []string) {
-			if err := logger.Stop(); err != nil {
+			pid, killed, err := logger.Stop(timeout)
+			switch {
+			case err != nil:
 				fmt.Printf("Error stopping service: %v\n", err)
+			case killed:
+				fmt.Printf("Service with PID %d did not stop within %s and was killed.\n", pid, timeout)
+			default:
+				fmt.Printf("Service with PID %d stopped successfully.\n", pid)
+			}
+		},
+	}
+	spCmd.Flags().DurationVarP(&timeout, "timeout", "t", 10*time.Second, "Time to wait for a graceful shutdown before killing the service")
+	return spCmd
+}
+
+// reloadServiceCmd creates the command to reload the configuration of the web service.
+func reloadServiceCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "reload",
+		Short: "Reload the configuration and reopen the log files of the running service",
+		Run: func(cmd *cobra.Command, args []string) {
+			pid, err := logger.Reload()
+			if err != nil {
+				fmt.Printf("Error reloading service: %v\n", err)
 			} else {
-				fmt.Println("Service stopped successfully.")
+				fmt.Printf("Reload requested from service with PID %d.\n", pid)
 			}
 		},
 	}
@@ -71,17 +100,84 @@ func getServiceCmd() *cobra.Command {
 		Use:   "status",
 		Short: "Get information about the running service",
 		Run: func(cmd *cobra.Command, args []string) {
-			pid, port, pidPath, err := logger.GetServiceInfo()
+			state, err := logger.InspectService()
 			if err != nil {
 				fmt.Println("Service is not running")
-			} else {
-				fmt.Printf("Service running with PID %d on port %s\n", pid, port)
-				fmt.Printf("PID file: %s\n", pidPath)
+				return
+			}
+			if !state.Alive {
+				fmt.Printf("Service is not running (stale PID file of PID %d: %s)\n", state.PID, state.PidFile)
+				return
+			}
+			fmt.Printf("Service running with PID %d on %s\n", state.PID, state.Address)
+			fmt.Printf("PID file: %s\n", state.PidFile)
+			if !state.Healthy {
+				fmt.Println("Health: not responding on the admin socket")
+				return
+			}
+			fmt.Printf("Health: OK (uptime %s)\n", state.Uptime)
+
+			status, err := logger.NewAdminClient().Status()
+			if err != nil {
+				fmt.Printf("Error getting service status: %v\n", err)
+				return
 			}
+			printServiceStatus(status)
 		},
 	}
 }
 
+// printServiceStatus prints the runtime status reported by the admin API.
+func printServiceStatus(status *logger.ServiceStatus) {
+	fmt.Printf("Output: %s\n", status.Output)
+	fmt.Printf("Level: %s\n", status.Level)
+	sources := make([]string, 0, len(status.Sources))
+	for source := range status.Sources {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+	for _, source := range sources {
+		fmt.Printf("  %s: %s\n", source, status.Sources[source])
+	}
+
+	if status.Metrics.Enabled {
+		fmt.Printf("Metrics: enabled on %s\n", status.Metrics.Address)
+	} else {
+		fmt.Println("Metrics: disabled")
+	}
+
+	fmt.Printf("Stream clients: %d\n", status.Streams)
+
+	if len(status.Notifiers) == 0 {
+		fmt.Println("Notifiers: none")
+	} else {
+		fmt.Println("Notifiers:")
+	}
+	for _, n := range status.Notifiers {
+		state := "enabled"
+		if !n.Enabled {
+			state = "disabled"
+		}
+		origin := "runtime"
+		if n.FromConfig {
+			origin = "config"
+		}
+		fmt.Printf("  %s (%s, %s, %s)\n", n.Name, n.Type, state, origin)
+	}
+
+	queues := make([]string, 0, len(status.Queues))
+	for name := range status.Queues {
+		queues = append(queues, name)
+	}
+	sort.Strings(queues)
+	if len(queues) > 0 {
+		fmt.Println("Queues:")
+	}
+	for _, name := range queues {
+		fmt.Printf("  %s: %d\n", name, status.Queues[name])
+	}
+}
+
 // spawnServiceCmd creates the command to spawn a new instance of the web service.
 func spawnServiceCmd() *cobra.Command {
 	var configPath string
@@ -78,6 +78,7 @@ func (m *Logz) Command() *cobra.Command {
 	cmd.AddCommand(cli.LogzCmds()...)
 	cmd.AddCommand(cli.ServiceCmd())
 	cmd.AddCommand(cli.MetricsCmd())
+	cmd.AddCommand(cli.NotifiersCmd())
 
 	// Set usage definitions for the command and its subcommands
 	setUsageDefinition(cmd)
@@ -0,0 +1,641 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/spf13/viper"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// adminSocketFile is the name of the unix socket the service serves its admin API on.
+	adminSocketFile = "logz_admin.sock"
+)
+
+// ErrServiceNotRunning is returned by the admin client when no service answers on the admin socket.
+var ErrServiceNotRunning = errors.New("the logz service is not running (start it with 'logz service start')")
+
+// MetricsStatus describes the metrics exporter of the running service.
+type MetricsStatus struct {
+	Enabled bool               `json:"enabled"`
+	Address string             `json:"address,omitempty"`
+	Metrics map[string]float64 `json:"metrics"`
+}
+
+// ServiceHealth is the liveness report of the running service.
+type ServiceHealth struct {
+	PID       int       `json:"pid"`
+	StartedAt time.Time `json:"startedAt"`
+	Uptime    string    `json:"uptime"`
+}
+
+// LevelStatus describes the logger level and the levels set per source.
+type LevelStatus struct {
+	Level   LogLevel            `json:"level"`
+	Sources map[string]LogLevel `json:"sources,omitempty"`
+}
+
+// NotifierStatus describes a notifier of the running service.
+type NotifierStatus struct {
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	Enabled    bool   `json:"enabled"`
+	FromConfig bool   `json:"fromConfig"`           // Defined in the configuration file, rather than added at runtime.
+	QueueDepth *int   `json:"queueDepth,omitempty"` // For notifiers that buffer their work.
+}
+
+// ServiceStatus is the runtime status of the service.
+type ServiceStatus struct {
+	ServiceHealth
+	LevelStatus
+	Output    string           `json:"output"`
+	Notifiers []NotifierStatus `json:"notifiers"`
+	Queues    map[string]int   `json:"queues"`
+	Metrics   MetricsStatus    `json:"metrics"`
+	Streams   int              `json:"streams"` // Clients connected to /stream.
+}
+
+// adminError is the body of failed admin responses.
+type adminError struct {
+	Error string `json:"error"`
+}
+
+// getAdminSocketPath returns the path of the admin socket, next to the PID file unless overridden.
+func getAdminSocketPath() string {
+	if envPath := os.Getenv("LOGZ_ADMIN_SOCKET"); envPath != "" {
+		return envPath
+	}
+	return filepath.Join(filepath.Dir(getPidPath()), adminSocketFile)
+}
+
+// listenAdmin starts serving the admin API on the unix socket. The socket is only accessible to the
+// user running the service. A socket left behind by a crashed service is replaced.
+func listenAdmin() (*http.Server, error) {
+	socketPath := getAdminSocketPath()
+	if conn, err := net.DialTimeout("unix", socketPath, time.Second); err == nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("admin socket %s is in use by another service", socketPath)
+	}
+	_ = os.Remove(socketPath)
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on admin socket: %w", err)
+	}
+	if err := os.Chmod(socketPath, 0600); err != nil {
+		_ = listener.Close()
+		return nil, fmt.Errorf("failed to set admin socket mode: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	registerAdminHandlers(mux)
+	srv := &http.Server{Handler: mux}
+	go func() {
+		if err := srv.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("Admin API stopped: %v", err)
+		}
+	}()
+	return srv, nil
+}
+
+// registerAdminHandlers registers the admin API handlers. They are served without authentication
+// on the admin socket, which only the user running the service can open, and with the admin scope
+// under /admin/ on the service listeners.
+func registerAdminHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("GET /admin/health", adminHealthHandler)
+	mux.HandleFunc("GET /admin/status", adminStatusHandler)
+	mux.HandleFunc("GET /admin/config", adminConfigHandler)
+	mux.HandleFunc("GET /admin/level", adminLevelHandler)
+	mux.HandleFunc("PUT /admin/level", adminSetLevelHandler)
+	mux.HandleFunc("GET /admin/queues", adminQueuesHandler)
+	mux.HandleFunc("GET /admin/notifiers", adminNotifiersHandler)
+	mux.HandleFunc("POST /admin/notifiers", adminAddNotifierHandler)
+	mux.HandleFunc("DELETE /admin/notifiers/{name}", adminRemoveNotifierHandler)
+	mux.HandleFunc("POST /admin/notifiers/{name}/test", adminTestNotifierHandler)
+	mux.HandleFunc("POST /admin/rotate", adminRotateHandler)
+	mux.HandleFunc("POST /admin/archive", adminArchiveHandler)
+	mux.HandleFunc("GET /admin/metrics", adminMetricsStatusHandler)
+	mux.HandleFunc("POST /admin/metrics", adminUpdateMetricHandler)
+	mux.HandleFunc("DELETE /admin/metrics/{name}", adminRemoveMetricHandler)
+	mux.HandleFunc("POST /admin/metrics/enable", adminEnableMetricsHandler)
+	mux.HandleFunc("POST /admin/metrics/disable", adminDisableMetricsHandler)
+}
+
+// adminHealthHandler reports the pid and uptime of the service.
+func adminHealthHandler(w http.ResponseWriter, _ *http.Request) {
+	writeAdminJSON(w, http.StatusOK, ServiceHealth{
+		PID:       os.Getpid(),
+		StartedAt: startTime,
+		Uptime:    time.Since(startTime).Round(time.Second).String(),
+	})
+}
+
+// adminStatusHandler reports the runtime status of the service.
+func adminStatusHandler(w http.ResponseWriter, _ *http.Request) {
+	writeAdminJSON(w, http.StatusOK, currentStatus())
+}
+
+// currentStatus returns the runtime status of the service.
+func currentStatus() ServiceStatus {
+	pm := GetPrometheusManager()
+	return ServiceStatus{
+		ServiceHealth: ServiceHealth{
+			PID:       os.Getpid(),
+			StartedAt: startTime,
+			Uptime:    time.Since(startTime).Round(time.Second).String(),
+		},
+		LevelStatus: currentLevels(),
+		Output:      globalLogger.GetConfig().Output(),
+		Notifiers:   notifierStatuses(),
+		Queues:      pm.QueueDepths(),
+		Metrics:     MetricsStatus{Enabled: pm.IsEnabled(), Address: pm.Address()},
+		Streams:     logStreams.subscriberCount(),
+	}
+}
+
+// adminConfigHandler dumps the effective configuration, with the secrets redacted.
+func adminConfigHandler(w http.ResponseWriter, _ *http.Request) {
+	settings := redactSettings(viper.AllSettings())
+	settings["effectiveLevels"] = currentLevels()
+	writeAdminJSON(w, http.StatusOK, settings)
+}
+
+// secretKeys are the configuration keys whose values are redacted from the dump, in lower case.
+var secretKeys = []string{"secret", "token", "authtoken", "password", "apikey", "bearertoken"}
+
+// redactSettings returns a copy of the settings with the values of secret keys redacted.
+func redactSettings(settings map[string]interface{}) map[string]interface{} {
+	redacted := make(map[string]interface{}, len(settings))
+	for key, value := range settings {
+		if slices.Contains(secretKeys, strings.ToLower(key)) {
+			if value != nil && value != "" {
+				value = "[redacted]"
+			}
+		} else {
+			value = redactValue(value)
+		}
+		redacted[key] = value
+	}
+	return redacted
+}
+
+// redactValue redacts the secrets of nested settings.
+func redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return redactSettings(v)
+	case []interface{}:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			items[i] = redactValue(item)
+		}
+		return items
+	default:
+		return value
+	}
+}
+
+// currentLevels returns the logger level and the levels set per source.
+func currentLevels() LevelStatus {
+	return LevelStatus{Level: globalLogger.GetLevel(), Sources: globalLogger.SourceLevels()}
+}
+
+// adminLevelHandler reports the logger level and the levels set per source.
+func adminLevelHandler(w http.ResponseWriter, _ *http.Request) {
+	writeAdminJSON(w, http.StatusOK, currentLevels())
+}
+
+// adminSetLevelHandler sets the logger level, or the level of a source when one is given. An
+// empty level removes the level of the source.
+func adminSetLevelHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Level  string `json:"level"`
+		Source string `json:"source,omitempty"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<10)).Decode(&req); err != nil {
+		writeAdminError(w, http.StatusBadRequest, fmt.Errorf("invalid JSON payload: %w", err))
+		return
+	}
+	level := LogLevel(strings.ToUpper(req.Level))
+	if _, ok := logLevels[level]; !ok && !(level == "" && req.Source != "") {
+		writeAdminError(w, http.StatusBadRequest, fmt.Errorf("invalid level '%s': use debug, info, warn, error or fatal", req.Level))
+		return
+	}
+	if req.Source != "" {
+		globalLogger.SetSourceLevel(req.Source, level)
+	} else {
+		globalLogger.SetLevel(level)
+	}
+	writeAdminJSON(w, http.StatusOK, currentLevels())
+}
+
+// adminQueuesHandler reports the depths of the queues of the writer and notifiers.
+func adminQueuesHandler(w http.ResponseWriter, _ *http.Request) {
+	writeAdminJSON(w, http.StatusOK, GetPrometheusManager().QueueDepths())
+}
+
+// notifierStatuses describes the notifiers of the service, sorted by name.
+func notifierStatuses() []NotifierStatus {
+	manager := globalLogger.GetConfig().NotifierManager()
+	names := manager.ListNotifiers()
+	sort.Strings(names)
+	statuses := make([]NotifierStatus, 0, len(names))
+	for _, name := range names {
+		notifier, ok := manager.GetNotifier(name)
+		if !ok || notifier == nil {
+			continue
+		}
+		status := NotifierStatus{Name: name, Type: notifierType(notifier), Enabled: notifier.Enabled()}
+		if impl, ok := manager.(*NotifierManagerImpl); ok {
+			status.FromConfig = impl.fromConfig(name)
+		}
+		if queue, ok := notifier.(QueueDepther); ok {
+			depth := queue.QueueDepth()
+			status.QueueDepth = &depth
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// notifierType names the type of a notifier as in the configuration.
+func notifierType(notifier Notifier) string {
+	switch n := notifier.(type) {
+	case *ThrottledNotifier:
+		return notifierType(n.Notifier)
+	case *HTTPNotifier:
+		return "http"
+	case *ZMQNotifier:
+		return "zmq"
+	case *DBusNotifier:
+		return "dbus"
+	case *ExecNotifier:
+		return "exec"
+	case *PluginNotifier:
+		return "plugin"
+	default:
+		return fmt.Sprintf("%T", notifier)
+	}
+}
+
+// adminNotifiersHandler lists the notifiers.
+func adminNotifiersHandler(w http.ResponseWriter, _ *http.Request) {
+	writeAdminJSON(w, http.StatusOK, notifierStatuses())
+}
+
+// adminAddNotifierHandler adds a notifier from a definition in the configuration file format,
+// replacing a notifier previously added at runtime. Notifiers added at runtime are kept across
+// reloads but not across restarts.
+func adminAddNotifierHandler(w http.ResponseWriter, r *http.Request) {
+	var payload map[string]interface{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&payload); err != nil {
+		writeAdminError(w, http.StatusBadRequest, fmt.Errorf("invalid JSON payload: %w", err))
+		return
+	}
+	name, ok := payload["name"].(string)
+	if !ok {
+		writeAdminError(w, http.StatusBadRequest, errors.New("the notifier name must be a string"))
+		return
+	}
+	delete(payload, "name")
+	// The definition is decoded as in the configuration file, with durations such as "5s"
+	nc, err := decodeNotifierConfig(payload)
+	if err != nil {
+		writeAdminError(w, http.StatusBadRequest, fmt.Errorf("invalid notifier definition: %w", err))
+		return
+	}
+	config := globalLogger.GetConfig()
+	if err := nc.Validate(name, config.Plugins()); err != nil {
+		writeAdminError(w, http.StatusBadRequest, err)
+		return
+	}
+	manager := config.NotifierManager()
+	if impl, ok := manager.(*NotifierManagerImpl); ok && impl.fromConfig(name) {
+		writeAdminError(w, http.StatusConflict, fmt.Errorf("notifier '%s' is defined in the configuration file", name))
+		return
+	}
+	notifier := nc.build(name, manager, config.Plugins())
+	if notifier == nil {
+		writeAdminError(w, http.StatusBadRequest, fmt.Errorf("notifier '%s' could not be created", name))
+		return
+	}
+	previous, replaced := manager.GetNotifier(name)
+	manager.AddNotifier(name, notifier)
+	if replaced {
+		closeNotifier(previous)
+	}
+	globalLogger.Info(fmt.Sprintf("Notifier '%s' added through the admin API", name), nil)
+	writeAdminJSON(w, http.StatusCreated, NotifierStatus{Name: name, Type: notifierType(notifier), Enabled: notifier.Enabled()})
+}
+
+// adminRemoveNotifierHandler removes a notifier. A notifier defined in the configuration file
+// comes back when the file changes or is reloaded.
+func adminRemoveNotifierHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	manager := globalLogger.GetConfig().NotifierManager()
+	notifier, ok := manager.GetNotifier(name)
+	if !ok {
+		writeAdminError(w, http.StatusNotFound, fmt.Errorf("notifier '%s' not found", name))
+		return
+	}
+	manager.RemoveNotifier(name)
+	closeNotifier(notifier)
+	globalLogger.Info(fmt.Sprintf("Notifier '%s' removed through the admin API", name), nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// adminTestNotifierHandler sends a test entry through a notifier, bypassing throttling and
+// silences. The level and source of the entry can be chosen to match the notifier's filters.
+func adminTestNotifierHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Level   string `json:"level,omitempty"`
+		Source  string `json:"source,omitempty"`
+		Message string `json:"message,omitempty"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<10)).Decode(&req); err != nil {
+			writeAdminError(w, http.StatusBadRequest, fmt.Errorf("invalid JSON payload: %w", err))
+			return
+		}
+	}
+	name := r.PathValue("name")
+	notifier, ok := globalLogger.GetConfig().NotifierManager().GetNotifier(name)
+	if !ok || notifier == nil {
+		writeAdminError(w, http.StatusNotFound, fmt.Errorf("notifier '%s' not found", name))
+		return
+	}
+	if throttled, ok := notifier.(*ThrottledNotifier); ok {
+		notifier = throttled.Notifier
+	}
+
+	level := LogLevel(strings.ToUpper(getOrDefault(req.Level, string(INFO))))
+	if _, ok := logLevels[level]; !ok {
+		writeAdminError(w, http.StatusBadRequest, fmt.Errorf("invalid level '%s'", req.Level))
+		return
+	}
+	entry := NewLogEntry().
+		WithLevel(level).
+		WithSeverity(logLevels[level]).
+		WithSource(getOrDefault(req.Source, "logz")).
+		WithMessage(getOrDefault(req.Message, "Test notification from logz"))
+	if !notifier.Enabled() {
+		writeAdminError(w, http.StatusUnprocessableEntity, fmt.Errorf("notifier '%s' is disabled", name))
+		return
+	}
+	if filter, ok := notifier.(entryFilter); ok && !filter.accepts(entry) {
+		writeAdminError(w, http.StatusUnprocessableEntity, fmt.Errorf("notifier '%s' filters out %s entries from '%s': pick a level and source it accepts", name, level, entry.GetSource()))
+		return
+	}
+
+	started := time.Now()
+	err := notifier.Notify(entry)
+	recordNotification(name, time.Since(started), err)
+	if err != nil {
+		writeAdminError(w, http.StatusBadGateway, fmt.Errorf("notifier '%s' failed: %w", name, err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// adminRotateHandler rotates the output file of the service: the file is renamed, the writer
+// reopens a new one and the rotated file is compressed next to it.
+func adminRotateHandler(w http.ResponseWriter, _ *http.Request) {
+	output, _ := globalLogger.outputFile()
+	if output == "" {
+		writeAdminError(w, http.StatusConflict, errors.New("the service does not write to a file"))
+		return
+	}
+	rotated := fmt.Sprintf("%s.%s", output, time.Now().Format("20060102_150405"))
+	if err := os.Rename(output, rotated); err != nil {
+		writeAdminError(w, http.StatusInternalServerError, fmt.Errorf("failed to rotate the output file: %w", err))
+		return
+	}
+	globalLogger.Reopen()
+
+	archivePath := rotated + ".tar.gz"
+	if err := CreateTarGz(archivePath, []string{rotated}); err != nil {
+		writeAdminError(w, http.StatusInternalServerError, err)
+		return
+	}
+	_ = os.Remove(rotated)
+	writeAdminJSON(w, http.StatusOK, map[string]string{"archive": archivePath})
+}
+
+// adminArchiveHandler archives the log files of the output directory into a zip file.
+func adminArchiveHandler(w http.ResponseWriter, _ *http.Request) {
+	output, _ := globalLogger.outputFile()
+	if output == "" {
+		writeAdminError(w, http.StatusConflict, errors.New("the service does not write to a file"))
+		return
+	}
+	files, err := filepath.Glob(filepath.Join(filepath.Dir(output), "*.log"))
+	if err != nil || len(files) == 0 {
+		writeAdminError(w, http.StatusConflict, errors.New("no log file to archive"))
+		return
+	}
+	archivePath, err := archiveLogs(files)
+	if err != nil {
+		writeAdminError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, map[string]string{"archive": archivePath})
+}
+
+// adminMetricsStatusHandler reports the exporter state and the current metrics.
+func adminMetricsStatusHandler(w http.ResponseWriter, _ *http.Request) {
+	pm := GetPrometheusManager()
+	writeAdminJSON(w, http.StatusOK, MetricsStatus{
+		Enabled: pm.IsEnabled(),
+		Address: pm.Address(),
+		Metrics: pm.GetMetrics(),
+	})
+}
+
+// adminUpdateMetricHandler applies a MetricUpdate.
+func adminUpdateMetricHandler(w http.ResponseWriter, r *http.Request) {
+	var update MetricUpdate
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&update); err != nil {
+		writeAdminError(w, http.StatusBadRequest, fmt.Errorf("invalid JSON payload: %w", err))
+		return
+	}
+	if err := GetPrometheusManager().UpdateMetric(update); err != nil {
+		writeAdminError(w, http.StatusBadRequest, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// adminRemoveMetricHandler removes a metric family.
+func adminRemoveMetricHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if !GetPrometheusManager().RemoveMetric(name) {
+		writeAdminError(w, http.StatusNotFound, fmt.Errorf("metric '%s' not found", name))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// adminEnableMetricsHandler starts the metrics exporter on the requested port.
+func adminEnableMetricsHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Port string `json:"port"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<10)).Decode(&req); err != nil {
+		writeAdminError(w, http.StatusBadRequest, fmt.Errorf("invalid JSON payload: %w", err))
+		return
+	}
+	pm := GetPrometheusManager()
+	if err := pm.Enable(req.Port); err != nil {
+		writeAdminError(w, http.StatusConflict, err)
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, MetricsStatus{Enabled: true, Address: pm.Address()})
+}
+
+// adminDisableMetricsHandler stops the metrics exporter.
+func adminDisableMetricsHandler(w http.ResponseWriter, _ *http.Request) {
+	if err := GetPrometheusManager().Disable(); err != nil {
+		writeAdminError(w, http.StatusConflict, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeAdminJSON writes a JSON response.
+func writeAdminJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// writeAdminError writes a JSON error response.
+func writeAdminError(w http.ResponseWriter, status int, err error) {
+	writeAdminJSON(w, status, adminError{Error: err.Error()})
+}
+
+// AdminClient talks to the admin API of the running service over its unix socket.
+type AdminClient struct {
+	socketPath string
+	client     *http.Client
+}
+
+// NewAdminClient creates a client for the admin API of the local service.
+func NewAdminClient() *AdminClient {
+	socketPath := getAdminSocketPath()
+	return &AdminClient{
+		socketPath: socketPath,
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", socketPath)
+				},
+			},
+		},
+	}
+}
+
+// do sends a request to the admin API, decoding the JSON response into out when not nil.
+func (c *AdminClient) do(method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, "http://logz"+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		var opErr *net.OpError
+		if errors.As(err, &opErr) && opErr.Op == "dial" {
+			return ErrServiceNotRunning
+		}
+		return fmt.Errorf("admin request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var apiErr adminError
+		if json.NewDecoder(resp.Body).Decode(&apiErr) == nil && apiErr.Error != "" {
+			return errors.New(apiErr.Error)
+		}
+		return fmt.Errorf("admin request failed: %s", resp.Status)
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
+
+// Health returns the liveness report of the service.
+func (c *AdminClient) Health() (*ServiceHealth, error) {
+	var health ServiceHealth
+	if err := c.do(http.MethodGet, "/admin/health", nil, &health); err != nil {
+		return nil, err
+	}
+	return &health, nil
+}
+
+// Status returns the runtime status of the service.
+func (c *AdminClient) Status() (*ServiceStatus, error) {
+	var status ServiceStatus
+	if err := c.do(http.MethodGet, "/admin/status", nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// MetricsStatus returns the exporter state and the current metrics of the service.
+func (c *AdminClient) MetricsStatus() (*MetricsStatus, error) {
+	var status MetricsStatus
+	if err := c.do(http.MethodGet, "/admin/metrics", nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// UpdateMetric applies a metric update in the service.
+func (c *AdminClient) UpdateMetric(update MetricUpdate) error {
+	return c.do(http.MethodPost, "/admin/metrics", update, nil)
+}
+
+// RemoveMetric removes a metric family from the service.
+func (c *AdminClient) RemoveMetric(name string) error {
+	return c.do(http.MethodDelete, "/admin/metrics/"+name, nil, nil)
+}
+
+// EnableMetrics starts the service's metrics exporter on the given port and returns its address.
+func (c *AdminClient) EnableMetrics(port string) (string, error) {
+	var status MetricsStatus
+	if err := c.do(http.MethodPost, "/admin/metrics/enable", map[string]string{"port": port}, &status); err != nil {
+		return "", err
+	}
+	return status.Address, nil
+}
+
+// DisableMetrics stops the service's metrics exporter.
+func (c *AdminClient) DisableMetrics() error {
+	return c.do(http.MethodPost, "/admin/metrics/disable", nil, nil)
+}
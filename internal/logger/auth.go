@@ -0,0 +1,315 @@
+package logger
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/spf13/viper"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Scope is a permission granted to an authenticated principal.
+type Scope string
+
+const (
+	ScopeIngest Scope = "ingest" // Send log entries to /<integration>/receive.
+	ScopeRead   Scope = "read"   // Read health and metrics.
+	ScopeAdmin  Scope = "admin"  // Manage the service.
+)
+
+// Authentication methods recorded on principals.
+const (
+	AuthBearer    = "bearer"
+	AuthAPIKey    = "apikey"
+	AuthMTLS      = "mtls"
+	AuthAnonymous = "anonymous"
+)
+
+// apiKeyHeader carries per-integration API keys.
+const apiKeyHeader = "X-API-Key"
+
+// ErrInvalidCredentials is returned by authenticators for credentials that are present but wrong.
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// Principal is the identity behind a request.
+type Principal struct {
+	Name        string  `json:"name"`
+	Method      string  `json:"method"`
+	Scopes      []Scope `json:"scopes"`
+	Integration string  `json:"integration,omitempty"` // When set, the principal may only use this integration.
+}
+
+// Allows reports whether the principal holds the scope for the integration ("" for service-wide endpoints).
+func (p *Principal) Allows(scope Scope, integration string) bool {
+	if p.Integration != "" && p.Integration != integration {
+		return false
+	}
+	return slices.Contains(p.Scopes, scope) || slices.Contains(p.Scopes, ScopeAdmin)
+}
+
+// Authenticator identifies the principal of a request. It returns a nil principal and no error
+// when the request carries none of the credentials it handles, so that the next authenticator is tried.
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+// AuthenticatorFunc adapts a function to the Authenticator interface.
+type AuthenticatorFunc func(r *http.Request) (*Principal, error)
+
+// Authenticate calls f(r).
+func (f AuthenticatorFunc) Authenticate(r *http.Request) (*Principal, error) { return f(r) }
+
+// Credential is a named secret with its scopes. The secret may be given in clear or as
+// "sha256:<hex digest>", so that the configuration does not have to hold it.
+type Credential struct {
+	Name   string  `json:"name" mapstructure:"name"`
+	Secret string  `json:"secret" mapstructure:"secret"`
+	Scopes []Scope `json:"scopes" mapstructure:"scopes"`
+}
+
+// matches compares the presented secret in constant time.
+func (c Credential) matches(presented string) bool {
+	if digest, ok := strings.CutPrefix(c.Secret, "sha256:"); ok {
+		sum := sha256.Sum256([]byte(presented))
+		return subtle.ConstantTimeCompare([]byte(strings.ToLower(digest)), []byte(hex.EncodeToString(sum[:]))) == 1
+	}
+	return subtle.ConstantTimeCompare([]byte(c.Secret), []byte(presented)) == 1
+}
+
+// ClientCertIdentity grants scopes to the clients whose verified certificate carries the subject,
+// as common name or DNS, email or URI subject alternative name.
+type ClientCertIdentity struct {
+	Subject string  `json:"subject" mapstructure:"subject"`
+	Scopes  []Scope `json:"scopes" mapstructure:"scopes"`
+}
+
+// AuthConfig configures the service authentication ("auth" in the configuration). Per-integration
+// API keys are configured in "integrations.<name>.apiKeys".
+type AuthConfig struct {
+	Tokens      []Credential            `json:"tokens,omitempty" mapstructure:"tokens"`           // Static bearer tokens.
+	ClientCerts []ClientCertIdentity    `json:"clientCerts,omitempty" mapstructure:"clientCerts"` // mTLS identities.
+	Anonymous   []Scope                 `json:"anonymous,omitempty" mapstructure:"anonymous"`     // Scopes granted without credentials.
+	APIKeys     map[string][]Credential `json:"-" mapstructure:"-"`                               // Per integration.
+}
+
+// enabled reports whether any credential is configured. Without credentials the service stays open.
+func (c *AuthConfig) enabled() bool {
+	if len(c.Tokens) > 0 || len(c.ClientCerts) > 0 {
+		return true
+	}
+	for _, keys := range c.APIKeys {
+		if len(keys) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// validateScopes rejects unknown scopes.
+func validateScopes(scopes []Scope) error {
+	for _, scope := range scopes {
+		switch scope {
+		case ScopeIngest, ScopeRead, ScopeAdmin:
+		default:
+			return fmt.Errorf("unknown scope '%s': use ingest, read or admin", scope)
+		}
+	}
+	return nil
+}
+
+// loadAuthConfig reads the "auth" section and the API keys of the enabled integrations.
+func loadAuthConfig(vpr *viper.Viper) (*AuthConfig, error) {
+	cfg := &AuthConfig{APIKeys: make(map[string][]Credential)}
+	if err := vpr.UnmarshalKey("auth", cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse auth config: %w", err)
+	}
+	var errs []error
+	for integration := range vpr.GetStringMap("integrations") {
+		var keys []Credential
+		if err := vpr.UnmarshalKey("integrations."+integration+".apiKeys", &keys); err != nil {
+			errs = append(errs, fmt.Errorf("integration '%s': %w", integration, err))
+			continue
+		}
+		cfg.APIKeys[integration] = keys
+	}
+
+	check := func(kind string, creds []Credential) {
+		for i, c := range creds {
+			if c.Secret == "" {
+				errs = append(errs, fmt.Errorf("%s %d (%s): secret is required", kind, i, c.Name))
+			}
+			if err := validateScopes(c.Scopes); err != nil {
+				errs = append(errs, fmt.Errorf("%s %d (%s): %w", kind, i, c.Name, err))
+			}
+		}
+	}
+	check("token", cfg.Tokens)
+	for integration, keys := range cfg.APIKeys {
+		check("api key of '"+integration+"'", keys)
+	}
+	for i, id := range cfg.ClientCerts {
+		if id.Subject == "" {
+			errs = append(errs, fmt.Errorf("client cert %d: subject is required", i))
+		}
+		if err := validateScopes(id.Scopes); err != nil {
+			errs = append(errs, fmt.Errorf("client cert %d (%s): %w", i, id.Subject, err))
+		}
+	}
+	if err := validateScopes(cfg.Anonymous); err != nil {
+		errs = append(errs, fmt.Errorf("anonymous: %w", err))
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return cfg, nil
+}
+
+var (
+	extraAuthenticators   []Authenticator
+	extraAuthenticatorsMu sync.RWMutex
+)
+
+// RegisterAuthenticator adds an authenticator tried after the built-in ones (mTLS, bearer tokens
+// and API keys), for example to validate JWTs issued by an identity provider.
+func RegisterAuthenticator(a Authenticator) {
+	extraAuthenticatorsMu.Lock()
+	defer extraAuthenticatorsMu.Unlock()
+	extraAuthenticators = append(extraAuthenticators, a)
+}
+
+// authenticators returns the authenticator chain for the configuration.
+func (c *AuthConfig) authenticators() []Authenticator {
+	chain := []Authenticator{
+		AuthenticatorFunc(c.authenticateClientCert),
+		AuthenticatorFunc(c.authenticateBearer),
+		AuthenticatorFunc(c.authenticateAPIKey),
+	}
+	extraAuthenticatorsMu.RLock()
+	defer extraAuthenticatorsMu.RUnlock()
+	return append(chain, extraAuthenticators...)
+}
+
+// authenticateClientCert identifies clients by the certificate verified by the TLS listener.
+func (c *AuthConfig) authenticateClientCert(r *http.Request) (*Principal, error) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(c.ClientCerts) == 0 {
+		return nil, nil
+	}
+	cert := r.TLS.VerifiedChains[0][0]
+	subjects := append([]string{cert.Subject.CommonName}, cert.DNSNames...)
+	subjects = append(subjects, cert.EmailAddresses...)
+	for _, uri := range cert.URIs {
+		subjects = append(subjects, uri.String())
+	}
+	for _, id := range c.ClientCerts {
+		if slices.Contains(subjects, id.Subject) {
+			return &Principal{Name: id.Subject, Method: AuthMTLS, Scopes: id.Scopes}, nil
+		}
+	}
+	return nil, nil
+}
+
+// authenticateBearer checks "Authorization: Bearer <token>" against the static tokens.
+func (c *AuthConfig) authenticateBearer(r *http.Request) (*Principal, error) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || len(c.Tokens) == 0 {
+		return nil, nil
+	}
+	for _, cred := range c.Tokens {
+		if cred.matches(strings.TrimSpace(token)) {
+			return &Principal{Name: cred.Name, Method: AuthBearer, Scopes: cred.Scopes}, nil
+		}
+	}
+	return nil, ErrInvalidCredentials
+}
+
+// authenticateAPIKey checks the X-API-Key header against the keys of every integration. The
+// principal is bound to the integration of its key.
+func (c *AuthConfig) authenticateAPIKey(r *http.Request) (*Principal, error) {
+	key := r.Header.Get(apiKeyHeader)
+	if key == "" {
+		return nil, nil
+	}
+	for integration, keys := range c.APIKeys {
+		for _, cred := range keys {
+			if cred.matches(key) {
+				return &Principal{Name: cred.Name, Method: AuthAPIKey, Scopes: cred.Scopes, Integration: integration}, nil
+			}
+		}
+	}
+	return nil, ErrInvalidCredentials
+}
+
+type principalKey struct{}
+
+// PrincipalFromContext returns the principal authenticated for the request, if any.
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok
+}
+
+// authMiddleware wraps service handlers with authentication and scope checks.
+type authMiddleware struct {
+	cfg   *AuthConfig
+	chain []Authenticator
+	open  bool // No credentials nor custom authenticators: every request is let through
+}
+
+// newAuthMiddleware builds the middleware for the configuration.
+func newAuthMiddleware(cfg *AuthConfig) *authMiddleware {
+	extraAuthenticatorsMu.RLock()
+	custom := len(extraAuthenticators) > 0
+	extraAuthenticatorsMu.RUnlock()
+	return &authMiddleware{cfg: cfg, chain: cfg.authenticators(), open: !cfg.enabled() && !custom}
+}
+
+// authenticate runs the authenticator chain. Requests without credentials get the anonymous scopes.
+func (m *authMiddleware) authenticate(r *http.Request) (*Principal, error) {
+	for _, a := range m.chain {
+		p, err := a.Authenticate(r)
+		if err != nil {
+			return nil, err
+		}
+		if p != nil {
+			return p, nil
+		}
+	}
+	return &Principal{Name: AuthAnonymous, Method: AuthAnonymous, Scopes: m.cfg.Anonymous}, nil
+}
+
+// require protects the handler with the scope for the integration. Without any credential or
+// custom authenticator every request is let through as anonymous, as before authentication existed.
+func (m *authMiddleware) require(scope Scope, integration string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if m.open {
+			anonymous := &Principal{Name: AuthAnonymous, Method: AuthAnonymous, Scopes: []Scope{ScopeAdmin}}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, anonymous)))
+			return
+		}
+		p, err := m.authenticate(r)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="logz"`)
+			writeAdminError(w, http.StatusUnauthorized, err)
+			return
+		}
+		if !p.Allows(scope, integration) {
+			if p.Method == AuthAnonymous {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="logz"`)
+				writeAdminError(w, http.StatusUnauthorized, errors.New("authentication required"))
+				return
+			}
+			if integration != "" {
+				writeAdminError(w, http.StatusForbidden, fmt.Errorf("'%s' is not allowed to %s on '%s'", p.Name, scope, integration))
+			} else {
+				writeAdminError(w, http.StatusForbidden, fmt.Errorf("'%s' is not allowed to %s", p.Name, scope))
+			}
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, p)))
+	})
+}
@@ -0,0 +1,156 @@
+package logger
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// testAuthConfig grants one credential of each kind.
+func testAuthConfig() *AuthConfig {
+	hashed := sha256.Sum256([]byte("hashed-secret"))
+	return &AuthConfig{
+		Tokens: []Credential{
+			{Name: "shipper", Secret: "ingest-secret", Scopes: []Scope{ScopeIngest}},
+			{Name: "dashboard", Secret: "read-secret", Scopes: []Scope{ScopeRead}},
+			{Name: "operator", Secret: "admin-secret", Scopes: []Scope{ScopeAdmin}},
+			{Name: "hashed", Secret: "sha256:" + hex.EncodeToString(hashed[:]), Scopes: []Scope{ScopeRead}},
+		},
+		ClientCerts: []ClientCertIdentity{
+			{Subject: "agent.example.com", Scopes: []Scope{ScopeIngest}},
+		},
+		APIKeys: map[string][]Credential{
+			"app": {{Name: "app-key", Secret: "app-secret", Scopes: []Scope{ScopeIngest, ScopeRead}}},
+		},
+	}
+}
+
+// verifiedCert returns the TLS state of a connection whose client certificate was verified.
+func verifiedCert(commonName string, dnsNames ...string) *tls.ConnectionState {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: commonName}, DNSNames: dnsNames}
+	return &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+}
+
+func TestAuthMiddlewareRequire(t *testing.T) {
+	bearer := func(token string) func(*http.Request) {
+		return func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+token) }
+	}
+	apiKey := func(key string) func(*http.Request) {
+		return func(r *http.Request) { r.Header.Set(apiKeyHeader, key) }
+	}
+	clientCert := func(commonName string, dnsNames ...string) func(*http.Request) {
+		return func(r *http.Request) { r.TLS = verifiedCert(commonName, dnsNames...) }
+	}
+
+	tests := []struct {
+		name        string
+		scope       Scope
+		integration string
+		credential  func(*http.Request)
+		status      int
+		principal   string
+	}{
+		{"missing credential", ScopeIngest, "app", nil, http.StatusUnauthorized, ""},
+		{"missing credential on admin", ScopeAdmin, "", nil, http.StatusUnauthorized, ""},
+
+		{"bearer", ScopeIngest, "app", bearer("ingest-secret"), http.StatusOK, "shipper"},
+		{"bearer scheme is case-insensitive", ScopeIngest, "app", func(r *http.Request) { r.Header.Set("Authorization", "bearer ingest-secret") }, http.StatusOK, "shipper"},
+		{"bearer hashed secret", ScopeRead, "", bearer("hashed-secret"), http.StatusOK, "hashed"},
+		{"bearer wrong secret", ScopeIngest, "app", bearer("nope"), http.StatusUnauthorized, ""},
+		{"bearer wrong scope", ScopeRead, "app", bearer("ingest-secret"), http.StatusForbidden, ""},
+		{"bearer read on admin", ScopeAdmin, "", bearer("read-secret"), http.StatusForbidden, ""},
+		{"bearer ingest on admin", ScopeAdmin, "", bearer("ingest-secret"), http.StatusForbidden, ""},
+		{"bearer admin on admin", ScopeAdmin, "", bearer("admin-secret"), http.StatusOK, "operator"},
+		{"bearer admin implies ingest", ScopeIngest, "other", bearer("admin-secret"), http.StatusOK, "operator"},
+
+		{"api key", ScopeIngest, "app", apiKey("app-secret"), http.StatusOK, "app-key"},
+		{"api key second scope", ScopeRead, "app", apiKey("app-secret"), http.StatusOK, "app-key"},
+		{"api key wrong secret", ScopeIngest, "app", apiKey("nope"), http.StatusUnauthorized, ""},
+		{"api key other integration", ScopeIngest, "other", apiKey("app-secret"), http.StatusForbidden, ""},
+		{"api key service-wide endpoint", ScopeRead, "", apiKey("app-secret"), http.StatusForbidden, ""},
+		{"api key on admin", ScopeAdmin, "", apiKey("app-secret"), http.StatusForbidden, ""},
+
+		{"mtls common name", ScopeIngest, "app", clientCert("agent.example.com"), http.StatusOK, "agent.example.com"},
+		{"mtls subject alternative name", ScopeIngest, "app", clientCert("other", "agent.example.com"), http.StatusOK, "agent.example.com"},
+		{"mtls unknown subject", ScopeIngest, "app", clientCert("stranger.example.com"), http.StatusUnauthorized, ""},
+		{"mtls wrong scope", ScopeRead, "app", clientCert("agent.example.com"), http.StatusForbidden, ""},
+		{"mtls on admin", ScopeAdmin, "", clientCert("agent.example.com"), http.StatusForbidden, ""},
+		{"mtls before bearer", ScopeIngest, "app", func(r *http.Request) {
+			r.TLS = verifiedCert("agent.example.com")
+			r.Header.Set("Authorization", "Bearer admin-secret")
+		}, http.StatusOK, "agent.example.com"},
+	}
+
+	auth := newAuthMiddleware(testAuthConfig())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var principal *Principal
+			handler := auth.require(tt.scope, tt.integration, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				principal, _ = PrincipalFromContext(r.Context())
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.credential != nil {
+				tt.credential(req)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if tt.status == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+				t.Error("WWW-Authenticate header missing")
+			}
+			if tt.status != http.StatusOK {
+				if principal != nil {
+					t.Fatalf("handler called for %s", principal.Name)
+				}
+				return
+			}
+			if principal == nil || principal.Name != tt.principal {
+				t.Fatalf("principal = %+v, want %s", principal, tt.principal)
+			}
+		})
+	}
+}
+
+func TestAuthMiddlewareAnonymous(t *testing.T) {
+	cfg := testAuthConfig()
+	cfg.Anonymous = []Scope{ScopeRead}
+	auth := newAuthMiddleware(cfg)
+	ok := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+
+	tests := []struct {
+		scope  Scope
+		status int
+	}{
+		{ScopeRead, http.StatusOK},
+		{ScopeIngest, http.StatusUnauthorized},
+		{ScopeAdmin, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		auth.require(tt.scope, "app", ok).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		if rec.Code != tt.status {
+			t.Errorf("anonymous %s: status = %d, want %d", tt.scope, rec.Code, tt.status)
+		}
+	}
+}
+
+func TestAuthMiddlewareOpenWithoutCredentials(t *testing.T) {
+	auth := newAuthMiddleware(&AuthConfig{})
+	var principal *Principal
+	handler := auth.require(ScopeAdmin, "", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, _ = PrincipalFromContext(r.Context())
+	}))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/status", nil))
+	if rec.Code != http.StatusOK || principal == nil || principal.Method != AuthAnonymous {
+		t.Fatalf("status = %d, principal = %+v", rec.Code, principal)
+	}
+}
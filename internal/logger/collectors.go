@@ -0,0 +1,343 @@
+package logger
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"runtime/metrics"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// procClockTicks is the USER_HZ used by /proc/self/stat times, 100 on all common Linux platforms.
+const procClockTicks = 100
+
+var (
+	// gcPauseBuckets are the buckets GC pauses are reported in.
+	gcPauseBuckets = []float64{1e-5, 5e-5, 1e-4, 5e-4, 1e-3, 5e-3, 1e-2, 5e-2, 0.1, 1}
+	// notificationBuckets are the buckets notification latencies are reported in.
+	notificationBuckets = []float64{.001, .005, .01, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+	// internalMetrics is set when the internal collector is enabled, so that the hot paths
+	// recording logz internals do nothing otherwise.
+	internalMetrics atomic.Bool
+)
+
+// CollectorsConfig toggles the built-in collectors exposed next to the user metrics.
+type CollectorsConfig struct {
+	Runtime  bool `json:"runtime,omitempty" mapstructure:"runtime"`   // Goroutines, GC and heap statistics (go_*).
+	Process  bool `json:"process,omitempty" mapstructure:"process"`   // Open fds, RSS and CPU from /proc/self (process_*).
+	Internal bool `json:"internal,omitempty" mapstructure:"internal"` // Entries written, bytes, notifications and queue depths (logz_*).
+}
+
+// QueueDepther is implemented by notifiers and writers that buffer work, to report how many
+// entries are waiting or in flight.
+type QueueDepther interface {
+	QueueDepth() int
+}
+
+// runtimeGauges maps runtime/metrics samples to gauges, and runtimeCounters to counters.
+var runtimeGauges = map[string]MetricDefinition{
+	"/sched/goroutines:goroutines":       {Name: "go_goroutines", Help: "Number of goroutines that currently exist."},
+	"/gc/heap/objects:objects":           {Name: "go_heap_objects", Help: "Number of objects, live or unswept, occupying heap memory."},
+	"/memory/classes/heap/objects:bytes": {Name: "go_heap_objects_bytes", Help: "Memory occupied by live objects and dead objects that have not yet been freed."},
+	"/gc/heap/goal:bytes":                {Name: "go_heap_goal_bytes", Help: "Heap size target for the end of the GC cycle."},
+	"/memory/classes/total:bytes":        {Name: "go_memory_total_bytes", Help: "All memory mapped by the Go runtime."},
+}
+var runtimeCounters = map[string]MetricDefinition{
+	"/gc/cycles/total:gc-cycles": {Name: "go_gc_cycles_total", Help: "Count of all completed GC cycles."},
+	"/gc/heap/allocs:bytes":      {Name: "go_heap_allocs_bytes_total", Help: "Cumulative sum of memory allocated to the heap."},
+}
+
+// runtimeGCPauses is the runtime/metrics histogram of stop-the-world GC pauses.
+const runtimeGCPauses = "/sched/pauses/total/gc:seconds"
+
+// EnableCollectors replaces the set of enabled collectors.
+func (pm *PrometheusManager) EnableCollectors(cfg CollectorsConfig) {
+	pm.mutex.Lock()
+	pm.collectors = cfg
+	pm.mutex.Unlock()
+	internalMetrics.Store(cfg.Internal)
+}
+
+// RegisterQueueSource adds a function reporting queue depths by queue name, exposed by the
+// internal collector as logz_queue_depth.
+func (pm *PrometheusManager) RegisterQueueSource(source func() map[string]int) {
+	pm.mutex.Lock()
+	defer pm.mutex.Unlock()
+	pm.queueSources = append(pm.queueSources, source)
+}
+
+// runCollectors refreshes the collected metrics. It runs before every exposition and push.
+func (pm *PrometheusManager) runCollectors() {
+	pm.mutex.RLock()
+	cfg := pm.collectors
+	sources := append([]func() map[string]int(nil), pm.queueSources...)
+	pm.mutex.RUnlock()
+
+	if cfg.Runtime {
+		if err := pm.collectRuntime(); err != nil {
+			log.Printf("Error collecting runtime metrics: %v", err)
+		}
+	}
+	if cfg.Process {
+		if err := pm.collectProcess(); err != nil {
+			log.Printf("Error collecting process metrics: %v", err)
+		}
+	}
+	if cfg.Internal {
+		for _, source := range sources {
+			for queue, depth := range source() {
+				pm.storeCollected(MetricDefinition{Name: "logz_queue_depth", Help: "Entries waiting or in flight per queue.", Type: GaugeMetric},
+					map[string]string{"queue": queue}, float64(depth))
+			}
+		}
+	}
+}
+
+// QueueDepths returns the depths reported by the queue sources, by queue name.
+func (pm *PrometheusManager) QueueDepths() map[string]int {
+	pm.mutex.RLock()
+	sources := append([]func() map[string]int(nil), pm.queueSources...)
+	pm.mutex.RUnlock()
+
+	depths := make(map[string]int)
+	for _, source := range sources {
+		for queue, depth := range source() {
+			depths[queue] = depth
+		}
+	}
+	return depths
+}
+
+// storeCollected stores an absolute value in a volatile counter or gauge.
+func (pm *PrometheusManager) storeCollected(def MetricDefinition, labels map[string]string, value float64) {
+	def.Volatile = true
+	if err := pm.DefineMetric(def); err != nil {
+		log.Printf("Error defining collected metric: %v", err)
+		return
+	}
+	_, s, err := pm.series(def.Name, def.Type, labels)
+	if err != nil {
+		log.Printf("Error storing collected metric: %v", err)
+		return
+	}
+	s.set(value)
+}
+
+// collectRuntime reads the runtime/metrics samples.
+func (pm *PrometheusManager) collectRuntime() error {
+	samples := make([]metrics.Sample, 0, len(runtimeGauges)+len(runtimeCounters)+1)
+	for name := range runtimeGauges {
+		samples = append(samples, metrics.Sample{Name: name})
+	}
+	for name := range runtimeCounters {
+		samples = append(samples, metrics.Sample{Name: name})
+	}
+	samples = append(samples, metrics.Sample{Name: runtimeGCPauses})
+	metrics.Read(samples)
+
+	for _, sample := range samples {
+		var value float64
+		switch sample.Value.Kind() {
+		case metrics.KindUint64:
+			value = float64(sample.Value.Uint64())
+		case metrics.KindFloat64:
+			value = sample.Value.Float64()
+		case metrics.KindFloat64Histogram:
+			pm.storeRuntimeHistogram(sample.Value.Float64Histogram())
+			continue
+		default:
+			continue // Not supported by this Go version
+		}
+		if def, ok := runtimeGauges[sample.Name]; ok {
+			def.Type = GaugeMetric
+			pm.storeCollected(def, nil, value)
+		} else if def, ok := runtimeCounters[sample.Name]; ok {
+			def.Type = CounterMetric
+			pm.storeCollected(def, nil, value)
+		}
+	}
+	return nil
+}
+
+// storeRuntimeHistogram folds the fine-grained runtime GC pause histogram into gcPauseBuckets.
+// The sum is estimated from the bucket midpoints, as the runtime does not report it.
+func (pm *PrometheusManager) storeRuntimeHistogram(h *metrics.Float64Histogram) {
+	def := MetricDefinition{
+		Name:     "go_gc_pause_seconds",
+		Help:     "Distribution of stop-the-world GC pauses.",
+		Type:     HistogramMetric,
+		Buckets:  gcPauseBuckets,
+		Volatile: true,
+	}
+	if err := pm.DefineMetric(def); err != nil {
+		log.Printf("Error defining collected metric: %v", err)
+		return
+	}
+	f, s, err := pm.series(def.Name, HistogramMetric, nil)
+	if err != nil {
+		log.Printf("Error storing collected metric: %v", err)
+		return
+	}
+
+	buckets := make([]uint64, len(f.Buckets))
+	var sum float64
+	var count uint64
+	for i, n := range h.Counts {
+		if n == 0 {
+			continue
+		}
+		lower, upper := h.Buckets[i], h.Buckets[i+1]
+		count += n
+		switch {
+		case math.IsInf(upper, 1):
+			sum += float64(n) * lower
+		case math.IsInf(lower, -1):
+			sum += float64(n) * upper
+		default:
+			sum += float64(n) * (lower + upper) / 2
+		}
+		for j, bound := range f.Buckets {
+			if upper <= bound {
+				buckets[j] += n
+				break
+			}
+		}
+	}
+
+	s.mu.Lock()
+	s.buckets = buckets
+	s.sum = sum
+	s.count = count
+	s.mu.Unlock()
+}
+
+// collectProcess reads the process statistics from /proc/self. It does nothing where /proc is not available.
+func (pm *PrometheusManager) collectProcess() error {
+	stat, err := os.ReadFile("/proc/self/stat")
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	// Fields after the command name, which may contain spaces; fields[0] is field 3 (state)
+	closing := strings.LastIndexByte(string(stat), ')')
+	if closing < 0 {
+		return fmt.Errorf("unexpected /proc/self/stat format")
+	}
+	fields := strings.Fields(string(stat[closing+1:]))
+	if len(fields) < 22 {
+		return fmt.Errorf("unexpected /proc/self/stat format")
+	}
+	utime, _ := strconv.ParseFloat(fields[11], 64)
+	stime, _ := strconv.ParseFloat(fields[12], 64)
+	startTicks, _ := strconv.ParseFloat(fields[19], 64)
+	vsize, _ := strconv.ParseFloat(fields[20], 64)
+	rssPages, _ := strconv.ParseFloat(fields[21], 64)
+
+	pm.storeCollected(MetricDefinition{Name: "process_cpu_seconds_total", Help: "Total user and system CPU time spent in seconds.", Type: CounterMetric},
+		nil, (utime+stime)/procClockTicks)
+	pm.storeCollected(MetricDefinition{Name: "process_resident_memory_bytes", Help: "Resident memory size in bytes.", Type: GaugeMetric},
+		nil, rssPages*float64(os.Getpagesize()))
+	pm.storeCollected(MetricDefinition{Name: "process_virtual_memory_bytes", Help: "Virtual memory size in bytes.", Type: GaugeMetric},
+		nil, vsize)
+	if bootTime, err := procBootTime(); err == nil {
+		pm.storeCollected(MetricDefinition{Name: "process_start_time_seconds", Help: "Start time of the process since unix epoch in seconds.", Type: GaugeMetric},
+			nil, bootTime+startTicks/procClockTicks)
+	}
+
+	if fds, err := os.ReadDir("/proc/self/fd"); err == nil {
+		pm.storeCollected(MetricDefinition{Name: "process_open_fds", Help: "Number of open file descriptors.", Type: GaugeMetric},
+			nil, float64(len(fds)))
+	}
+	if maxFds, err := procMaxFds(); err == nil {
+		pm.storeCollected(MetricDefinition{Name: "process_max_fds", Help: "Maximum number of open file descriptors.", Type: GaugeMetric},
+			nil, maxFds)
+	}
+	return nil
+}
+
+// procBootTime returns the system boot time from /proc/stat.
+func procBootTime() (float64, error) {
+	file, err := os.Open("/proc/stat")
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if value, ok := strings.CutPrefix(scanner.Text(), "btime "); ok {
+			return strconv.ParseFloat(strings.TrimSpace(value), 64)
+		}
+	}
+	return 0, fmt.Errorf("btime not found in /proc/stat")
+}
+
+// procMaxFds returns the soft limit of open files from /proc/self/limits.
+func procMaxFds() (float64, error) {
+	file, err := os.Open("/proc/self/limits")
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if value, ok := strings.CutPrefix(scanner.Text(), "Max open files"); ok {
+			fields := strings.Fields(value)
+			if len(fields) == 0 || fields[0] == "unlimited" {
+				return 0, fmt.Errorf("no open files limit")
+			}
+			return strconv.ParseFloat(fields[0], 64)
+		}
+	}
+	return 0, fmt.Errorf("open files limit not found")
+}
+
+// recordWrite counts an entry and its bytes written by a writer, when the internal collector is enabled.
+func recordWrite(writer string, bytes int) {
+	if !internalMetrics.Load() {
+		return
+	}
+	pm := GetPrometheusManager()
+	labels := map[string]string{"writer": writer}
+	for _, m := range []struct {
+		def   MetricDefinition
+		delta float64
+	}{
+		{MetricDefinition{Name: "logz_entries_written_total", Help: "Log entries written per writer."}, 1},
+		{MetricDefinition{Name: "logz_writer_bytes_total", Help: "Bytes written per writer."}, float64(bytes)},
+	} {
+		m.def.Type = CounterMetric
+		m.def.Volatile = true
+		if err := pm.DefineMetric(m.def); err == nil {
+			_ = pm.Inc(m.def.Name, labels, m.delta)
+		}
+	}
+}
+
+// recordNotification counts a notification by result and observes its latency, when the
+// internal collector is enabled.
+func recordNotification(notifier string, elapsed time.Duration, notifyErr error) {
+	if !internalMetrics.Load() {
+		return
+	}
+	pm := GetPrometheusManager()
+	result := "success"
+	if notifyErr != nil {
+		result = "failure"
+	}
+	if err := pm.DefineMetric(MetricDefinition{Name: "logz_notifications_total", Help: "Notifications sent per notifier and result.",
+		Type: CounterMetric, Volatile: true}); err == nil {
+		_ = pm.Inc("logz_notifications_total", map[string]string{"notifier": notifier, "result": result}, 1)
+	}
+	if err := pm.DefineMetric(MetricDefinition{Name: "logz_notification_duration_seconds", Help: "Notification latency per notifier.",
+		Type: HistogramMetric, Buckets: notificationBuckets, Volatile: true}); err == nil {
+		_ = pm.Observe("logz_notification_duration_seconds", map[string]string{"notifier": notifier}, elapsed.Seconds())
+	}
+}
@@ -1,6 +1,7 @@
 package logger
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"github.com/fsnotify/fsnotify"
@@ -10,6 +11,8 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -40,6 +43,12 @@ type Config interface {
 	SetFormat(LogFormat LogFormat)
 	GetInt(key string, value int) int
 	GetFormatter() LogFormatter
+	Plugins() map[string]PluginConfig
+	MetricRules() []*MetricRule
+	MetricsPush() *PushConfig
+	MetricsCollectors() CollectorsConfig
+	StatsD() *StatsDConfig
+	MetricsDiscovery() *DiscoveryConfig
 }
 
 // ConfigImpl implements the Config interface and holds the configuration values.
@@ -56,6 +65,15 @@ type ConfigImpl struct {
 	VlOutput          string
 	VlNotifierManager NotifierManager
 	VlMode            LogMode
+	VlPlugins         map[string]PluginConfig
+	VlMetricRules     *MetricRuleSet
+	VlMetricsPush     *PushConfig
+	VlCollectors      CollectorsConfig
+	VlStatsD          *StatsDConfig
+	VlDiscovery       *DiscoveryConfig
+
+	retired *atomic.Bool // Set once a reload replaced the configuration, to stop following the file
+	adopted *atomic.Bool // Set once a logger uses the configuration, and owns its notifiers
 }
 
 func (c *ConfigImpl) GetFormatter() LogFormatter {
@@ -66,6 +84,38 @@ func (c *ConfigImpl) GetFormatter() LogFormatter {
 		return &TextFormatter{}
 	}
 }
+
+// retire stops the configuration from following the changes of the file, once a reload replaced it.
+func (c *ConfigImpl) retire() {
+	if c.retired != nil {
+		c.retired.Store(true)
+	}
+}
+
+// adopt marks the configuration as used by a logger, which hands its notifiers over on reload.
+func (c *ConfigImpl) adopt() {
+	if c.adopted != nil {
+		c.adopted.Store(true)
+	}
+}
+
+// discard retires a configuration replaced before any logger used it, closing its notifiers.
+func (c *ConfigImpl) discard() {
+	if c.adopted == nil || c.adopted.Load() {
+		return
+	}
+	c.retire()
+	if nm, ok := c.VlNotifierManager.(*NotifierManagerImpl); ok {
+		nm.closeAll()
+	}
+}
+
+// MetricsCollectors returns the built-in collectors enabled in the configuration.
+func (c *ConfigImpl) MetricsCollectors() CollectorsConfig { return c.VlCollectors }
+
+// MetricsDiscovery returns the file_sd target file configuration, or nil when disabled.
+func (c *ConfigImpl) MetricsDiscovery() *DiscoveryConfig { return c.VlDiscovery }
+
 func (c *ConfigImpl) Port() string                     { return c.VlPort }
 func (c *ConfigImpl) BindAddress() string              { return c.VlBindAddress }
 func (c *ConfigImpl) Address() string                  { return c.VlAddress }
@@ -75,6 +125,10 @@ func (c *ConfigImpl) WriteTimeout() time.Duration      { return c.VlWriteTimeout
 func (c *ConfigImpl) IdleTimeout() time.Duration       { return c.VlIdleTimeout }
 func (c *ConfigImpl) NotifierManager() NotifierManager { return c.VlNotifierManager }
 func (c *ConfigImpl) Mode() LogMode                    { return c.VlMode }
+func (c *ConfigImpl) Plugins() map[string]PluginConfig { return c.VlPlugins }
+func (c *ConfigImpl) MetricRules() []*MetricRule       { return c.VlMetricRules.Rules() }
+func (c *ConfigImpl) MetricsPush() *PushConfig         { return c.VlMetricsPush }
+func (c *ConfigImpl) StatsD() *StatsDConfig            { return c.VlStatsD }
 func (c *ConfigImpl) Level() string                    { return strings.ToUpper(string(c.VlLevel)) }
 func (c *ConfigImpl) SetLevel(level LogLevel)          { c.VlLevel = level }
 func (c *ConfigImpl) Format() string                   { return strings.ToLower(string(c.VlFormat)) }
@@ -158,12 +212,6 @@ func (cm *ConfigManagerImpl) GetPidPath() string {
 
 // GetConfigPath returns the path to the configuration file.
 func (cm *ConfigManagerImpl) GetConfigPath() string {
-	if cm.config != nil {
-		if cm.config.Output() != "" && cm.config.Mode() == ModeService {
-			return cm.config.Output()
-		}
-	}
-
 	home, homeErr := os.UserHomeDir()
 	if homeErr != nil {
 		home, homeErr = os.UserConfigDir()
@@ -276,25 +324,62 @@ func (cm *ConfigManagerImpl) LoadConfig() (Config, error) {
 		return nil, fmt.Errorf("failed to ensure config exists: %w", err)
 	}
 
+	data, readErr := os.ReadFile(configPath)
+	if readErr != nil {
+		return nil, fmt.Errorf("failed to read config: %w", readErr)
+	}
 	viperObj := viper.New()
 	viperObj.SetConfigFile(configPath)
 	viperObj.SetConfigType(getConfigType(configPath))
-
-	if readErr := viperObj.ReadInConfig(); readErr != nil {
+	if readErr := viperObj.ReadConfig(bytes.NewReader(data)); readErr != nil {
 		return nil, fmt.Errorf("failed to read config: %w", readErr)
 	}
 
+	// The global viper backs GetInt and the service handlers, so it must see the file as well.
+	// Its settings are replaced rather than merged, so that keys removed from the file go away.
+	viper.SetConfigType(getConfigType(configPath))
+	if globalErr := viper.ReadConfig(bytes.NewReader(data)); globalErr != nil {
+		log.Printf("Error loading configuration into the global settings: %v\n", globalErr)
+	}
+
 	notifierManager := NewNotifierManager(nil)
 	if notifierManager == nil {
 		return nil, fmt.Errorf("failed to create notifier manager")
 	}
 
+	plugins, pluginErr := loadPlugins(viperObj)
+	if pluginErr != nil {
+		log.Printf("Invalid plugin configuration: %v\n", pluginErr)
+	}
+
+	metricsPush, pushErr := loadPushConfig(viperObj)
+	if pushErr != nil {
+		log.Printf("Invalid metrics push configuration: %v\n", pushErr)
+	}
+
+	statsd, statsdErr := loadStatsDConfig(viperObj)
+	if statsdErr != nil {
+		log.Printf("Invalid statsd configuration: %v\n", statsdErr)
+	}
+
+	discovery, discoveryErr := loadDiscoveryConfig(viperObj)
+	if discoveryErr != nil {
+		log.Printf("Invalid metrics discovery configuration: %v\n", discoveryErr)
+	}
+
+	var collectors CollectorsConfig
+	if collectorsErr := viperObj.UnmarshalKey("metricsCollectors", &collectors); collectorsErr != nil {
+		log.Printf("Invalid metrics collectors configuration: %v\n", collectorsErr)
+	}
+
 	mode := LogMode(viperObj.GetString("mode"))
 	if mode != ModeService && mode != ModeStandalone {
 		mode = defaultMode
 	}
 
 	config := ConfigImpl{
+		VlLevel:           LogLevel(strings.ToUpper(viperObj.GetString("logLevel"))),
+		VlFormat:          LogFormat(viperObj.GetString("format")),
 		VlPort:            getOrDefault(viperObj.GetString("port"), defaultPort),
 		VlBindAddress:     getOrDefault(viperObj.GetString("bindAddress"), defaultBindAddress),
 		VlAddress:         fmt.Sprintf("%s:%s", defaultBindAddress, defaultPort),
@@ -305,19 +390,88 @@ func (cm *ConfigManagerImpl) LoadConfig() (Config, error) {
 		VlOutput:          getOrDefault(viperObj.GetString("defaultLogPath"), defaultLogPath),
 		VlNotifierManager: notifierManager,
 		VlMode:            mode,
+		VlPlugins:         plugins,
+		VlMetricRules:     &MetricRuleSet{},
+		VlMetricsPush:     metricsPush,
+		VlCollectors:      collectors,
+		VlStatsD:          statsd,
+		VlDiscovery:       discovery,
+		retired:           &atomic.Bool{},
+		adopted:           &atomic.Bool{},
 	}
 
+	// A configuration loaded again before a logger used the previous one, as when NewConfigManager
+	// is followed by LoadConfig, replaces it: it stops following the file and its notifiers close
+	if previous, ok := cm.config.(interface{ discard() }); ok {
+		previous.discard()
+	}
 	cm.config = &config
 
-	viperObj.WatchConfig()
-	viperObj.OnConfigChange(func(e fsnotify.Event) {
-		log.Printf("Configuration changed: %s", e.Name)
-		// Update Config dynamically, if necessary
+	if ntfErr := notifierManager.UpdateFromConfig(viperObj); ntfErr != nil {
+		log.Printf("Invalid notifier configuration: %v\n", ntfErr)
+	}
+	if rulesErr := config.VlMetricRules.UpdateFromConfig(viperObj); rulesErr != nil {
+		log.Printf("Invalid metric rules: %v\n", rulesErr)
+	}
+
+	watchConfig(configPath, func(vpr *viper.Viper) {
+		if config.retired.Load() {
+			return
+		}
+		if ntfErr := notifierManager.UpdateFromConfig(vpr); ntfErr != nil {
+			log.Printf("Invalid notifier configuration: %v\n", ntfErr)
+		}
+		if rulesErr := config.VlMetricRules.UpdateFromConfig(vpr); rulesErr != nil {
+			log.Printf("Invalid metric rules: %v\n", rulesErr)
+		}
 	})
 
 	return cm.config, nil
 }
 
+// configWatcher follows a configuration file and passes its changes to the handler of the
+// current configuration.
+type configWatcher struct {
+	mu       sync.Mutex
+	onChange func(*viper.Viper)
+}
+
+// configWatchers holds a watcher per configuration file. Viper cannot stop watching a file, so a
+// watcher is started once per path and kept for the life of the process; reloads only replace
+// its handler.
+var (
+	configWatchers   = make(map[string]*configWatcher)
+	configWatchersMu sync.Mutex
+)
+
+// watchConfig makes fn the handler of the changes to the configuration file, following the file
+// on first use. fn receives a viper instance holding the file as it was re-read.
+func watchConfig(configPath string, fn func(*viper.Viper)) {
+	configWatchersMu.Lock()
+	defer configWatchersMu.Unlock()
+	w, ok := configWatchers[configPath]
+	if !ok {
+		w = &configWatcher{}
+		vpr := viper.New()
+		vpr.SetConfigFile(configPath)
+		vpr.SetConfigType(getConfigType(configPath))
+		vpr.OnConfigChange(func(e fsnotify.Event) {
+			w.mu.Lock()
+			handler := w.onChange
+			w.mu.Unlock()
+			if handler != nil {
+				log.Printf("Configuration changed: %s", e.Name)
+				handler(vpr)
+			}
+		})
+		vpr.WatchConfig()
+		configWatchers[configPath] = w
+	}
+	w.mu.Lock()
+	w.onChange = fn
+	w.mu.Unlock()
+}
+
 // NewConfigManager creates a new instance of ConfigManager.
 func NewConfigManager() *ConfigManager {
 	cfgMgr := &ConfigManagerImpl{}
@@ -0,0 +1,87 @@
+package logger
+
+import (
+	"github.com/spf13/viper"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestConfig writes the configuration file under a temporary HOME and returns its path.
+func writeTestConfig(t *testing.T, home, content string) string {
+	t.Helper()
+	path := filepath.Join(home, ".kubex", "logz", "config.json")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigReplacesGlobalSettings(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	cm := &ConfigManagerImpl{}
+
+	writeTestConfig(t, home, `{"logLevel": "info", "statsd": {"address": "127.0.0.1:8125"}, "maxLogSize": 10}`)
+	if _, err := cm.LoadConfig(); err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if !viper.IsSet("statsd") || viper.GetInt("maxLogSize") != 10 {
+		t.Fatalf("global settings not loaded: %v", viper.AllSettings())
+	}
+
+	writeTestConfig(t, home, `{"logLevel": "info"}`)
+	if _, err := cm.LoadConfig(); err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if viper.IsSet("statsd") || viper.IsSet("maxLogSize") {
+		t.Fatalf("removed keys still set: %v", viper.AllSettings())
+	}
+}
+
+func TestLoadConfigSharesTheFileWatcher(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	cm := &ConfigManagerImpl{}
+	path := writeTestConfig(t, home, `{"logLevel": "info"}`)
+
+	first, err := cm.LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	second, err := cm.LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	configWatchersMu.Lock()
+	watchers := 0
+	for watched := range configWatchers {
+		if watched == path {
+			watchers++
+		}
+	}
+	configWatchersMu.Unlock()
+	if watchers != 1 {
+		t.Fatalf("%d watchers for %s, want 1", watchers, path)
+	}
+
+	// A change reconciles the notifiers of the current configuration only
+	writeTestConfig(t, home, `{"logLevel": "info", "notifiers": {"script": {"type": "exec", "command": "/bin/true"}}}`)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, ok := second.NotifierManager().GetNotifier("script"); ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the change was not applied to the current configuration")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if _, ok := first.NotifierManager().GetNotifier("script"); ok {
+		t.Fatal("the change was applied to the discarded configuration")
+	}
+}
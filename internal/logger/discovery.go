@@ -0,0 +1,264 @@
+package logger
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/spf13/viper"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"syscall"
+)
+
+// Labels added to every target written by Logz, used to find the entries of dead instances.
+const (
+	discoveryHostLabel = "logz_host"
+	discoveryPidLabel  = "logz_pid"
+)
+
+// DiscoveryConfig configures the Prometheus file_sd target file maintained by the service.
+type DiscoveryConfig struct {
+	File    string            `json:"file,omitempty" mapstructure:"file"`       // Target file, see getDiscoveryFilePath for the default.
+	Address string            `json:"address,omitempty" mapstructure:"address"` // Host advertised when the exporter listens on all interfaces.
+	Labels  map[string]string `json:"labels,omitempty" mapstructure:"labels"`   // Extra labels attached to the target.
+}
+
+// TargetGroup is an entry of a Prometheus file_sd target file.
+type TargetGroup struct {
+	Targets []string          `json:"targets"`
+	Labels  map[string]string `json:"labels,omitempty"`
+}
+
+// TargetStatus tells whether the instance behind a target group is still running.
+type TargetStatus string
+
+const (
+	TargetAlive  TargetStatus = "alive"  // Local instance whose process is running.
+	TargetStale  TargetStatus = "stale"  // Local instance whose process is gone.
+	TargetRemote TargetStatus = "remote" // Instance of another host, not checked.
+)
+
+// loadDiscoveryConfig reads the "metricsDiscovery" section of the configuration, returning nil when absent or disabled.
+func loadDiscoveryConfig(vpr *viper.Viper) (*DiscoveryConfig, error) {
+	if !vpr.IsSet("metricsDiscovery") || (vpr.IsSet("metricsDiscovery.enabled") && !vpr.GetBool("metricsDiscovery.enabled")) {
+		return nil, nil
+	}
+	var cfg DiscoveryConfig
+	if err := vpr.UnmarshalKey("metricsDiscovery", &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse metrics discovery config: %w", err)
+	}
+	for name := range cfg.Labels {
+		if !labelNameRegex.MatchString(name) {
+			return nil, fmt.Errorf("invalid discovery label name '%s'", name)
+		}
+	}
+	if cfg.File == "" {
+		cfg.File = getDiscoveryFilePath()
+	}
+	return &cfg, nil
+}
+
+// getDiscoveryFilePath returns the default target file, using an environment variable if set,
+// or a default location next to the metrics file.
+func getDiscoveryFilePath() string {
+	if envPath := os.Getenv("LOGZ_DISCOVERY_FILE"); envPath != "" {
+		return envPath
+	}
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		cacheDir = "/tmp"
+	}
+	dir := filepath.Join(cacheDir, "kubex", "logz")
+	_ = os.MkdirAll(dir, 0755)
+	return filepath.Join(dir, "targets.json")
+}
+
+// DiscoveryFile returns the target file of the configuration, or the default one.
+func DiscoveryFile(cfg *DiscoveryConfig) string {
+	if cfg != nil && cfg.File != "" {
+		return cfg.File
+	}
+	return getDiscoveryFilePath()
+}
+
+// advertisedTarget turns the listener address into the address Prometheus should scrape,
+// replacing an unspecified host with the configured address or the hostname.
+func advertisedTarget(listenAddr string, cfg *DiscoveryConfig) (string, error) {
+	host, port, err := net.SplitHostPort(listenAddr)
+	if err != nil {
+		return "", err
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = cfg.Address
+		if host == "" {
+			if host, err = os.Hostname(); err != nil {
+				return "", err
+			}
+		}
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// RegisterTarget adds the target of this process to the target file, replacing any previous entry
+// for the same address, and removes the entries of local instances that are no longer running.
+func RegisterTarget(cfg *DiscoveryConfig, target string) error {
+	hostname, _ := os.Hostname()
+	labels := map[string]string{
+		discoveryHostLabel: hostname,
+		discoveryPidLabel:  strconv.Itoa(os.Getpid()),
+	}
+	for k, v := range cfg.Labels {
+		labels[k] = v
+	}
+	return updateTargets(DiscoveryFile(cfg), func(groups []TargetGroup) []TargetGroup {
+		groups = withoutTarget(pruneStale(groups), target)
+		return append(groups, TargetGroup{Targets: []string{target}, Labels: labels})
+	})
+}
+
+// DeregisterTarget removes the target from the target file.
+func DeregisterTarget(cfg *DiscoveryConfig, target string) error {
+	return updateTargets(DiscoveryFile(cfg), func(groups []TargetGroup) []TargetGroup {
+		return withoutTarget(groups, target)
+	})
+}
+
+// PruneTargets removes the entries of local instances that are no longer running and returns how many were removed.
+func PruneTargets(file string) (int, error) {
+	removed := 0
+	err := updateTargets(file, func(groups []TargetGroup) []TargetGroup {
+		pruned := pruneStale(groups)
+		removed = len(groups) - len(pruned)
+		return pruned
+	})
+	return removed, err
+}
+
+// ReadTargets reads the target file. A missing file has no targets.
+func ReadTargets(file string) ([]TargetGroup, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var groups []TargetGroup
+	if len(data) == 0 {
+		return nil, nil
+	}
+	if err := json.Unmarshal(data, &groups); err != nil {
+		return nil, fmt.Errorf("invalid target file %s: %w", file, err)
+	}
+	return groups, nil
+}
+
+// StatusOf reports whether the instance of a target group written by Logz is still running.
+func StatusOf(group TargetGroup) TargetStatus {
+	hostname, _ := os.Hostname()
+	if group.Labels[discoveryHostLabel] != hostname {
+		return TargetRemote
+	}
+	pid, err := strconv.Atoi(group.Labels[discoveryPidLabel])
+	if err != nil || pid <= 0 {
+		return TargetRemote
+	}
+	if err := syscall.Kill(pid, 0); err != nil && !errors.Is(err, syscall.EPERM) {
+		return TargetStale
+	}
+	return TargetAlive
+}
+
+// pruneStale drops the groups of local instances that are no longer running.
+func pruneStale(groups []TargetGroup) []TargetGroup {
+	kept := groups[:0:0]
+	for _, g := range groups {
+		if StatusOf(g) != TargetStale {
+			kept = append(kept, g)
+		}
+	}
+	return kept
+}
+
+// withoutTarget drops the target from the groups, and the groups left without targets.
+func withoutTarget(groups []TargetGroup, target string) []TargetGroup {
+	kept := groups[:0:0]
+	for _, g := range groups {
+		targets := g.Targets[:0:0]
+		for _, t := range g.Targets {
+			if t != target {
+				targets = append(targets, t)
+			}
+		}
+		if len(targets) > 0 {
+			g.Targets = targets
+			kept = append(kept, g)
+		}
+	}
+	return kept
+}
+
+// withoutEmptyGroups drops the groups without targets, which file_sd allows but which expose nothing.
+func withoutEmptyGroups(groups []TargetGroup) []TargetGroup {
+	kept := groups[:0:0]
+	for _, g := range groups {
+		if len(g.Targets) > 0 {
+			kept = append(kept, g)
+		}
+	}
+	return kept
+}
+
+// updateTargets applies update to the target file while holding its lock. The file is replaced
+// atomically, as Prometheus reloads it as soon as it changes.
+func updateTargets(file string, update func([]TargetGroup) []TargetGroup) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return fmt.Errorf("failed to create target file directory: %w", err)
+	}
+	lockFile, err := os.OpenFile(file+".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open target lock file: %w", err)
+	}
+	defer func() { _ = lockFile.Close() }()
+	if err := syscall.Flock(int(lockFile.Fd()), syscall.LOCK_EX); err != nil {
+		return fmt.Errorf("failed to lock target file: %w", err)
+	}
+	defer func() { _ = syscall.Flock(int(lockFile.Fd()), syscall.LOCK_UN) }()
+
+	groups, err := ReadTargets(file)
+	if err != nil {
+		return err
+	}
+	groups = withoutEmptyGroups(update(groups))
+	sort.SliceStable(groups, func(i, j int) bool { return groups[i].Targets[0] < groups[j].Targets[0] })
+	if groups == nil {
+		groups = []TargetGroup{}
+	}
+	data, err := json.MarshalIndent(groups, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary target file: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write targets: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close target file: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return fmt.Errorf("failed to set target file mode: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), file); err != nil {
+		return fmt.Errorf("failed to replace target file: %w", err)
+	}
+	return nil
+}
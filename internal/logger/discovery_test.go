@@ -0,0 +1,31 @@
+package logger
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPruneTargetsDropsEmptyGroups(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "targets.json")
+	content := `[{"targets": []}, {"targets": ["b:9100"]}, {"targets": ["a:9100"], "labels": {"env": "prod"}}]`
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := PruneTargets(file); err != nil {
+		t.Fatalf("PruneTargets: %v", err)
+	}
+	groups, err := ReadTargets(file)
+	if err != nil {
+		t.Fatalf("ReadTargets: %v", err)
+	}
+	want := []TargetGroup{
+		{Targets: []string{"a:9100"}, Labels: map[string]string{"env": "prod"}},
+		{Targets: []string{"b:9100"}},
+	}
+	if !reflect.DeepEqual(groups, want) {
+		t.Fatalf("groups = %+v, want %+v", groups, want)
+	}
+}
@@ -0,0 +1,187 @@
+package logger
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// maxIngestBodySize limits the decompressed size of an ingestion request.
+const maxIngestBodySize = 10 << 20
+
+// errIngestBodyTooLarge is returned when the (decompressed) body exceeds maxIngestBodySize.
+var errIngestBodyTooLarge = fmt.Errorf("request body exceeds %d bytes", maxIngestBodySize)
+
+// IngestError describes an entry rejected by the ingestion endpoint.
+type IngestError struct {
+	Index int    `json:"index"` // Position of the entry in the request, from 0.
+	Error string `json:"error"`
+}
+
+// IngestResult is the response of the ingestion endpoint.
+type IngestResult struct {
+	Accepted int           `json:"accepted"`
+	Rejected int           `json:"rejected"`
+	Errors   []IngestError `json:"errors,omitempty"`
+}
+
+// ingestHandler returns the handler of /<integration>/receive. It accepts a single LogEntry JSON
+// document, an array of them or NDJSON batches, optionally gzip-encoded, and passes every valid
+// entry through the service logger. Rejected entries are reported by index; the others are still ingested.
+func ingestHandler(integration string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeAdminError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+			return
+		}
+
+		body, err := readIngestBody(w, r)
+		if err != nil {
+			status := http.StatusBadRequest
+			var maxErr *http.MaxBytesError
+			switch {
+			case errors.As(err, &maxErr), errors.Is(err, errIngestBodyTooLarge):
+				status = http.StatusRequestEntityTooLarge
+			case errors.Is(err, errUnsupportedEncoding):
+				status = http.StatusUnsupportedMediaType
+			}
+			writeAdminError(w, status, err)
+			return
+		}
+
+		body = bytes.TrimSpace(body)
+		if len(body) == 0 {
+			writeAdminError(w, http.StatusBadRequest, errors.New("empty request body"))
+			return
+		}
+
+		principal, _ := PrincipalFromContext(r.Context())
+		entries, result := decodeIngestEntries(body)
+		for _, entry := range entries {
+			tagIngestedEntry(entry, integration, principal)
+			globalLogger.Ingest(entry)
+		}
+
+		status := http.StatusOK
+		if result.Accepted == 0 {
+			status = http.StatusBadRequest
+		}
+		writeAdminJSON(w, status, result)
+	}
+}
+
+// tagIngestedEntry tags a received entry with its integration, unless the sender set one, and
+// with the authenticated principal.
+func tagIngestedEntry(entry *LogEntry, integration string, principal *Principal) {
+	if entry.Tags == nil {
+		entry.Tags = make(map[string]string)
+	}
+	if _, ok := entry.Tags["integration"]; !ok {
+		entry.Tags["integration"] = integration
+	}
+	// The principal always comes from the credentials, never from the sender
+	delete(entry.Tags, "principal")
+	if principal != nil {
+		entry.Tags["principal"] = principal.Name
+	}
+}
+
+// errUnsupportedEncoding is returned for request bodies in an encoding other than gzip.
+var errUnsupportedEncoding = errors.New("unsupported content encoding: use gzip or none")
+
+// readIngestBody reads the request body, decompressing gzip-encoded bodies. Binary bodies are
+// returned as they are: callers parsing text trim it themselves.
+func readIngestBody(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	var reader io.Reader = http.MaxBytesReader(w, r.Body, maxIngestBodySize)
+	switch strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding"))) {
+	case "", "identity":
+	case "gzip", "x-gzip":
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip body: %w", err)
+		}
+		defer gz.Close()
+		reader = gz
+	default:
+		return nil, errUnsupportedEncoding
+	}
+
+	// Read one byte more than allowed to tell a full body from a truncated one
+	body, err := io.ReadAll(io.LimitReader(reader, maxIngestBodySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxIngestBodySize {
+		return nil, errIngestBodyTooLarge
+	}
+	if len(body) == 0 {
+		return nil, errors.New("empty request body")
+	}
+	return body, nil
+}
+
+// decodeIngestEntries parses the body as a JSON array of entries, a single JSON document, or
+// NDJSON when it is not valid JSON, and returns the valid entries.
+func decodeIngestEntries(body []byte) ([]*LogEntry, IngestResult) {
+	var docs [][]byte
+	var array []json.RawMessage
+	if body[0] == '[' && json.Unmarshal(body, &array) == nil {
+		for _, doc := range array {
+			docs = append(docs, doc)
+		}
+	} else if json.Valid(body) {
+		docs = [][]byte{body}
+	} else {
+		scanner := bufio.NewScanner(bytes.NewReader(body))
+		scanner.Buffer(make([]byte, 64*1024), maxIngestBodySize)
+		for scanner.Scan() {
+			if line := bytes.TrimSpace(scanner.Bytes()); len(line) > 0 {
+				docs = append(docs, append([]byte(nil), line...))
+			}
+		}
+	}
+
+	var entries []*LogEntry
+	result := IngestResult{}
+	for i, doc := range docs {
+		entry, err := decodeIngestEntry(doc)
+		if err != nil {
+			result.Rejected++
+			result.Errors = append(result.Errors, IngestError{Index: i, Error: err.Error()})
+			continue
+		}
+		result.Accepted++
+		entries = append(entries, entry)
+	}
+	return entries, result
+}
+
+// decodeIngestEntry parses and validates a single entry. The level is normalized and the
+// severity derived from it when the sender left it out.
+func decodeIngestEntry(doc []byte) (*LogEntry, error) {
+	var entry LogEntry
+	if err := json.Unmarshal(doc, &entry); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	if entry.Level != "" {
+		entry.Level = LogLevel(strings.ToUpper(string(entry.Level)))
+		severity, ok := logLevels[entry.Level]
+		if !ok {
+			return nil, fmt.Errorf("unknown level '%s'", entry.Level)
+		}
+		if entry.Severity == 0 {
+			entry.Severity = severity
+		}
+	}
+	if err := entry.Validate(); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
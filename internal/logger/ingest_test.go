@@ -0,0 +1,170 @@
+package logger
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// captureWriter is a LogWriter keeping the entries written to it.
+type captureWriter struct {
+	mu      sync.Mutex
+	entries []LogzEntry
+}
+
+func (w *captureWriter) Write(entry LogzEntry) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.entries = append(w.entries, entry)
+	return nil
+}
+
+func (w *captureWriter) messages() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var messages []string
+	for _, entry := range w.entries {
+		messages = append(messages, entry.GetMessage())
+	}
+	return messages
+}
+
+// useCaptureLogger replaces the service logger for the test with a standalone logger writing to
+// the returned writer.
+func useCaptureLogger(t *testing.T) *captureWriter {
+	t.Helper()
+	t.Setenv("LOGZ_METRICS_FILE", filepath.Join(t.TempDir(), "metrics.json"))
+	writer := &captureWriter{}
+	saved := globalLogger
+	globalLogger = &LogzCoreImpl{level: DEBUG, writer: writer, mode: ModeStandalone, inflight: &sync.WaitGroup{}}
+	t.Cleanup(func() { globalLogger = saved })
+	return writer
+}
+
+func gzipBody(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestIngestHandler(t *testing.T) {
+	const ts = `"timestamp":"2026-01-02T03:04:05Z"`
+	entry := func(level, msg string) string {
+		return `{` + ts + `,"level":"` + level + `","message":"` + msg + `"}`
+	}
+	ndjson := entry("INFO", "one") + "\n" + entry("error", "two") + "\n"
+
+	tests := []struct {
+		name     string
+		body     []byte
+		encoding string
+		status   int
+		accepted int
+		errors   []int // Indexes of the rejected entries
+		messages []string
+		errMsg   string
+	}{
+		{name: "single entry", body: []byte(entry("INFO", "one")), status: http.StatusOK, accepted: 1, messages: []string{"one"}},
+		{name: "array", body: []byte("[" + entry("INFO", "one") + "," + entry("WARN", "two") + "]"), status: http.StatusOK, accepted: 2, messages: []string{"one", "two"}},
+		{name: "ndjson", body: []byte(ndjson), status: http.StatusOK, accepted: 2, messages: []string{"one", "two"}},
+		{name: "gzip", body: gzipBody(t, []byte(ndjson)), encoding: "gzip", status: http.StatusOK, accepted: 2, messages: []string{"one", "two"}},
+		{
+			name:     "mixed valid and invalid",
+			body:     []byte(entry("INFO", "one") + "\n{not json\n" + entry("LOUD", "bad level") + "\n" + entry("WARN", "four") + "\n"),
+			status:   http.StatusOK,
+			accepted: 2,
+			errors:   []int{1, 2},
+			messages: []string{"one", "four"},
+		},
+		{name: "all invalid", body: []byte(entry("LOUD", "bad level")), status: http.StatusBadRequest, errors: []int{0}},
+		{name: "empty", body: []byte("  \n"), status: http.StatusBadRequest, errMsg: "empty request body"},
+		{name: "unsupported encoding", body: []byte(ndjson), encoding: "br", status: http.StatusUnsupportedMediaType, errMsg: "unsupported content encoding"},
+		{name: "invalid gzip", body: []byte(ndjson), encoding: "gzip", status: http.StatusBadRequest, errMsg: "invalid gzip body"},
+		{name: "too large", body: bytes.Repeat([]byte(" "), maxIngestBodySize+1), status: http.StatusRequestEntityTooLarge},
+		{
+			name:     "too large once decompressed",
+			body:     gzipBody(t, bytes.Repeat([]byte(" "), maxIngestBodySize+1)),
+			encoding: "gzip",
+			status:   http.StatusRequestEntityTooLarge,
+			errMsg:   "request body exceeds",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writer := useCaptureLogger(t)
+			req := httptest.NewRequest(http.MethodPost, "/app/receive", bytes.NewReader(tt.body))
+			if tt.encoding != "" {
+				req.Header.Set("Content-Encoding", tt.encoding)
+			}
+			rec := httptest.NewRecorder()
+			ingestHandler("app")(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if tt.errMsg != "" || tt.status == http.StatusRequestEntityTooLarge {
+				if !strings.Contains(rec.Body.String(), tt.errMsg) {
+					t.Fatalf("body = %s, want an error containing %q", rec.Body, tt.errMsg)
+				}
+				if len(writer.messages()) != 0 {
+					t.Fatalf("entries ingested from a rejected request: %q", writer.messages())
+				}
+				return
+			}
+
+			var result IngestResult
+			if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+				t.Fatalf("invalid response %s: %v", rec.Body, err)
+			}
+			if result.Accepted != tt.accepted || result.Rejected != len(tt.errors) {
+				t.Fatalf("result = %+v, want %d accepted and %d rejected", result, tt.accepted, len(tt.errors))
+			}
+			var indexes []int
+			for _, e := range result.Errors {
+				indexes = append(indexes, e.Index)
+			}
+			if !reflect.DeepEqual(indexes, tt.errors) {
+				t.Fatalf("rejected indexes = %v, want %v", indexes, tt.errors)
+			}
+			if got := writer.messages(); !reflect.DeepEqual(got, tt.messages) {
+				t.Fatalf("ingested %q, want %q", got, tt.messages)
+			}
+		})
+	}
+}
+
+func TestIngestHandlerTagsEntries(t *testing.T) {
+	writer := useCaptureLogger(t)
+	body := `{"timestamp":"2026-01-02T03:04:05Z","level":"error","message":"m","tags":{"principal":"forged"}}`
+	req := httptest.NewRequest(http.MethodPost, "/app/receive", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	ingestHandler("app")(rec, req)
+
+	if rec.Code != http.StatusOK || len(writer.entries) != 1 {
+		t.Fatalf("status = %d, %d entries ingested", rec.Code, len(writer.entries))
+	}
+	entry := writer.entries[0].(*LogEntry)
+	if entry.Level != ERROR || entry.Severity != logLevels[ERROR] {
+		t.Errorf("level = %s, severity = %d", entry.Level, entry.Severity)
+	}
+	if entry.Tags["integration"] != "app" {
+		t.Errorf("integration tag = %q", entry.Tags["integration"])
+	}
+	if principal, ok := entry.Tags["principal"]; ok {
+		t.Errorf("principal tag = %q kept from the sender", principal)
+	}
+}
@@ -0,0 +1,324 @@
+package logger
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/spf13/viper"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultUnixSocketMode = 0660
+	certCheckInterval     = time.Second // How often the certificate files are checked for changes
+)
+
+// TLSConfig configures HTTPS on the service ("tls" in the configuration).
+type TLSConfig struct {
+	CertFile     string `json:"certFile" mapstructure:"certFile"`
+	KeyFile      string `json:"keyFile" mapstructure:"keyFile"`
+	ClientCAFile string `json:"clientCAFile,omitempty" mapstructure:"clientCAFile"` // CA bundle verifying client certificates (mTLS).
+	ClientAuth   string `json:"clientAuth,omitempty" mapstructure:"clientAuth"`     // none, request, verify-if-given (default with a CA) or require.
+	MinVersion   string `json:"minVersion,omitempty" mapstructure:"minVersion"`     // 1.0 to 1.3, 1.2 by default.
+	Address      string `json:"address,omitempty" mapstructure:"address"`           // Serve TLS here in addition to plain TCP; by default the main address uses TLS.
+}
+
+// UnixSocketConfig configures the unix domain socket listener ("unixSocket" in the configuration).
+type UnixSocketConfig struct {
+	Path string `json:"path" mapstructure:"path"`
+	Mode string `json:"mode,omitempty" mapstructure:"mode"` // Octal file mode, 0660 by default.
+}
+
+// ListenersConfig selects the listeners of the service.
+type ListenersConfig struct {
+	TLS        *TLSConfig
+	UnixSocket *UnixSocketConfig
+	DisableTCP bool // Only serve on the unix socket (and the TLS address, if any).
+}
+
+// serviceListener is a listener of the service with a description for the logs.
+type serviceListener struct {
+	net.Listener
+	description string
+}
+
+// loadListenersConfig reads the "tls", "unixSocket" and "disableTCP" keys.
+func loadListenersConfig(vpr *viper.Viper) (*ListenersConfig, error) {
+	cfg := &ListenersConfig{DisableTCP: vpr.GetBool("disableTCP")}
+	if vpr.IsSet("tls") {
+		cfg.TLS = &TLSConfig{}
+		if err := vpr.UnmarshalKey("tls", cfg.TLS); err != nil {
+			return nil, fmt.Errorf("failed to parse tls config: %w", err)
+		}
+		if cfg.TLS.CertFile == "" || cfg.TLS.KeyFile == "" {
+			return nil, errors.New("tls: certFile and keyFile are required")
+		}
+		if _, err := parseTLSVersion(cfg.TLS.MinVersion); err != nil {
+			return nil, err
+		}
+		if _, err := parseClientAuth(cfg.TLS.ClientAuth, cfg.TLS.ClientCAFile != ""); err != nil {
+			return nil, err
+		}
+	}
+	if vpr.IsSet("unixSocket") {
+		cfg.UnixSocket = &UnixSocketConfig{}
+		if err := vpr.UnmarshalKey("unixSocket", cfg.UnixSocket); err != nil {
+			return nil, fmt.Errorf("failed to parse unixSocket config: %w", err)
+		}
+		if cfg.UnixSocket.Path == "" {
+			return nil, errors.New("unixSocket: path is required")
+		}
+		if _, err := parseFileMode(cfg.UnixSocket.Mode); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.DisableTCP && cfg.UnixSocket == nil && (cfg.TLS == nil || cfg.TLS.Address == "") {
+		return nil, errors.New("disableTCP requires a unixSocket or a tls.address")
+	}
+	return cfg, nil
+}
+
+// parseTLSVersion converts "1.0" to "1.3" to the tls constants, defaulting to TLS 1.2.
+func parseTLSVersion(version string) (uint16, error) {
+	switch version {
+	case "":
+		return tls.VersionTLS12, nil
+	case "1.0":
+		return tls.VersionTLS10, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("tls: unknown minVersion '%s': use 1.0, 1.1, 1.2 or 1.3", version)
+	}
+}
+
+// parseClientAuth converts the clientAuth option. Client certificates are verified, when given,
+// as soon as a client CA is configured.
+func parseClientAuth(mode string, hasCA bool) (tls.ClientAuthType, error) {
+	switch mode {
+	case "":
+		if hasCA {
+			return tls.VerifyClientCertIfGiven, nil
+		}
+		return tls.NoClientCert, nil
+	case "none":
+		return tls.NoClientCert, nil
+	case "request":
+		return tls.RequestClientCert, nil
+	case "verify-if-given":
+		if !hasCA {
+			return 0, errors.New("tls: clientAuth 'verify-if-given' requires a clientCAFile")
+		}
+		return tls.VerifyClientCertIfGiven, nil
+	case "require":
+		if !hasCA {
+			return 0, errors.New("tls: clientAuth 'require' requires a clientCAFile")
+		}
+		return tls.RequireAndVerifyClientCert, nil
+	default:
+		return 0, fmt.Errorf("tls: unknown clientAuth '%s': use none, request, verify-if-given or require", mode)
+	}
+}
+
+// parseFileMode parses an octal file mode such as "0660".
+func parseFileMode(mode string) (os.FileMode, error) {
+	if mode == "" {
+		return defaultUnixSocketMode, nil
+	}
+	m, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil || m > 0777 {
+		return 0, fmt.Errorf("unixSocket: invalid mode '%s'", mode)
+	}
+	return os.FileMode(m), nil
+}
+
+// certReloader serves the certificate and client CAs from disk, reloading them when the files
+// change so that renewed certificates are picked up without restarting the service.
+type certReloader struct {
+	cfg        TLSConfig
+	minVersion uint16
+	clientAuth tls.ClientAuthType
+
+	mu      sync.Mutex
+	config  *tls.Config
+	modTime map[string]time.Time
+	checked time.Time
+}
+
+// newCertReloader loads the certificate and client CAs.
+func newCertReloader(cfg TLSConfig) (*certReloader, error) {
+	minVersion, err := parseTLSVersion(cfg.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+	clientAuth, err := parseClientAuth(cfg.ClientAuth, cfg.ClientCAFile != "")
+	if err != nil {
+		return nil, err
+	}
+	c := &certReloader{cfg: cfg, minVersion: minVersion, clientAuth: clientAuth}
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// files returns the files the TLS configuration is built from.
+func (c *certReloader) files() []string {
+	files := []string{c.cfg.CertFile, c.cfg.KeyFile}
+	if c.cfg.ClientCAFile != "" {
+		files = append(files, c.cfg.ClientCAFile)
+	}
+	return files
+}
+
+// load builds the TLS configuration from the files. The caller must hold mu, except in the constructor.
+func (c *certReloader) load() error {
+	modTime := make(map[string]time.Time)
+	for _, file := range c.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			return fmt.Errorf("tls: %w", err)
+		}
+		modTime[file] = info.ModTime()
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.cfg.CertFile, c.cfg.KeyFile)
+	if err != nil {
+		return fmt.Errorf("tls: failed to load certificate: %w", err)
+	}
+	config := &tls.Config{
+		MinVersion:   c.minVersion,
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   c.clientAuth,
+		NextProtos:   []string{"http/1.1"},
+	}
+	if c.cfg.ClientCAFile != "" {
+		pem, err := os.ReadFile(c.cfg.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("tls: failed to read client CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("tls: no certificate found in %s", c.cfg.ClientCAFile)
+		}
+		config.ClientCAs = pool
+	}
+
+	c.config = config
+	c.modTime = modTime
+	return nil
+}
+
+// current returns the TLS configuration, reloading it first if a file changed. A failed reload
+// is logged and the previous configuration is kept.
+func (c *certReloader) current() *tls.Config {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if time.Since(c.checked) < certCheckInterval {
+		return c.config
+	}
+	c.checked = time.Now()
+	for _, file := range c.files() {
+		info, err := os.Stat(file)
+		if err != nil || !info.ModTime().Equal(c.modTime[file]) {
+			if err := c.load(); err != nil {
+				log.Printf("Error reloading TLS certificates, keeping the previous ones: %v", err)
+			} else {
+				log.Printf("TLS certificates reloaded")
+			}
+			break
+		}
+	}
+	return c.config
+}
+
+// tlsConfig returns a configuration resolving the certificate and client CAs on every handshake.
+func (c *certReloader) tlsConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: c.minVersion,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return c.current(), nil
+		},
+	}
+}
+
+// openListeners opens the TCP, TLS and unix socket listeners of the configuration. On error, the
+// listeners already opened are closed.
+func openListeners(address string, cfg *ListenersConfig) (listeners []serviceListener, err error) {
+	defer func() {
+		if err != nil {
+			for _, l := range listeners {
+				_ = l.Close()
+			}
+			listeners = nil
+		}
+	}()
+
+	var reloader *certReloader
+	if cfg.TLS != nil {
+		if reloader, err = newCertReloader(*cfg.TLS); err != nil {
+			return listeners, err
+		}
+	}
+
+	if !cfg.DisableTCP {
+		l, listenErr := net.Listen("tcp", address)
+		if listenErr != nil {
+			return listeners, fmt.Errorf("failed to listen on %s: %w", address, listenErr)
+		}
+		if reloader != nil && cfg.TLS.Address == "" {
+			listeners = append(listeners, serviceListener{tls.NewListener(l, reloader.tlsConfig()), "https://" + l.Addr().String()})
+		} else {
+			listeners = append(listeners, serviceListener{l, "http://" + l.Addr().String()})
+		}
+	}
+	if reloader != nil && cfg.TLS.Address != "" {
+		l, listenErr := net.Listen("tcp", cfg.TLS.Address)
+		if listenErr != nil {
+			return listeners, fmt.Errorf("failed to listen on %s: %w", cfg.TLS.Address, listenErr)
+		}
+		listeners = append(listeners, serviceListener{tls.NewListener(l, reloader.tlsConfig()), "https://" + l.Addr().String()})
+	}
+	if cfg.UnixSocket != nil {
+		l, listenErr := listenUnixSocket(*cfg.UnixSocket)
+		if listenErr != nil {
+			return listeners, listenErr
+		}
+		listeners = append(listeners, serviceListener{l, "unix:" + cfg.UnixSocket.Path})
+	}
+	return listeners, nil
+}
+
+// listenUnixSocket listens on the unix socket with the configured mode, replacing a socket left
+// behind by a crashed service.
+func listenUnixSocket(cfg UnixSocketConfig) (net.Listener, error) {
+	mode, err := parseFileMode(cfg.Mode)
+	if err != nil {
+		return nil, err
+	}
+	if conn, dialErr := net.DialTimeout("unix", cfg.Path, time.Second); dialErr == nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("unix socket %s is in use by another service", cfg.Path)
+	}
+	_ = os.Remove(cfg.Path)
+
+	l, err := net.Listen("unix", cfg.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on unix socket: %w", err)
+	}
+	if err := os.Chmod(cfg.Path, mode); err != nil {
+		_ = l.Close()
+		return nil, fmt.Errorf("failed to set unix socket mode: %w", err)
+	}
+	return l, nil
+}
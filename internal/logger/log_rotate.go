@@ -148,6 +148,12 @@ func addFileToTar(tw *tar.Writer, filePath string) error {
 
 // ArchiveLogs archives old logs into a zip file
 func ArchiveLogs(files []string) error {
+	_, err := archiveLogs(files)
+	return err
+}
+
+// archiveLogs archives the logs into a zip file in the temporary directory and returns its path.
+func archiveLogs(files []string) (string, error) {
 	logDir := GetLogPath()
 	if len(files) == 0 {
 		err := filepath.Walk(logDir, func(path string, info os.FileInfo, err error) error {
@@ -157,7 +163,7 @@ func ArchiveLogs(files []string) error {
 			return nil
 		})
 		if err != nil {
-			return fmt.Errorf("error listing the log files: %v", err)
+			return "", fmt.Errorf("error listing the log files: %v", err)
 		}
 	}
 	tempDir := os.TempDir()
@@ -166,7 +172,7 @@ func ArchiveLogs(files []string) error {
 
 	zipFile, err := os.Create(archivePath)
 	if err != nil {
-		return fmt.Errorf("error creating the zip file: %v", err)
+		return "", fmt.Errorf("error creating the zip file: %v", err)
 	}
 	defer zipFile.Close()
 
@@ -175,12 +181,12 @@ func ArchiveLogs(files []string) error {
 
 	for _, file := range files {
 		if err := addFileToZip(zipWriter, file); err != nil {
-			return err
+			return "", err
 		}
 	}
 
 	globalLogger.Info("Logs archived successfully", map[string]interface{}{"archive": archivePath})
-	return nil
+	return archivePath, nil
 }
 
 // addFileToZip adds a file to the zip archive
@@ -1,11 +1,15 @@
 package logger
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 )
 
 type LogMode string
@@ -39,6 +43,14 @@ type LogzCoreImpl struct {
 	config   Config
 	metadata map[string]interface{}
 	mode     LogMode // Mode control: service or standalone
+
+	mu         sync.RWMutex    // Guards level, writer, config, mode, file, inflight and the DEBUG toggle
+	file       *os.File        // Output file opened for the configuration, closed on reload
+	inflight   *sync.WaitGroup // Entries being dispatched with the current writer and notifiers
+	debug      bool            // DEBUG toggled on by ToggleDebug
+	savedLevel LogLevel        // Level to restore when the DEBUG toggle is switched off
+
+	sourceLevels map[string]LogLevel // Levels overriding the logger level for entries of a source
 }
 
 // NewLogger creates a new instance of LogzCoreImpl with the provided configuration.
@@ -46,8 +58,49 @@ func NewLogger(config Config) *LogzCoreImpl {
 	// Set the log level from the Config
 	level := LogLevel(config.Level()) // Method config.Level() returns the log level as a string
 
+	writer, file := newWriter(config)
+	if adopting, ok := config.(interface{ adopt() }); ok {
+		adopting.adopt()
+	}
+
+	// Read the mode from Config
+	mode := config.Mode()
+	if mode != ModeService && mode != ModeStandalone {
+		mode = ModeStandalone // Default to standalone if not specified
+	}
+
+	// Push metrics for processes that are too short-lived to be scraped
+	if push := config.MetricsPush(); push != nil {
+		if pm := GetPrometheusManager(); !pm.IsPushing() {
+			if err := pm.StartPush(*push); err != nil {
+				log.Printf("Error starting metrics push: %v\n", err)
+			}
+		}
+	}
+
+	// Mirror the metrics to a StatsD agent
+	if statsd := config.StatsD(); statsd != nil && GetStatsDEmitter() == nil {
+		if err := StartStatsD(*statsd); err != nil {
+			log.Printf("Error starting StatsD emitter: %v\n", err)
+		}
+	}
+
+	return &LogzCoreImpl{
+		level:    level,
+		writer:   writer,
+		config:   config,
+		metadata: make(map[string]interface{}),
+		mode:     mode,
+		file:     file,
+		inflight: &sync.WaitGroup{},
+	}
+}
+
+// newWriter builds the writer of the configuration: the output file or stdout with the configured
+// formatter, or a writer plugin. It also returns the output file it opened, if any.
+func newWriter(config Config) (LogWriter, *os.File) {
 	var out *os.File
-	if strings.ToLower(config.Output()) == "stdout" || config.Output() == "" || config.Output() == os.Stdout.Name() {
+	if strings.ToLower(config.Output()) == "stdout" || config.Output() == "" || config.Output() == os.Stdout.Name() || strings.HasPrefix(config.Output(), "plugin:") {
 		out = os.Stdout
 	} else {
 		fmt.Println("Output: ", config.Output())
@@ -79,36 +132,140 @@ func NewLogger(config Config) *LogzCoreImpl {
 	} else {
 		formatter = &TextFormatter{}
 	}
-	writer := NewDefaultWriter(out, formatter)
+	var writer LogWriter = NewDefaultWriter(out, formatter)
 
-	// Read the mode from Config
+	// Outputs in the form "plugin:<name>" are delivered to a writer plugin
+	if name, ok := strings.CutPrefix(config.Output(), "plugin:"); ok {
+		if plugin, exists := config.Plugins()[name]; exists {
+			writer = NewPluginWriter(name, plugin, nil)
+		} else {
+			log.Printf("Writer plugin '%s' is not configured\nRedirecting to stdout...\n", name)
+		}
+	}
+
+	if out == os.Stdout {
+		return writer, nil
+	}
+	return writer, out
+}
+
+// Reload switches the logger to a new configuration. The writer and its formatter are rebuilt,
+// which reopens the output file after an external rotation, and the level, mode and notifiers are
+// taken from the configuration. Entries being dispatched finish with the previous writer and
+// notifiers, which are closed afterwards; notifiers added through AddNotifier are kept.
+func (l *LogzCoreImpl) Reload(config Config) {
+	writer, file := newWriter(config)
+	if adopting, ok := config.(interface{ adopt() }); ok {
+		adopting.adopt()
+	}
 	mode := config.Mode()
 	if mode != ModeService && mode != ModeStandalone {
-		mode = ModeStandalone // Default to standalone if not specified
+		mode = ModeStandalone
 	}
 
-	return &LogzCoreImpl{
-		level:    level,
-		writer:   writer,
-		config:   config,
-		metadata: make(map[string]interface{}),
-		mode:     mode,
+	l.mu.Lock()
+	oldWriter, oldFile, oldConfig, inflight := l.writer, l.file, l.config, l.inflight
+	l.writer, l.file, l.config, l.mode = writer, file, config, mode
+	l.level, l.debug = LogLevel(config.Level()), false
+	l.inflight = &sync.WaitGroup{}
+	l.mu.Unlock()
+
+	closeWriter(oldWriter, oldFile, inflight)
+	if oldConfig != nil && oldConfig != config {
+		if retiring, ok := oldConfig.(interface{ retire() }); ok {
+			retiring.retire()
+		}
+		if nm, ok := oldConfig.NotifierManager().(*NotifierManagerImpl); ok {
+			nm.handOver(config.NotifierManager())
+		}
 	}
 }
 
+// Reopen rebuilds the writer of the current configuration, reopening the output file. Entries
+// being written finish with the previous writer.
+func (l *LogzCoreImpl) Reopen() {
+	writer, file := newWriter(l.GetConfig())
+
+	l.mu.Lock()
+	oldWriter, oldFile, inflight := l.writer, l.file, l.inflight
+	l.writer, l.file = writer, file
+	l.inflight = &sync.WaitGroup{}
+	l.mu.Unlock()
+
+	closeWriter(oldWriter, oldFile, inflight)
+}
+
+// closeWriter waits for the entries dispatched with a replaced writer, then closes it.
+func closeWriter(writer LogWriter, file *os.File, inflight *sync.WaitGroup) {
+	inflight.Wait()
+	if closer, ok := writer.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			log.Printf("Error closing the previous writer: %v", err)
+		}
+	}
+	if file != nil {
+		_ = file.Close()
+	}
+}
+
+// ToggleDebug switches the logger to DEBUG, or back to the level it had before, and returns the
+// new level. Reloading the configuration switches it off.
+func (l *LogzCoreImpl) ToggleDebug() LogLevel {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.debug {
+		l.level, l.debug = l.savedLevel, false
+	} else {
+		l.level, l.savedLevel, l.debug = DEBUG, l.level, true
+	}
+	return l.level
+}
+
 // SetMetadata sets a metadata key-value pair for the LogzCoreImpl.
 func (l *LogzCoreImpl) SetMetadata(key string, value interface{}) {
 	l.metadata[key] = value
 }
 
-// shouldLog checks if the log level should be logged.
-func (l *LogzCoreImpl) shouldLog(level LogLevel) bool {
+// shouldLog checks if the log level should be logged for the source, whose own level, if set,
+// takes precedence over the logger level.
+func (l *LogzCoreImpl) shouldLog(level LogLevel, source string) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if sourceLevel, ok := l.sourceLevels[source]; ok && source != "" {
+		return logLevels[level] >= logLevels[sourceLevel]
+	}
 	return logLevels[level] >= logLevels[l.level]
 }
 
+// SetSourceLevel sets the level of the entries of a source, overriding the logger level. An empty
+// level removes the override. Source levels are kept when the configuration is reloaded.
+func (l *LogzCoreImpl) SetSourceLevel(source string, level LogLevel) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if level == "" {
+		delete(l.sourceLevels, source)
+		return
+	}
+	if l.sourceLevels == nil {
+		l.sourceLevels = make(map[string]LogLevel)
+	}
+	l.sourceLevels[source] = level
+}
+
+// SourceLevels returns the levels set per source.
+func (l *LogzCoreImpl) SourceLevels() map[string]LogLevel {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	levels := make(map[string]LogLevel, len(l.sourceLevels))
+	for source, level := range l.sourceLevels {
+		levels[source] = level
+	}
+	return levels
+}
+
 // log logs a message with the specified level and context.
 func (l *LogzCoreImpl) log(level LogLevel, msg string, ctx map[string]interface{}) {
-	if !l.shouldLog(level) {
+	if !l.shouldLog(level, "") {
 		return
 	}
 
@@ -129,18 +286,67 @@ func (l *LogzCoreImpl) log(level LogLevel, msg string, ctx map[string]interface{
 		entry.AddMetadata(k, v)
 	}
 
+	pm := l.dispatch(entry)
+
+	// Terminate the process in case of FATAL log, pushing the metrics a last time
+	if level == FATAL {
+		if err := pm.StopPush(); err != nil {
+			log.Printf("Error pushing metrics: %v", err)
+		}
+		if err := StopStatsD(); err != nil {
+			log.Printf("Error flushing StatsD metrics: %v", err)
+		}
+		os.Exit(1)
+	}
+}
+
+// Ingest passes an entry created elsewhere, such as one received by the service, through the
+// writer, notifiers and metrics, keeping its level, timestamp, source and metadata. Entries below
+// the level of their source, or the logger level, are dropped. Unlike FatalC, a FATAL entry does not terminate the process.
+func (l *LogzCoreImpl) Ingest(entry LogzEntry) {
+	if !l.shouldLog(entry.GetLevel(), entry.GetSource()) {
+		return
+	}
+	l.dispatch(entry)
+}
+
+// dispatch writes the entry, notifies the notifiers and updates the metrics.
+func (l *LogzCoreImpl) dispatch(entry LogzEntry) *PrometheusManager {
+	level := entry.GetLevel()
+
+	// Hold on to the current writer and configuration until the entry is done, so that a reload
+	// does not close them under it
+	l.mu.RLock()
+	writer, config, mode, inflight := l.writer, l.config, l.mode, l.inflight
+	inflight.Add(1)
+	l.mu.RUnlock()
+	defer inflight.Done()
+
 	// Write the log using the configured writer
-	if err := l.writer.Write(entry); err != nil {
+	if err := writer.Write(entry); err != nil {
 		log.Printf("Error writing log: %v", err)
 	}
 
-	// Only in service mode, notify via Notifiers
-	if l.mode == ModeService && l.config != nil {
-		for _, name := range l.config.NotifierManager().ListNotifiers() {
-			if notifier, ok := l.config.NotifierManager().GetNotifier(name); ok {
+	// Only in service mode, stream the entry and notify via Notifiers
+	if mode == ModeService {
+		logStreams.publish(entry)
+	}
+	if mode == ModeService && config != nil {
+		silences := GetSilenceStore()
+		for _, name := range config.NotifierManager().ListNotifiers() {
+			if silences.Silenced(name, entry) {
+				continue
+			}
+			if notifier, ok := config.NotifierManager().GetNotifier(name); ok {
 				if notifier != nil {
 					ntf := notifier
-					if ntfErr := ntf.Notify(entry); ntfErr != nil {
+					if filter, ok := ntf.(entryFilter); ok && !filter.accepts(entry) {
+						continue
+					}
+					started := time.Now()
+					ntfErr := ntf.Notify(entry)
+					recordNotification(name, time.Since(started), ntfErr)
+					if ntfErr != nil {
 						log.Printf("Error notifying %s: %v", name, ntfErr)
 					}
 				}
@@ -148,19 +354,22 @@ func (l *LogzCoreImpl) log(level LogLevel, msg string, ctx map[string]interface{
 		}
 	}
 
-	// Update metrics in PrometheusManager, if enabled
-	if l.mode == ModeService {
-		pm := GetPrometheusManager()
-		if pm.IsEnabled() {
-			pm.IncrementMetric("logs_total", 1)
-			pm.IncrementMetric("logs_total_"+string(level), 1)
+	// Update metrics in PrometheusManager, if exposed, pushed or sent to StatsD
+	pm := GetPrometheusManager()
+	if (mode == ModeService && pm.IsEnabled()) || pm.IsPushing() || GetStatsDEmitter() != nil {
+		exemplar := traceExemplar(cloneEntry(entry))
+		for _, name := range []string{"logs_total", "logs_total_" + string(level)} {
+			if err := pm.IncWithExemplar(name, nil, 1, exemplar); err != nil {
+				log.Printf("Error incrementing metric: %v", err)
+			}
+		}
+		if config != nil {
+			if ruleErr := ApplyMetricRules(pm, config.MetricRules(), entry); ruleErr != nil {
+				log.Printf("Error applying metric rules: %v", ruleErr)
+			}
 		}
 	}
-
-	// Terminate the process in case of FATAL log
-	if level == FATAL {
-		os.Exit(1)
-	}
+	return pm
 }
 
 // Debug logs a debug message with context.
@@ -178,16 +387,66 @@ func (l *LogzCoreImpl) Error(msg string, ctx map[string]interface{}) { l.log(ERR
 // FatalC logs a fatal message with context and terminates the process.
 func (l *LogzCoreImpl) FatalC(msg string, ctx map[string]interface{}) { l.log(FATAL, msg, ctx) }
 
-func (l *LogzCoreImpl) SetLevel(level LogLevel) { l.level = level }
-func (l *LogzCoreImpl) GetLevel() LogLevel      { return l.level }
+func (l *LogzCoreImpl) SetLevel(level LogLevel) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.level, l.debug = level, false
+}
+func (l *LogzCoreImpl) GetLevel() LogLevel {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.level
+}
+
+func (l *LogzCoreImpl) SetWriter(writer LogWriter) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.writer = writer
+}
+func (l *LogzCoreImpl) GetWriter() LogWriter {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.writer
+}
+
+func (l *LogzCoreImpl) GetMode() LogMode {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.mode
+}
 
-func (l *LogzCoreImpl) SetWriter(writer LogWriter) { l.writer = writer }
-func (l *LogzCoreImpl) GetWriter() LogWriter       { return l.writer }
+func (l *LogzCoreImpl) SetConfig(config Config) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.config = config
+}
+func (l *LogzCoreImpl) GetConfig() Config {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.config
+}
 
-func (l *LogzCoreImpl) GetMode() LogMode { return l.mode }
+// outputFile returns the path and format of the file the logger writes to, read together so that
+// they belong to the same configuration. The path is "" when the logger does not write to a file.
+func (l *LogzCoreImpl) outputFile() (path, format string) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.file == nil || l.config == nil {
+		return "", ""
+	}
+	return l.config.Output(), l.config.Format()
+}
 
-func (l *LogzCoreImpl) SetConfig(config Config) { l.config = config }
-func (l *LogzCoreImpl) GetConfig() Config       { return l.config }
+// Close stops the metrics push mode and the StatsD emitter, sending the metrics a last time,
+// saves the metrics to disk and closes the writer if it can be closed. Short-lived processes should call it before exiting.
+func (l *LogzCoreImpl) Close() error {
+	pm := GetPrometheusManager()
+	err := errors.Join(pm.StopPush(), StopStatsD(), pm.Flush())
+	if closer, ok := l.GetWriter().(io.Closer); ok {
+		err = errors.Join(err, closer.Close())
+	}
+	return err
+}
 
 // trimFilePath trims the file path to show only the last two segments.
 func trimFilePath(filePath string) string {
@@ -0,0 +1,448 @@
+package logger
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// MetricType is the Prometheus type of a metric family.
+type MetricType string
+
+const (
+	CounterMetric   MetricType = "counter"
+	GaugeMetric     MetricType = "gauge"
+	HistogramMetric MetricType = "histogram"
+	SummaryMetric   MetricType = "summary"
+)
+
+// ExpositionFormat is a text format the metrics can be exposed in.
+type ExpositionFormat string
+
+const (
+	FormatPrometheusText ExpositionFormat = "prometheus"
+	FormatOpenMetrics    ExpositionFormat = "openmetrics"
+
+	// ContentTypePrometheusText and ContentTypeOpenMetrics are the content types of the formats.
+	ContentTypePrometheusText = "text/plain; version=0.0.4; charset=utf-8"
+	ContentTypeOpenMetrics    = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+)
+
+// exemplarMaxRunes is the OpenMetrics limit on the combined length of exemplar label names and values.
+const exemplarMaxRunes = 128
+
+// summaryMaxSamples bounds the number of observations kept per summary series to compute quantiles.
+const summaryMaxSamples = 1024
+
+var (
+	// DefaultBuckets are the default histogram buckets, matching the Prometheus client libraries.
+	DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+	// DefaultQuantiles are the default summary quantiles.
+	DefaultQuantiles = []float64{.5, .9, .99}
+
+	labelNameRegex = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+// ParseMetricType converts a string to a MetricType, returning an error for unknown types.
+func ParseMetricType(s string) (MetricType, error) {
+	switch MetricType(strings.ToLower(s)) {
+	case CounterMetric:
+		return CounterMetric, nil
+	case "", GaugeMetric:
+		return GaugeMetric, nil
+	case HistogramMetric:
+		return HistogramMetric, nil
+	case SummaryMetric:
+		return SummaryMetric, nil
+	}
+	return "", fmt.Errorf("unknown metric type '%s': use counter, gauge, histogram or summary", s)
+}
+
+// validateLabels checks label names against the Prometheus naming rules and the reserved names of the type.
+func validateLabels(typ MetricType, labels map[string]string) error {
+	for name := range labels {
+		if !labelNameRegex.MatchString(name) || strings.HasPrefix(name, "__") {
+			return fmt.Errorf("invalid label name '%s': must match [a-zA-Z_][a-zA-Z0-9_]* and not start with __", name)
+		}
+		if (typ == HistogramMetric && name == "le") || (typ == SummaryMetric && name == "quantile") {
+			return fmt.Errorf("label name '%s' is reserved for %s metrics", name, typ)
+		}
+	}
+	return nil
+}
+
+// Exemplar links a sample to an external reference, such as the trace of the log entry that produced it.
+type Exemplar struct {
+	Labels    map[string]string `json:"labels"`
+	Value     float64           `json:"value"`
+	Timestamp time.Time         `json:"timestamp"`
+}
+
+// newExemplar builds an exemplar, returning nil when the labels are empty or exceed the OpenMetrics limit.
+func newExemplar(labels map[string]string, value float64) *Exemplar {
+	if len(labels) == 0 {
+		return nil
+	}
+	runes := 0
+	for name, v := range labels {
+		if !labelNameRegex.MatchString(name) {
+			return nil
+		}
+		runes += len([]rune(name)) + len([]rune(v))
+	}
+	if runes > exemplarMaxRunes {
+		return nil
+	}
+	return &Exemplar{Labels: copyLabels(labels), Value: value, Timestamp: time.Now()}
+}
+
+// SeriesSnapshot is a point-in-time copy of a labelled time series, used for persistence.
+type SeriesSnapshot struct {
+	Labels  map[string]string `json:"labels,omitempty"`
+	Value   float64           `json:"value,omitempty"`   // Counter and gauge value.
+	Buckets []uint64          `json:"buckets,omitempty"` // Histogram counts per bucket (non-cumulative).
+	Samples []float64         `json:"samples,omitempty"` // Recent summary observations.
+	Sum     float64           `json:"sum,omitempty"`     // Histogram and summary sum.
+	Count   uint64            `json:"count,omitempty"`   // Histogram and summary count.
+	// Exemplar is the latest exemplar of a counter.
+	Exemplar *Exemplar `json:"exemplar,omitempty"`
+}
+
+// metricSeries is a single labelled time series of a metric family.
+// Counter and gauge values are updated atomically; histogram and summary state and the exemplar
+// are guarded by mu.
+type metricSeries struct {
+	labels   map[string]string
+	value    atomic.Uint64 // float64 bits
+	mu       sync.Mutex
+	buckets  []uint64
+	samples  []float64
+	sum      float64
+	count    uint64
+	exemplar *Exemplar
+}
+
+// add atomically adds delta to the series value.
+func (s *metricSeries) add(delta float64) {
+	for {
+		old := s.value.Load()
+		if s.value.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+delta)) {
+			return
+		}
+	}
+}
+
+// set atomically stores the series value.
+func (s *metricSeries) set(v float64) { s.value.Store(math.Float64bits(v)) }
+
+// get atomically loads the series value.
+func (s *metricSeries) get() float64 { return math.Float64frombits(s.value.Load()) }
+
+// setExemplar replaces the exemplar of the series.
+func (s *metricSeries) setExemplar(e *Exemplar) {
+	s.mu.Lock()
+	s.exemplar = e
+	s.mu.Unlock()
+}
+
+// snapshot returns a consistent copy of the series.
+func (s *metricSeries) snapshot() SeriesSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return SeriesSnapshot{
+		Labels:   s.labels,
+		Value:    s.get(),
+		Buckets:  append([]uint64(nil), s.buckets...),
+		Samples:  append([]float64(nil), s.samples...),
+		Sum:      s.sum,
+		Count:    s.count,
+		Exemplar: s.exemplar,
+	}
+}
+
+// MetricFamily groups the series sharing a name, help text and type.
+// The Series map is guarded by the owning PrometheusManager.
+type MetricFamily struct {
+	Name      string
+	Help      string
+	Type      MetricType
+	Buckets   []float64 // Histogram upper bounds.
+	Quantiles []float64 // Summary quantiles.
+	Volatile  bool      // Not persisted.
+	Series    map[string]*metricSeries
+}
+
+// newMetricFamily creates an empty family, applying the default buckets and quantiles.
+func newMetricFamily(name, help string, typ MetricType, buckets, quantiles []float64) *MetricFamily {
+	f := &MetricFamily{
+		Name:   name,
+		Help:   help,
+		Type:   typ,
+		Series: make(map[string]*metricSeries),
+	}
+	switch typ {
+	case HistogramMetric:
+		if len(buckets) == 0 {
+			buckets = DefaultBuckets
+		}
+		f.Buckets = append([]float64{}, buckets...)
+		sort.Float64s(f.Buckets)
+	case SummaryMetric:
+		if len(quantiles) == 0 {
+			quantiles = DefaultQuantiles
+		}
+		f.Quantiles = append([]float64{}, quantiles...)
+		sort.Float64s(f.Quantiles)
+	}
+	return f
+}
+
+// newSeries creates an empty series for the family. It is not added to the family.
+func (f *MetricFamily) newSeries(labels map[string]string) *metricSeries {
+	s := &metricSeries{labels: copyLabels(labels)}
+	if f.Type == HistogramMetric {
+		s.buckets = make([]uint64, len(f.Buckets))
+	}
+	return s
+}
+
+// restore adds a series from a persisted snapshot.
+func (f *MetricFamily) restore(snap SeriesSnapshot) {
+	s := f.newSeries(snap.Labels)
+	s.set(snap.Value)
+	if f.Type == HistogramMetric && len(snap.Buckets) == len(f.Buckets) {
+		s.buckets = snap.Buckets
+	}
+	s.samples = snap.Samples
+	s.sum = snap.Sum
+	s.count = snap.Count
+	s.exemplar = snap.Exemplar
+	f.Series[labelsKey(snap.Labels)] = s
+}
+
+// observe records a value in a histogram or summary series.
+func (f *MetricFamily) observe(s *metricSeries, value float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sum += value
+	s.count++
+	switch f.Type {
+	case HistogramMetric:
+		for i, bound := range f.Buckets {
+			if value <= bound {
+				s.buckets[i]++
+				break
+			}
+		}
+	case SummaryMetric:
+		s.samples = append(s.samples, value)
+		if len(s.samples) > summaryMaxSamples {
+			s.samples = s.samples[len(s.samples)-summaryMaxSamples:]
+		}
+	}
+}
+
+// write renders the family in the Prometheus text or OpenMetrics exposition format.
+// In OpenMetrics, counter samples carry the _total suffix and their exemplar.
+func (f *MetricFamily) write(w *bufio.Writer, format ExpositionFormat) {
+	if len(f.Series) == 0 {
+		return
+	}
+	help := f.Help
+	if help == "" {
+		help = "Custom metric from Logz"
+	}
+	openMetrics := format == FormatOpenMetrics
+	familyName := f.Name
+	if openMetrics {
+		help = strings.ReplaceAll(escapeHelp(help), `"`, `\"`)
+		if f.Type == CounterMetric {
+			familyName = strings.TrimSuffix(f.Name, "_total")
+		}
+	} else {
+		help = escapeHelp(help)
+	}
+	fmt.Fprintf(w, "# HELP %s %s\n", familyName, help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", familyName, f.Type)
+
+	keys := make([]string, 0, len(f.Series))
+	for k := range f.Series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		s := f.Series[k].snapshot()
+		switch f.Type {
+		case HistogramMetric:
+			var cumulative uint64
+			for i, bound := range f.Buckets {
+				cumulative += s.Buckets[i]
+				fmt.Fprintf(w, "%s_bucket%s %d\n", f.Name, formatLabels(s.Labels, "le", formatFloat(bound)), cumulative)
+			}
+			fmt.Fprintf(w, "%s_bucket%s %d\n", f.Name, formatLabels(s.Labels, "le", "+Inf"), s.Count)
+			fmt.Fprintf(w, "%s_sum%s %s\n", f.Name, formatLabels(s.Labels, "", ""), formatFloat(s.Sum))
+			fmt.Fprintf(w, "%s_count%s %d\n", f.Name, formatLabels(s.Labels, "", ""), s.Count)
+		case SummaryMetric:
+			sorted := s.Samples
+			sort.Float64s(sorted)
+			for _, q := range f.Quantiles {
+				fmt.Fprintf(w, "%s%s %s\n", f.Name, formatLabels(s.Labels, "quantile", formatFloat(q)), formatFloat(quantile(sorted, q)))
+			}
+			fmt.Fprintf(w, "%s_sum%s %s\n", f.Name, formatLabels(s.Labels, "", ""), formatFloat(s.Sum))
+			fmt.Fprintf(w, "%s_count%s %d\n", f.Name, formatLabels(s.Labels, "", ""), s.Count)
+		case CounterMetric:
+			if !openMetrics {
+				fmt.Fprintf(w, "%s%s %s\n", f.Name, formatLabels(s.Labels, "", ""), formatFloat(s.Value))
+				continue
+			}
+			fmt.Fprintf(w, "%s_total%s %s", familyName, formatLabels(s.Labels, "", ""), formatFloat(s.Value))
+			if e := s.Exemplar; e != nil {
+				fmt.Fprintf(w, " # %s %s %s", formatLabels(e.Labels, "", ""), formatFloat(e.Value),
+					strconv.FormatFloat(float64(e.Timestamp.UnixMilli())/1000, 'f', 3, 64))
+			}
+			w.WriteByte('\n')
+		default:
+			fmt.Fprintf(w, "%s%s %s\n", f.Name, formatLabels(s.Labels, "", ""), formatFloat(s.Value))
+		}
+	}
+}
+
+// writeFamilies renders the given families sorted by name.
+func writeFamilies(out io.Writer, families []*MetricFamily, format ExpositionFormat) error {
+	sort.Slice(families, func(i, j int) bool { return families[i].Name < families[j].Name })
+	w := bufio.NewWriter(out)
+	for _, f := range families {
+		f.write(w, format)
+	}
+	if format == FormatOpenMetrics {
+		w.WriteString("# EOF\n")
+	}
+	return w.Flush()
+}
+
+// NegotiateExposition picks the exposition format from an Accept header. OpenMetrics is chosen
+// when it is accepted with at least the same quality as the Prometheus text format.
+func NegotiateExposition(accept string) ExpositionFormat {
+	openMetricsQ, textQ := -1.0, -1.0
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		mediaType := strings.ToLower(strings.TrimSpace(params[0]))
+		q := 1.0
+		for _, param := range params[1:] {
+			if value, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+				if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		switch mediaType {
+		case "application/openmetrics-text":
+			openMetricsQ = math.Max(openMetricsQ, q)
+		case "text/plain", "text/*", "*/*":
+			textQ = math.Max(textQ, q)
+		}
+	}
+	if openMetricsQ > 0 && openMetricsQ >= textQ {
+		return FormatOpenMetrics
+	}
+	return FormatPrometheusText
+}
+
+// quantile returns the q-quantile of sorted samples, or NaN when there are none.
+func quantile(sorted []float64, q float64) float64 {
+	if len(sorted) == 0 {
+		return math.NaN()
+	}
+	idx := int(math.Ceil(q*float64(len(sorted)))) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= len(sorted) {
+		idx = len(sorted) - 1
+	}
+	return sorted[idx]
+}
+
+// labelsKey builds a stable identity for a label set.
+func labelsKey(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, name := range names {
+		b.WriteString(name)
+		b.WriteByte(0)
+		b.WriteString(labels[name])
+		b.WriteByte(0)
+	}
+	return b.String()
+}
+
+// copyLabels returns a copy of the label set, or nil when empty.
+func copyLabels(labels map[string]string) map[string]string {
+	if len(labels) == 0 {
+		return nil
+	}
+	cp := make(map[string]string, len(labels))
+	for k, v := range labels {
+		cp[k] = v
+	}
+	return cp
+}
+
+// formatLabels renders a label set, optionally with an extra label (le or quantile) appended.
+func formatLabels(labels map[string]string, extraName, extraValue string) string {
+	if len(labels) == 0 && extraName == "" {
+		return ""
+	}
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, 0, len(names)+1)
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, name, escapeLabelValue(labels[name])))
+	}
+	if extraName != "" {
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, extraName, extraValue))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// escapeLabelValue escapes backslashes, double quotes and line feeds in label values.
+func escapeLabelValue(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+// escapeHelp escapes backslashes and line feeds in HELP text.
+func escapeHelp(v string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(v)
+}
+
+// formatFloat renders a sample value as expected by the exposition format.
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
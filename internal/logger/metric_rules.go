@@ -0,0 +1,442 @@
+package logger
+
+import (
+	"errors"
+	"fmt"
+	"github.com/spf13/viper"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ruleClauseRegex splits a clause into field, operator and value.
+var ruleClauseRegex = regexp.MustCompile(`^\s*([a-zA-Z_][a-zA-Z0-9_.\-]*)\s*(>=|<=|!=|=~|!~|=|>|<)\s*(.*?)\s*$`)
+
+// MetricRuleConfig declares a metric computed from log entries.
+//
+// Match is an expression of clauses joined by AND / OR (AND binds tighter), for example
+// `source=payments AND level>=ERROR`. Values holding spaces or the keywords can be quoted, as in
+// `message=~'disk or network'`. A clause compares a field (level, source, message, context,
+// hostname, trace_id, caller, metadata.<key> or tag.<key>) using =, !=, >, >=, <, <=, =~ or !~ (regex).
+// Value and label sources use the same field names.
+type MetricRuleConfig struct {
+	Name      string            `json:"name" mapstructure:"name"`                     // Metric family name.
+	Type      string            `json:"type,omitempty" mapstructure:"type"`           // counter (default), gauge, histogram or summary.
+	Help      string            `json:"help,omitempty" mapstructure:"help"`           // Help text of the family.
+	Match     string            `json:"match,omitempty" mapstructure:"match"`         // Filter expression, empty matches every entry.
+	Value     string            `json:"value,omitempty" mapstructure:"value"`         // Field providing the observed or set value; counters add 1 when empty.
+	Labels    map[string]string `json:"labels,omitempty" mapstructure:"labels"`       // Label name to field.
+	Buckets   []float64         `json:"buckets,omitempty" mapstructure:"buckets"`     // Histogram buckets.
+	Quantiles []float64         `json:"quantiles,omitempty" mapstructure:"quantiles"` // Summary quantiles.
+}
+
+// ruleClause is a single compiled comparison.
+type ruleClause struct {
+	field string
+	op    string
+	value string
+	re    *regexp.Regexp
+}
+
+// MetricRule is a compiled MetricRuleConfig.
+type MetricRule struct {
+	Config MetricRuleConfig
+	typ    MetricType
+	match  [][]ruleClause // OR of ANDed clauses
+}
+
+// CompileMetricRule parses and validates a rule.
+func CompileMetricRule(cfg MetricRuleConfig) (*MetricRule, error) {
+	if err := validateMetricName(cfg.Name); err != nil {
+		return nil, fmt.Errorf("metric rule: %w", err)
+	}
+	typ := CounterMetric
+	if cfg.Type != "" {
+		parsed, err := ParseMetricType(cfg.Type)
+		if err != nil {
+			return nil, fmt.Errorf("metric rule '%s': %w", cfg.Name, err)
+		}
+		typ = parsed
+	}
+	if typ != CounterMetric && cfg.Value == "" {
+		return nil, fmt.Errorf("metric rule '%s': 'value' is required for %s rules", cfg.Name, typ)
+	}
+	labels := make(map[string]string, len(cfg.Labels))
+	for name := range cfg.Labels {
+		labels[name] = ""
+	}
+	if err := validateLabels(typ, labels); err != nil {
+		return nil, fmt.Errorf("metric rule '%s': %w", cfg.Name, err)
+	}
+	if cfg.Value != "" && !validRuleField(normalizeRuleField(cfg.Value)) {
+		return nil, fmt.Errorf("metric rule '%s': unknown value field '%s'", cfg.Name, cfg.Value)
+	}
+	for name, field := range cfg.Labels {
+		if !validRuleField(normalizeRuleField(field)) {
+			return nil, fmt.Errorf("metric rule '%s': unknown field '%s' for label '%s'", cfg.Name, field, name)
+		}
+	}
+
+	match, err := compileMatchExpr(cfg.Match)
+	if err != nil {
+		return nil, fmt.Errorf("metric rule '%s': %w", cfg.Name, err)
+	}
+	return &MetricRule{Config: cfg, typ: typ, match: match}, nil
+}
+
+// compileMatchExpr parses a filter expression into an OR of ANDed clauses. An empty expression
+// compiles to no clauses, which matches every entry.
+func compileMatchExpr(expr string) ([][]ruleClause, error) {
+	if strings.TrimSpace(expr) == "" {
+		return nil, nil
+	}
+	var match [][]ruleClause
+	for _, alternative := range splitRuleExpr(strings.TrimSpace(expr), "OR") {
+		var clauses []ruleClause
+		for _, raw := range splitRuleExpr(alternative, "AND") {
+			clause, err := parseRuleClause(raw)
+			if err != nil {
+				return nil, err
+			}
+			clauses = append(clauses, clause)
+		}
+		match = append(match, clauses)
+	}
+	return match, nil
+}
+
+// splitRuleExpr splits an expression on a keyword surrounded by whitespace, matched regardless of
+// case. Quoted values are skipped, so that a keyword inside them does not split the expression.
+// A quote only opens a value at the start of a word, so that an apostrophe inside one is literal.
+func splitRuleExpr(expr, keyword string) []string {
+	var parts []string
+	var quote byte
+	start := 0
+	for i := 0; i < len(expr); i++ {
+		c := expr[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case (c == '"' || c == '\'') && (i == 0 || strings.IndexByte(" \t\r\n=~!<>", expr[i-1]) >= 0):
+			quote = c
+		case isRuleSpace(c):
+			// Skip the run of whitespace, then look for the keyword followed by whitespace
+			j := i
+			for j < len(expr) && isRuleSpace(expr[j]) {
+				j++
+			}
+			k := j + len(keyword)
+			if k < len(expr) && strings.EqualFold(expr[j:k], keyword) && isRuleSpace(expr[k]) {
+				parts = append(parts, expr[start:i])
+				for k < len(expr) && isRuleSpace(expr[k]) {
+					k++
+				}
+				start = k
+				j = k
+			}
+			i = j - 1
+		}
+	}
+	return append(parts, expr[start:])
+}
+
+// isRuleSpace reports whether c separates the words of an expression.
+func isRuleSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '\f'
+}
+
+// CompileMetricRules compiles a list of rules, skipping and reporting the invalid ones.
+func CompileMetricRules(cfgs []MetricRuleConfig) ([]*MetricRule, error) {
+	var rules []*MetricRule
+	var errs []error
+	for _, cfg := range cfgs {
+		rule, err := CompileMetricRule(cfg)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	return rules, errors.Join(errs...)
+}
+
+// LoadMetricRules reads and compiles the "metricRules" list of the configuration.
+func LoadMetricRules(vpr *viper.Viper) ([]*MetricRule, error) {
+	var cfgs []MetricRuleConfig
+	if err := vpr.UnmarshalKey("metricRules", &cfgs); err != nil {
+		return nil, fmt.Errorf("failed to parse metricRules config: %w", err)
+	}
+	return CompileMetricRules(cfgs)
+}
+
+// MetricRuleSet holds the active metric rules, replaced as a whole when the configuration changes.
+type MetricRuleSet struct {
+	rules []*MetricRule
+	mu    sync.RWMutex
+}
+
+// Rules returns the active rules.
+func (s *MetricRuleSet) Rules() []*MetricRule {
+	if s == nil {
+		return nil
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.rules
+}
+
+// UpdateFromConfig recompiles the rules from the configuration. Invalid rules are dropped and reported.
+func (s *MetricRuleSet) UpdateFromConfig(vpr *viper.Viper) error {
+	rules, err := LoadMetricRules(vpr)
+	s.mu.Lock()
+	s.rules = rules
+	s.mu.Unlock()
+	return err
+}
+
+// parseRuleClause parses a single "field op value" comparison.
+func parseRuleClause(raw string) (ruleClause, error) {
+	parts := ruleClauseRegex.FindStringSubmatch(raw)
+	if parts == nil {
+		return ruleClause{}, fmt.Errorf("invalid clause '%s': expected <field><op><value>", strings.TrimSpace(raw))
+	}
+	clause := ruleClause{field: normalizeRuleField(parts[1]), op: parts[2], value: unquote(parts[3])}
+	if !validRuleField(clause.field) {
+		return ruleClause{}, fmt.Errorf("invalid clause '%s': unknown field '%s'", strings.TrimSpace(raw), parts[1])
+	}
+	if clause.op == "=~" || clause.op == "!~" {
+		re, err := regexp.Compile(clause.value)
+		if err != nil {
+			return ruleClause{}, fmt.Errorf("invalid clause '%s': %w", strings.TrimSpace(raw), err)
+		}
+		clause.re = re
+	}
+	if clause.field == "level" {
+		clause.value = strings.ToUpper(clause.value)
+		if _, ok := logLevels[LogLevel(clause.value)]; !ok && clause.re == nil {
+			return ruleClause{}, fmt.Errorf("invalid clause '%s': unknown level '%s'", strings.TrimSpace(raw), parts[3])
+		}
+	}
+	return clause, nil
+}
+
+// normalizeRuleField lowercases the field name, keeping metadata and tag keys as written.
+func normalizeRuleField(field string) string {
+	prefix, key, found := strings.Cut(strings.TrimSpace(field), ".")
+	if !found {
+		return strings.ToLower(prefix)
+	}
+	return strings.ToLower(prefix) + "." + key
+}
+
+// validRuleField reports whether the field can be referenced by rules.
+func validRuleField(field string) bool {
+	switch field {
+	case "level", "source", "message", "context", "hostname", "trace_id", "caller":
+		return true
+	}
+	return strings.HasPrefix(field, "metadata.") || strings.HasPrefix(field, "tag.")
+}
+
+// unquote strips matching single or double quotes around a value.
+func unquote(v string) string {
+	if len(v) >= 2 && (v[0] == '"' || v[0] == '\'') && v[len(v)-1] == v[0] {
+		return v[1 : len(v)-1]
+	}
+	return v
+}
+
+// ruleField resolves a field of the entry, reporting whether it is present.
+func ruleField(le *LogEntry, field string) (string, bool) {
+	switch field {
+	case "level":
+		return string(le.Level), le.Level != ""
+	case "source":
+		return le.Source, le.Source != ""
+	case "message":
+		return le.Message, le.Message != ""
+	case "context":
+		return le.Context, le.Context != ""
+	case "hostname":
+		return le.Hostname, le.Hostname != ""
+	case "trace_id":
+		return le.TraceID, le.TraceID != ""
+	case "caller":
+		return le.Caller, le.Caller != ""
+	}
+	if key, ok := strings.CutPrefix(field, "metadata."); ok {
+		v, exists := le.Metadata[key]
+		if !exists || v == nil {
+			return "", false
+		}
+		return fmt.Sprintf("%v", v), true
+	}
+	if key, ok := strings.CutPrefix(field, "tag."); ok {
+		v, exists := le.Tags[key]
+		return v, exists
+	}
+	return "", false
+}
+
+// matches evaluates a clause against an entry.
+func (c ruleClause) matches(le *LogEntry) bool {
+	actual, present := ruleField(le, c.field)
+	switch c.op {
+	case "=~":
+		return present && c.re.MatchString(actual)
+	case "!~":
+		return !present || !c.re.MatchString(actual)
+	case "=":
+		return actual == c.value
+	case "!=":
+		return actual != c.value
+	}
+	if !present {
+		return false
+	}
+
+	// Ordered comparisons: levels by severity, numbers numerically, anything else lexically
+	var cmp int
+	if c.field == "level" {
+		cmp = logLevels[LogLevel(strings.ToUpper(actual))] - logLevels[LogLevel(c.value)]
+	} else if a, aErr := strconv.ParseFloat(actual, 64); aErr == nil {
+		b, bErr := strconv.ParseFloat(c.value, 64)
+		if bErr != nil {
+			return false
+		}
+		switch {
+		case a < b:
+			cmp = -1
+		case a > b:
+			cmp = 1
+		}
+	} else {
+		cmp = strings.Compare(actual, c.value)
+	}
+	switch c.op {
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	}
+	return false
+}
+
+// Matches reports whether the entry satisfies the rule's filter expression.
+func (r *MetricRule) Matches(entry LogzEntry) bool {
+	return r.matches(cloneEntry(entry))
+}
+
+// matches evaluates the OR of ANDed clauses.
+func (r *MetricRule) matches(le *LogEntry) bool {
+	return matchClauses(r.match, le)
+}
+
+// matchClauses evaluates an OR of ANDed clauses; no clauses match every entry.
+func matchClauses(match [][]ruleClause, le *LogEntry) bool {
+	if len(match) == 0 {
+		return true
+	}
+	for _, clauses := range match {
+		all := true
+		for _, c := range clauses {
+			if !c.matches(le) {
+				all = false
+				break
+			}
+		}
+		if all {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply updates the rule's metric family in pm when the entry matches.
+// It reports whether the entry matched and was recorded.
+func (r *MetricRule) Apply(pm *PrometheusManager, entry LogzEntry) (bool, error) {
+	return r.apply(pm, cloneEntry(entry))
+}
+
+// apply is Apply for an already cloned entry.
+func (r *MetricRule) apply(pm *PrometheusManager, le *LogEntry) (bool, error) {
+	if !r.matches(le) {
+		return false, nil
+	}
+	if err := pm.DefineMetric(MetricDefinition{
+		Name:      r.Config.Name,
+		Help:      r.Config.Help,
+		Type:      r.typ,
+		Buckets:   r.Config.Buckets,
+		Quantiles: r.Config.Quantiles,
+	}); err != nil {
+		return false, err
+	}
+
+	var labels map[string]string
+	if len(r.Config.Labels) > 0 {
+		labels = make(map[string]string, len(r.Config.Labels))
+		for name, field := range r.Config.Labels {
+			labels[name], _ = ruleField(le, normalizeRuleField(field))
+		}
+	}
+
+	value := 1.0
+	if r.Config.Value != "" {
+		raw, present := ruleField(le, normalizeRuleField(r.Config.Value))
+		if !present {
+			return false, nil
+		}
+		parsed, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return false, fmt.Errorf("metric rule '%s': value '%s' of %s is not a number", r.Config.Name, raw, r.Config.Value)
+		}
+		value = parsed
+	}
+
+	switch r.typ {
+	case CounterMetric:
+		return true, pm.IncWithExemplar(r.Config.Name, labels, value, traceExemplar(le))
+	case GaugeMetric:
+		return true, pm.Set(r.Config.Name, labels, value)
+	default:
+		return true, pm.Observe(r.Config.Name, labels, value)
+	}
+}
+
+// traceExemplar returns the exemplar labels linking a sample to the entry's trace, or nil when
+// the entry has no trace ID. The trace ID may also be given as the "trace_id" metadata.
+func traceExemplar(le *LogEntry) map[string]string {
+	traceID := le.TraceID
+	if traceID == "" {
+		if v, ok := le.Metadata["trace_id"].(string); ok {
+			traceID = v
+		}
+	}
+	if traceID == "" {
+		return nil
+	}
+	return map[string]string{"trace_id": traceID}
+}
+
+// ApplyMetricRules evaluates every rule against the entry.
+func ApplyMetricRules(pm *PrometheusManager, rules []*MetricRule, entry LogzEntry) error {
+	if len(rules) == 0 {
+		return nil
+	}
+	le := cloneEntry(entry)
+	var errs []error
+	for _, rule := range rules {
+		if _, err := rule.apply(pm, le); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
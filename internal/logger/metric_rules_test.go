@@ -0,0 +1,44 @@
+package logger
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitRuleExpr(t *testing.T) {
+	tests := []struct {
+		expr, keyword string
+		want          []string
+	}{
+		{"level>=ERROR OR source=api", "OR", []string{"level>=ERROR", "source=api"}},
+		{"level>=ERROR  or\tsource=api", "OR", []string{"level>=ERROR", "source=api"}},
+		{"message=~'disk or network' OR level=FATAL", "OR", []string{"message=~'disk or network'", "level=FATAL"}},
+		{`message="a AND b" AND source=api`, "AND", []string{`message="a AND b"`, "source=api"}},
+		{"message=don't OR source=api", "OR", []string{"message=don't", "source=api"}},
+		{"source=ORACLE", "OR", []string{"source=ORACLE"}},
+	}
+	for _, tt := range tests {
+		if got := splitRuleExpr(tt.expr, tt.keyword); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitRuleExpr(%q, %q) = %q, want %q", tt.expr, tt.keyword, got, tt.want)
+		}
+	}
+}
+
+func TestCompileMatchExprQuotedKeywords(t *testing.T) {
+	match, err := compileMatchExpr("message=~'disk or network' AND level>=ERROR")
+	if err != nil {
+		t.Fatalf("compileMatchExpr: %v", err)
+	}
+	if len(match) != 1 || len(match[0]) != 2 {
+		t.Fatalf("clauses = %+v, want one alternative of two clauses", match)
+	}
+	entry := func(level LogLevel, msg string) *LogEntry {
+		return NewLogEntry().WithLevel(level).WithMessage(msg).(*LogEntry)
+	}
+	if !matchClauses(match, entry(ERROR, "disk or network failure")) {
+		t.Error("expected a match on the quoted phrase")
+	}
+	if matchClauses(match, entry(ERROR, "disk full")) {
+		t.Error("unexpected match without the quoted phrase")
+	}
+}
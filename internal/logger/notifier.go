@@ -66,17 +66,7 @@ func NewNotifier(manager NotifierManager, enabled bool, webhookURL, httpMethod,
 
 // Notify sends a log entry notification based on the configured settings.
 func (n *NotifierImpl) Notify(entry LogzEntry) error {
-	if !n.EnabledFlag {
-		return nil
-	}
-
-	// Validate log level
-	if n.LogLevel != "" && n.LogLevel != string(entry.GetLevel()) {
-		return nil
-	}
-
-	// Validate Whitelist
-	if len(n.Whitelist) > 0 && !contains(n.Whitelist, entry.GetSource()) {
+	if !n.accepts(entry) {
 		return nil
 	}
 
@@ -104,6 +94,29 @@ func (n *NotifierImpl) Notify(entry LogzEntry) error {
 	return nil
 }
 
+// entryFilter is implemented by notifiers that filter entries before sending them.
+type entryFilter interface {
+	accepts(entry LogzEntry) bool
+}
+
+// accepts checks whether the entry passes the enabled flag, log level and whitelist filters.
+func (n *NotifierImpl) accepts(entry LogzEntry) bool {
+	if !n.EnabledFlag {
+		return false
+	}
+
+	// Validate log level
+	if n.LogLevel != "" && n.LogLevel != string(entry.GetLevel()) {
+		return false
+	}
+
+	// Validate Whitelist
+	if len(n.Whitelist) > 0 && !contains(n.Whitelist, entry.GetSource()) {
+		return false
+	}
+	return true
+}
+
 // httpNotify sends an HTTP notification.
 func (n *NotifierImpl) httpNotify(entry LogzEntry) error {
 	if n.HttpMethod == "POST" {
@@ -202,7 +215,7 @@ func NewHTTPNotifier(webhookURL, authToken string) *HTTPNotifier {
 
 // Notify sends an HTTP notification.
 func (n *HTTPNotifier) Notify(entry LogzEntry) error {
-	if !n.EnabledFlag {
+	if !n.accepts(entry) {
 		return nil
 	}
 	req, err := http.NewRequest(n.HttpMethod, n.WebhookURL, strings.NewReader(entry.GetMessage()))
@@ -244,7 +257,7 @@ func NewZMQNotifier(endpoint string) *ZMQNotifier {
 // Uncomment and ensure the required libraries are installed if needed in the future
 // Notify sends a WebSocket notification.
 func (n *ZMQNotifier) Notify(entry LogzEntry) error {
-	if !n.EnabledFlag {
+	if !n.accepts(entry) {
 		return nil
 	}
 	_ = n.AuthToken + "|" + entry.GetMessage()
@@ -255,31 +268,6 @@ func (n *ZMQNotifier) Notify(entry LogzEntry) error {
 	return nil
 }
 
-// DBusNotifier is a notifier that sends DBus notifications.
-type DBusNotifier struct {
-	NotifierImpl
-}
-
-// NewDBusNotifier creates a new DBusNotifier instance.
-func NewDBusNotifier() *DBusNotifier {
-	return &DBusNotifier{
-		NotifierImpl: NotifierImpl{},
-	}
-}
-
-// Notify sends a DBus notification.
-func (n *DBusNotifier) Notify(entry LogzEntry) error {
-	if !n.EnabledFlag {
-		return nil
-	}
-	output := n.AuthToken + "|" + entry.GetMessage()
-	dbusObj := n.DBusClient().Object("org.freedesktop.Notifications", "/org/freedesktop/Notifications")
-	if call := dbusObj.Call("org.freedesktop.Notifications.Notify", 0, "", uint32(0), "", output, []string{}, map[string]dbus.Variant{}, int32(5000)); call.Err != nil {
-		return fmt.Errorf("DBusNotifier error: %w", call.Err)
-	}
-	return nil
-}
-
 func GetLogPath() string {
 	home, homeErr := os.UserHomeDir()
 	if homeErr != nil {
@@ -0,0 +1,211 @@
+package logger
+
+import (
+	"errors"
+	"fmt"
+	"github.com/mitchellh/mapstructure"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// builtinNotifierTypes lists the notifier types implemented by logz itself.
+var builtinNotifierTypes = map[string]bool{"http": true, "zmq": true, "dbus": true, "exec": true}
+
+// NotifierConfig holds the declarative definition of a notifier as read from the configuration file.
+type NotifierConfig struct {
+	Type       string   `json:"type" mapstructure:"type"`                       // Notifier type (http, zmq, dbus, exec).
+	Enabled    *bool    `json:"enabled,omitempty" mapstructure:"enabled"`       // Whether the notifier is active, defaults to true.
+	LogLevel   string   `json:"logLevel,omitempty" mapstructure:"logLevel"`     // Only entries with this level are notified.
+	Whitelist  []string `json:"whitelist,omitempty" mapstructure:"whitelist"`   // Only entries from these sources are notified.
+	WebhookURL string   `json:"webhookURL,omitempty" mapstructure:"webhookURL"` // Target URL for http notifiers.
+	HttpMethod string   `json:"httpMethod,omitempty" mapstructure:"httpMethod"` // HTTP method for http notifiers, defaults to POST.
+	AuthToken  string   `json:"authToken,omitempty" mapstructure:"authToken"`   // Bearer token sent with notifications.
+	Endpoint   string   `json:"endpoint,omitempty" mapstructure:"endpoint"`     // Socket endpoint for zmq notifiers.
+
+	Command        string        `json:"command,omitempty" mapstructure:"command"`               // Executable for exec notifiers.
+	Args           []string      `json:"args,omitempty" mapstructure:"args"`                     // Arguments for exec notifiers.
+	Timeout        time.Duration `json:"timeout,omitempty" mapstructure:"timeout"`               // Maximum run time of an exec invocation.
+	MaxConcurrency int           `json:"maxConcurrency,omitempty" mapstructure:"maxConcurrency"` // Maximum parallel exec invocations.
+
+	Bus           string                   `json:"bus,omitempty" mapstructure:"bus"`                     // DBus bus: session (default) or system.
+	Address       string                   `json:"address,omitempty" mapstructure:"address"`             // Explicit DBus address, overrides bus.
+	AppName       string                   `json:"appName,omitempty" mapstructure:"appName"`             // Application name for desktop notifications.
+	Icon          string                   `json:"icon,omitempty" mapstructure:"icon"`                   // Icon for desktop notifications.
+	ExpireTimeout map[string]time.Duration `json:"expireTimeout,omitempty" mapstructure:"expireTimeout"` // Display time per level for desktop notifications.
+	Actions       bool                     `json:"actions,omitempty" mapstructure:"actions"`             // Offer an action opening the log in "logz watch".
+	ActionCommand []string                 `json:"actionCommand,omitempty" mapstructure:"actionCommand"` // Command run when the action is invoked.
+
+	Options map[string]interface{} `json:"options,omitempty" mapstructure:"options"` // Settings passed to plugin notifiers in the handshake.
+
+	Throttle *ThrottleConfig `json:"throttle,omitempty" mapstructure:"throttle"` // Optional grouping of repeated notifications.
+}
+
+// decodeNotifierConfig decodes a notifier definition from generic values, such as a JSON object,
+// the way the configuration file is decoded: durations are accepted as strings like "5s".
+// Unknown fields are rejected.
+func decodeNotifierConfig(input map[string]interface{}) (NotifierConfig, error) {
+	var nc NotifierConfig
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook: mapstructure.ComposeDecodeHookFunc(
+			mapstructure.StringToTimeDurationHookFunc(),
+			mapstructure.StringToSliceHookFunc(","),
+		),
+		WeaklyTypedInput: true,
+		ErrorUnused:      true,
+		Result:           &nc,
+	})
+	if err != nil {
+		return nc, err
+	}
+	err = decoder.Decode(input)
+	return nc, err
+}
+
+// IsEnabled reports whether the notifier should be active, defaulting to true when not set.
+func (nc NotifierConfig) IsEnabled() bool {
+	return nc.Enabled == nil || *nc.Enabled
+}
+
+// Validate checks the notifier definition and returns a descriptive error for the first problem found.
+// Types not built into logz must be declared in plugins.
+func (nc NotifierConfig) Validate(name string, plugins map[string]PluginConfig) error {
+	if strings.TrimSpace(name) == "" {
+		return errors.New("notifier name must not be empty")
+	}
+	if nc.Throttle != nil {
+		if err := nc.Throttle.Validate(name); err != nil {
+			return err
+		}
+	}
+	if nc.LogLevel != "" {
+		if _, ok := logLevels[LogLevel(strings.ToUpper(nc.LogLevel))]; !ok {
+			return fmt.Errorf("notifier '%s': invalid logLevel '%s'", name, nc.LogLevel)
+		}
+	}
+	switch strings.ToLower(nc.Type) {
+	case "":
+		return fmt.Errorf("notifier '%s': missing 'type'", name)
+	case "http":
+		if nc.WebhookURL == "" {
+			return fmt.Errorf("notifier '%s': 'webhookURL' is required for http notifiers", name)
+		}
+		u, err := url.Parse(nc.WebhookURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("notifier '%s': invalid webhookURL '%s'", name, nc.WebhookURL)
+		}
+		switch strings.ToUpper(nc.HttpMethod) {
+		case "", http.MethodPost, http.MethodPut, http.MethodPatch:
+		default:
+			return fmt.Errorf("notifier '%s': unsupported httpMethod '%s' (use POST, PUT or PATCH)", name, nc.HttpMethod)
+		}
+	case "zmq":
+		if nc.Endpoint == "" {
+			return fmt.Errorf("notifier '%s': 'endpoint' is required for zmq notifiers", name)
+		}
+	case "dbus":
+		switch DBusBus(strings.ToLower(nc.Bus)) {
+		case "", DBusSessionBus, DBusSystemBus:
+		default:
+			return fmt.Errorf("notifier '%s': invalid bus '%s' (use session or system)", name, nc.Bus)
+		}
+		for level, timeout := range nc.ExpireTimeout {
+			if _, ok := logLevels[LogLevel(strings.ToUpper(level))]; !ok {
+				return fmt.Errorf("notifier '%s': invalid expireTimeout level '%s'", name, level)
+			}
+			if timeout < 0 {
+				return fmt.Errorf("notifier '%s': expireTimeout for '%s' must not be negative", name, level)
+			}
+		}
+	case "exec":
+		if nc.Command == "" {
+			return fmt.Errorf("notifier '%s': 'command' is required for exec notifiers", name)
+		}
+		if _, err := exec.LookPath(nc.Command); err != nil {
+			return fmt.Errorf("notifier '%s': command '%s' not found: %w", name, nc.Command, err)
+		}
+		if nc.Timeout < 0 {
+			return fmt.Errorf("notifier '%s': 'timeout' must not be negative", name)
+		}
+		if nc.MaxConcurrency < 0 {
+			return fmt.Errorf("notifier '%s': 'maxConcurrency' must not be negative", name)
+		}
+	default:
+		if _, ok := plugins[nc.Type]; !ok {
+			return fmt.Errorf("notifier '%s': unknown type '%s' (not a built-in type or configured plugin)", name, nc.Type)
+		}
+	}
+	return nil
+}
+
+// Equal reports whether two notifier definitions are identical.
+func (nc NotifierConfig) Equal(other NotifierConfig) bool {
+	return reflect.DeepEqual(nc, other)
+}
+
+// build creates the notifier described by the configuration, bound to the given manager
+// and wrapped with throttling when configured.
+func (nc NotifierConfig) build(name string, manager NotifierManager, plugins map[string]PluginConfig) Notifier {
+	notifier := nc.buildBase(name, manager, plugins)
+	if notifier != nil && nc.Throttle != nil {
+		return NewThrottledNotifier(name, notifier, *nc.Throttle)
+	}
+	return notifier
+}
+
+// buildBase creates the bare notifier for the configured type.
+func (nc NotifierConfig) buildBase(name string, manager NotifierManager, plugins map[string]PluginConfig) Notifier {
+	base := NotifierImpl{
+		NotifierManager: manager,
+		EnabledFlag:     nc.IsEnabled(),
+		AuthToken:       nc.AuthToken,
+		LogLevel:        strings.ToUpper(nc.LogLevel),
+		Whitelist:       nc.Whitelist,
+	}
+	if base.Whitelist == nil {
+		base.Whitelist = []string{}
+	}
+
+	switch strings.ToLower(nc.Type) {
+	case "http":
+		base.WebhookURL = nc.WebhookURL
+		base.HttpMethod = strings.ToUpper(getOrDefault(nc.HttpMethod, http.MethodPost))
+		return &HTTPNotifier{NotifierImpl: base}
+	case "zmq":
+		base.WsEndpoint = nc.Endpoint
+		return &ZMQNotifier{NotifierImpl: base}
+	case "dbus":
+		notifier := NewDBusNotifier()
+		notifier.NotifierImpl = base
+		notifier.Address = nc.Address
+		notifier.Icon = nc.Icon
+		notifier.Actions = nc.Actions
+		notifier.ActionCommand = nc.ActionCommand
+		if nc.Bus != "" {
+			notifier.Bus = DBusBus(strings.ToLower(nc.Bus))
+		}
+		if nc.AppName != "" {
+			notifier.AppName = nc.AppName
+		}
+		if len(nc.ExpireTimeout) > 0 {
+			notifier.ExpireTimeout = make(map[LogLevel]time.Duration, len(nc.ExpireTimeout))
+			for level, timeout := range nc.ExpireTimeout {
+				notifier.ExpireTimeout[LogLevel(strings.ToUpper(level))] = timeout
+			}
+		}
+		return notifier
+	case "exec":
+		notifier := NewExecNotifier(nc.Command, nc.Args, nc.Timeout, nc.MaxConcurrency)
+		notifier.NotifierImpl = base
+		return notifier
+	}
+	if plugin, ok := plugins[nc.Type]; ok {
+		notifier := NewPluginNotifier(name, plugin, nc.Options)
+		notifier.NotifierImpl = base
+		return notifier
+	}
+	return nil
+}
@@ -0,0 +1,248 @@
+package logger
+
+import (
+	"fmt"
+	"github.com/godbus/dbus/v5"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	dbusNotificationsName  = "org.freedesktop.Notifications"
+	dbusNotificationsPath  = "/org/freedesktop/Notifications"
+	dbusNotificationsIface = "org.freedesktop.Notifications"
+
+	// dbusActionOpen is the action key that opens the log in "logz watch".
+	dbusActionOpen = "default"
+)
+
+// DBusBus selects the message bus used by the DBusNotifier.
+type DBusBus string
+
+const (
+	DBusSessionBus DBusBus = "session"
+	DBusSystemBus  DBusBus = "system"
+)
+
+// Urgency levels defined by the desktop notifications specification.
+const (
+	urgencyLow      byte = 0
+	urgencyNormal   byte = 1
+	urgencyCritical byte = 2
+)
+
+// defaultDBusExpire holds the display time per level; zero means the notification never expires.
+var defaultDBusExpire = map[LogLevel]time.Duration{
+	DEBUG: 5 * time.Second,
+	INFO:  5 * time.Second,
+	WARN:  10 * time.Second,
+	ERROR: 0,
+	FATAL: 0,
+}
+
+// DBusNotifier is a notifier that sends desktop notifications over DBus.
+type DBusNotifier struct {
+	NotifierImpl
+	Bus           DBusBus                    // Bus to connect to, session by default.
+	Address       string                     // Explicit bus address, overrides Bus (e.g. a private dbus-daemon).
+	AppName       string                     // Application name shown by the notification server.
+	Icon          string                     // Icon name or path.
+	ExpireTimeout map[LogLevel]time.Duration // Display time per level, overriding the defaults.
+	Actions       bool                       // Whether to offer an action that opens the log in "logz watch".
+	ActionCommand []string                   // Command run when the action is invoked.
+
+	conn    *dbus.Conn
+	pending map[uint32]struct{} // Notifications sent with actions and still open.
+	mu      sync.Mutex
+}
+
+// NewDBusNotifier creates a new DBusNotifier instance using the session bus.
+func NewDBusNotifier() *DBusNotifier {
+	return &DBusNotifier{
+		NotifierImpl: NotifierImpl{},
+		Bus:          DBusSessionBus,
+		AppName:      "logz",
+	}
+}
+
+// Notify sends a DBus notification.
+func (n *DBusNotifier) Notify(entry LogzEntry) error {
+	if !n.accepts(entry) {
+		return nil
+	}
+	conn, err := n.connect()
+	if err != nil {
+		return fmt.Errorf("DBusNotifier connection error: %w", err)
+	}
+
+	level := entry.GetLevel()
+	summary := "[" + string(level) + "]"
+	if entry.GetSource() != "" {
+		summary += " " + entry.GetSource()
+	}
+	body := entry.GetMessage()
+	if entry.GetContext() != "" {
+		body = entry.GetContext() + ": " + body
+	}
+
+	var actions []string
+	if n.Actions {
+		actions = []string{dbusActionOpen, "Open in logz watch"}
+	}
+	hints := map[string]dbus.Variant{
+		"urgency": dbus.MakeVariant(dbusUrgency(level)),
+	}
+
+	dbusObj := conn.Object(dbusNotificationsName, dbusNotificationsPath)
+	call := dbusObj.Call(dbusNotificationsIface+".Notify", 0,
+		n.AppName, uint32(0), n.Icon, summary, body, actions, hints, n.expireTimeout(level))
+	if call.Err != nil {
+		n.reset()
+		return fmt.Errorf("DBusNotifier error: %w", call.Err)
+	}
+
+	if n.Actions {
+		var id uint32
+		if err := call.Store(&id); err == nil {
+			n.mu.Lock()
+			n.pending[id] = struct{}{}
+			n.mu.Unlock()
+		}
+	}
+	return nil
+}
+
+// DBusClient returns the notifier's own DBus connection, connecting if necessary.
+func (n *DBusNotifier) DBusClient() *dbus.Conn {
+	conn, _ := n.connect()
+	return conn
+}
+
+// Close releases the DBus connection.
+func (n *DBusNotifier) Close() error {
+	n.mu.Lock()
+	conn := n.conn
+	n.conn = nil
+	n.mu.Unlock()
+	if conn != nil {
+		return conn.Close()
+	}
+	return nil
+}
+
+// connect opens the configured bus connection once and subscribes to action signals.
+func (n *DBusNotifier) connect() (*dbus.Conn, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.conn != nil && n.conn.Connected() {
+		return n.conn, nil
+	}
+
+	var conn *dbus.Conn
+	var err error
+	switch {
+	case n.Address != "":
+		conn, err = dbus.Connect(n.Address)
+	case n.Bus == DBusSystemBus:
+		conn, err = dbus.ConnectSystemBus()
+	default:
+		conn, err = dbus.ConnectSessionBus()
+	}
+	if err != nil {
+		return nil, err
+	}
+	n.conn = conn
+	n.pending = make(map[uint32]struct{})
+
+	if n.Actions {
+		if err := conn.AddMatchSignal(
+			dbus.WithMatchObjectPath(dbusNotificationsPath),
+			dbus.WithMatchInterface(dbusNotificationsIface),
+		); err != nil {
+			log.Printf("DBusNotifier: could not subscribe to actions: %v", err)
+		} else {
+			signals := make(chan *dbus.Signal, 16)
+			conn.Signal(signals)
+			go n.handleSignals(signals)
+		}
+	}
+	return conn, nil
+}
+
+// reset drops a broken connection so the next notification reconnects.
+func (n *DBusNotifier) reset() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.conn != nil && !n.conn.Connected() {
+		n.conn = nil
+	}
+}
+
+// handleSignals runs the action command for invoked actions and forgets closed notifications.
+func (n *DBusNotifier) handleSignals(signals <-chan *dbus.Signal) {
+	for signal := range signals {
+		if len(signal.Body) < 2 {
+			continue
+		}
+		id, ok := signal.Body[0].(uint32)
+		if !ok {
+			continue
+		}
+		n.mu.Lock()
+		_, known := n.pending[id]
+		if known {
+			delete(n.pending, id)
+		}
+		n.mu.Unlock()
+		if !known {
+			continue
+		}
+
+		if signal.Name == dbusNotificationsIface+".ActionInvoked" {
+			if key, _ := signal.Body[1].(string); key == dbusActionOpen {
+				n.runAction()
+			}
+		}
+	}
+}
+
+// runAction opens the log in "logz watch" using the configured command.
+func (n *DBusNotifier) runAction() {
+	command := n.ActionCommand
+	if len(command) == 0 {
+		command = []string{"x-terminal-emulator", "-e", os.Args[0], "watch"}
+	}
+	cmd := exec.Command(command[0], command[1:]...)
+	if err := cmd.Start(); err != nil {
+		log.Printf("DBusNotifier: could not run action '%s': %v", strings.Join(command, " "), err)
+		return
+	}
+	go func() { _ = cmd.Wait() }()
+}
+
+// expireTimeout returns the display time for a level in milliseconds.
+func (n *DBusNotifier) expireTimeout(level LogLevel) int32 {
+	timeout, ok := n.ExpireTimeout[level]
+	if !ok {
+		if timeout, ok = defaultDBusExpire[level]; !ok {
+			return -1
+		}
+	}
+	return int32(timeout / time.Millisecond)
+}
+
+// dbusUrgency maps a log level to a desktop notification urgency.
+func dbusUrgency(level LogLevel) byte {
+	switch level {
+	case DEBUG, INFO:
+		return urgencyLow
+	case ERROR, FATAL:
+		return urgencyCritical
+	default:
+		return urgencyNormal
+	}
+}
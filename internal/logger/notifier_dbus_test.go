@@ -0,0 +1,183 @@
+package logger
+
+import (
+	"bufio"
+	"github.com/godbus/dbus/v5"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// privateBusConfig is a minimal bus configuration allowing any name and message.
+const privateBusConfig = `<busconfig>
+  <type>session</type>
+  <listen>unix:dir=%DIR%</listen>
+  <auth>EXTERNAL</auth>
+  <policy context="default">
+    <allow send_destination="*" eavesdrop="true"/>
+    <allow eavesdrop="true"/>
+    <allow own="*"/>
+  </policy>
+</busconfig>
+`
+
+// startPrivateBus runs a dbus-daemon for the test and returns its address. The test is skipped
+// when dbus-daemon is not installed.
+func startPrivateBus(t *testing.T) string {
+	t.Helper()
+	daemon, err := exec.LookPath("dbus-daemon")
+	if err != nil {
+		t.Skip("dbus-daemon not installed")
+	}
+	dir := t.TempDir()
+	config := filepath.Join(dir, "bus.conf")
+	if err := os.WriteFile(config, []byte(strings.ReplaceAll(privateBusConfig, "%DIR%", dir)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(daemon, "--config-file="+config, "--print-address", "--nofork", "--nopidfile")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("start dbus-daemon: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	})
+	address, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatalf("read bus address: %v", err)
+	}
+	return strings.TrimSpace(address)
+}
+
+// fakeNotification is a call received by fakeNotificationServer.
+type fakeNotification struct {
+	appName, icon, summary, body string
+	actions                      []string
+	hints                        map[string]dbus.Variant
+	expire                       int32
+}
+
+// fakeNotificationServer implements org.freedesktop.Notifications.Notify on the private bus.
+type fakeNotificationServer struct {
+	conn     *dbus.Conn
+	mu       sync.Mutex
+	received []fakeNotification
+}
+
+func (s *fakeNotificationServer) Notify(appName string, _ uint32, icon, summary, body string, actions []string,
+	hints map[string]dbus.Variant, expire int32) (uint32, *dbus.Error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.received = append(s.received, fakeNotification{appName, icon, summary, body, actions, hints, expire})
+	return uint32(len(s.received)), nil
+}
+
+func (s *fakeNotificationServer) last(t *testing.T) fakeNotification {
+	t.Helper()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.received) == 0 {
+		t.Fatal("no notification received")
+	}
+	return s.received[len(s.received)-1]
+}
+
+// startNotificationServer owns the notifications name on the bus at address.
+func startNotificationServer(t *testing.T, address string) *fakeNotificationServer {
+	t.Helper()
+	conn, err := dbus.Connect(address)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	server := &fakeNotificationServer{conn: conn}
+	if err := conn.Export(server, dbusNotificationsPath, dbusNotificationsIface); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	reply, err := conn.RequestName(dbusNotificationsName, dbus.NameFlagDoNotQueue)
+	if err != nil || reply != dbus.RequestNameReplyPrimaryOwner {
+		t.Fatalf("request name: %v (reply %d)", err, reply)
+	}
+	return server
+}
+
+func TestDBusNotifierNotify(t *testing.T) {
+	address := startPrivateBus(t)
+	server := startNotificationServer(t, address)
+
+	n := NewDBusNotifier()
+	n.Enable()
+	n.Address = address
+	n.Icon = "dialog-error"
+	n.ExpireTimeout = map[LogLevel]time.Duration{WARN: 3 * time.Second}
+	defer n.Close()
+
+	entry := NewLogEntry().WithLevel(ERROR).WithSource("api").WithContext("db").WithMessage("connection lost")
+	if err := n.Notify(entry); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	got := server.last(t)
+	if got.appName != "logz" || got.icon != "dialog-error" || got.summary != "[ERROR] api" || got.body != "db: connection lost" {
+		t.Errorf("notification = %+v", got)
+	}
+	if urgency, _ := got.hints["urgency"].Value().(byte); urgency != urgencyCritical {
+		t.Errorf("urgency = %v, want %d", got.hints["urgency"], urgencyCritical)
+	}
+	if got.expire != 0 || len(got.actions) != 0 {
+		t.Errorf("expire = %d, actions = %v", got.expire, got.actions)
+	}
+
+	if err := n.Notify(NewLogEntry().WithLevel(WARN).WithMessage("slow")); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	got = server.last(t)
+	if urgency, _ := got.hints["urgency"].Value().(byte); urgency != urgencyNormal || got.expire != 3000 || got.summary != "[WARN]" {
+		t.Errorf("notification = %+v", got)
+	}
+}
+
+func TestDBusNotifierAction(t *testing.T) {
+	address := startPrivateBus(t)
+	server := startNotificationServer(t, address)
+
+	marker := filepath.Join(t.TempDir(), "opened")
+	n := NewDBusNotifier()
+	n.Enable()
+	n.Address = address
+	n.Actions = true
+	n.ActionCommand = []string{"touch", marker}
+	defer n.Close()
+
+	if err := n.Notify(NewLogEntry().WithLevel(ERROR).WithMessage("disk full")); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	if got := server.last(t); len(got.actions) != 2 || got.actions[0] != dbusActionOpen {
+		t.Fatalf("actions = %v", got.actions)
+	}
+
+	// An action on an unknown notification is ignored
+	if err := server.conn.Emit(dbusNotificationsPath, dbusNotificationsIface+".ActionInvoked", uint32(99), dbusActionOpen); err != nil {
+		t.Fatalf("emit: %v", err)
+	}
+	if err := server.conn.Emit(dbusNotificationsPath, dbusNotificationsIface+".ActionInvoked", uint32(1), dbusActionOpen); err != nil {
+		t.Fatalf("emit: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := os.Stat(marker); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("action command not run")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
@@ -0,0 +1,172 @@
+package logger
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultExecTimeout        = 10 * time.Second
+	defaultExecMaxConcurrency = 4
+	execWaitDelay             = time.Second // Wait for the output of a killed command, or of its children.
+
+	// execNotifierSource is the source of the entries reporting on the commands. Exec notifiers
+	// skip them, so that a failing command cannot trigger itself.
+	execNotifierSource = "logz.exec"
+)
+
+// envKeyRegex matches the characters that are not allowed in environment variable names.
+var envKeyRegex = regexp.MustCompile(`[^A-Z0-9_]`)
+
+// ExecNotifier is a notifier that runs a local command for every log entry.
+// The JSON-encoded entry is written to the command's stdin and its fields are
+// exposed as LOGZ_* environment variables. Commands run in the background, and
+// entries arriving while all the slots are busy are dropped.
+type ExecNotifier struct {
+	NotifierImpl
+	Command string        // Executable to run.
+	Args    []string      // Arguments passed to the executable.
+	Timeout time.Duration // Maximum run time of a single invocation.
+	slots   chan struct{} // Semaphore limiting concurrent invocations.
+	dropped atomic.Uint64 // Entries dropped because all the slots were busy.
+}
+
+// NewExecNotifier creates a new ExecNotifier instance.
+// A zero timeout or concurrency falls back to the defaults.
+func NewExecNotifier(command string, args []string, timeout time.Duration, maxConcurrency int) *ExecNotifier {
+	if timeout <= 0 {
+		timeout = defaultExecTimeout
+	}
+	if maxConcurrency <= 0 {
+		maxConcurrency = defaultExecMaxConcurrency
+	}
+	return &ExecNotifier{
+		NotifierImpl: NotifierImpl{},
+		Command:      command,
+		Args:         args,
+		Timeout:      timeout,
+		slots:        make(chan struct{}, maxConcurrency),
+	}
+}
+
+// QueueDepth returns the number of commands currently running.
+func (n *ExecNotifier) QueueDepth() int { return len(n.slots) }
+
+// Dropped returns the number of entries dropped because all the slots were busy.
+func (n *ExecNotifier) Dropped() uint64 { return n.dropped.Load() }
+
+// Notify starts the configured command with the log entry. It does not wait for the command:
+// its stderr and failures are reported in Logz's own log.
+func (n *ExecNotifier) Notify(entry LogzEntry) error {
+	if !n.accepts(entry) || entry.GetSource() == execNotifierSource {
+		return nil
+	}
+
+	payload, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("ExecNotifier encoding error: %w", err)
+	}
+	le := cloneEntry(entry)
+
+	// Take a free slot without waiting, so that a slow command does not hold up the logger
+	select {
+	case n.slots <- struct{}{}:
+	default:
+		dropped := n.dropped.Add(1)
+		return fmt.Errorf("ExecNotifier concurrency limit reached for '%s', entry dropped (%d so far)", n.Command, dropped)
+	}
+	go func() {
+		defer func() { <-n.slots }()
+		n.run(payload, le)
+	}()
+	return nil
+}
+
+// run runs the command for an entry and reports its stderr and failure.
+func (n *ExecNotifier) run(payload []byte, le *LogEntry) {
+	ctx, cancel := context.WithTimeout(context.Background(), n.Timeout)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, n.Command, n.Args...)
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Stderr = &stderr
+	cmd.Env = append(os.Environ(), execEnv(le)...)
+	// The command runs in its own process group, killed as a whole on timeout, so that children
+	// left in the background do not outlive it. WaitDelay stops waiting for pipes they still hold.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = execWaitDelay
+
+	runErr := cmd.Run()
+
+	scanner := bufio.NewScanner(&stderr)
+	for scanner.Scan() {
+		n.report(WARN, fmt.Sprintf("ExecNotifier [%s] stderr: %s", n.Command, scanner.Text()))
+	}
+
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		n.report(ERROR, fmt.Sprintf("ExecNotifier command '%s' timed out after %s", n.Command, n.Timeout))
+	} else if runErr != nil {
+		n.report(ERROR, fmt.Sprintf("ExecNotifier command '%s' failed: %v", n.Command, runErr))
+	}
+}
+
+// report logs a message about the command through the service logger, with a source that exec
+// notifiers skip. Without a service logger, it goes to the standard log.
+func (n *ExecNotifier) report(level LogLevel, msg string) {
+	if globalLogger == nil {
+		log.Print(msg)
+		return
+	}
+	entry := NewLogEntry().
+		WithLevel(level).
+		WithSource(execNotifierSource).
+		WithMessage(msg).
+		WithSeverity(logLevels[level])
+	entry.AddMetadata("command", n.Command)
+	globalLogger.Ingest(entry)
+}
+
+// execEnv builds the LOGZ_* environment variables for a log entry.
+func execEnv(le *LogEntry) []string {
+	env := []string{
+		"LOGZ_TIMESTAMP=" + le.Timestamp.Format(time.RFC3339Nano),
+		"LOGZ_LEVEL=" + string(le.Level),
+		"LOGZ_SOURCE=" + le.Source,
+		"LOGZ_CONTEXT=" + le.Context,
+		"LOGZ_MESSAGE=" + le.Message,
+		"LOGZ_PID=" + strconv.Itoa(le.ProcessID),
+		"LOGZ_HOSTNAME=" + le.Hostname,
+		"LOGZ_SEVERITY=" + strconv.Itoa(le.Severity),
+		"LOGZ_TRACE_ID=" + le.TraceID,
+		"LOGZ_CALLER=" + le.Caller,
+	}
+	for k, v := range le.Tags {
+		env = append(env, "LOGZ_TAG_"+envKey(k)+"="+v)
+	}
+	for k, v := range le.Metadata {
+		env = append(env, "LOGZ_META_"+envKey(k)+"="+fmt.Sprintf("%v", v))
+	}
+	return env
+}
+
+// envKey normalizes a tag or metadata key into an environment variable name suffix.
+func envKey(key string) string {
+	return envKeyRegex.ReplaceAllString(strings.ToUpper(key), "_")
+}
@@ -0,0 +1,88 @@
+package logger
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestExecNotifier returns an enabled exec notifier running sh -c script.
+func newTestExecNotifier(script string, timeout time.Duration, maxConcurrency int) *ExecNotifier {
+	n := NewExecNotifier("sh", []string{"-c", script}, timeout, maxConcurrency)
+	n.Enable()
+	return n
+}
+
+// waitIdle waits until the notifier has no command running.
+func waitIdle(t *testing.T, n *ExecNotifier, within time.Duration) {
+	t.Helper()
+	deadline := time.Now().Add(within)
+	for n.QueueDepth() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d commands still running after %s", n.QueueDepth(), within)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestExecNotifierPayload(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out")
+	n := newTestExecNotifier(`{ echo "$LOGZ_LEVEL $LOGZ_TAG_ENV"; cat; } > "`+out+`"`, time.Second, 1)
+
+	entry := NewLogEntry().WithLevel(ERROR).WithMessage("disk full")
+	entry.AddTag("env", "prod")
+	if err := n.Notify(entry); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	waitIdle(t, n, 5*time.Second)
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), "ERROR prod\n") || !strings.Contains(string(data), `"message":"disk full"`) {
+		t.Fatalf("command received %q", data)
+	}
+}
+
+func TestExecNotifierDropsWhenBusy(t *testing.T) {
+	n := newTestExecNotifier("sleep 600", 200*time.Millisecond, 1)
+	entry := NewLogEntry().WithLevel(ERROR).WithMessage("first")
+	if err := n.Notify(entry); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	if err := n.Notify(entry); err == nil || n.Dropped() != 1 {
+		t.Fatalf("second Notify = %v, dropped %d", err, n.Dropped())
+	}
+	waitIdle(t, n, 5*time.Second)
+	if err := n.Notify(entry); err != nil {
+		t.Fatalf("Notify after the timeout: %v", err)
+	}
+	waitIdle(t, n, 5*time.Second)
+}
+
+func TestExecNotifierBackgroundChild(t *testing.T) {
+	// The background sleep keeps stderr open: the slot must be released after the timeout anyway
+	n := newTestExecNotifier("sleep 600 & sleep 600", 200*time.Millisecond, 1)
+	started := time.Now()
+	if err := n.Notify(NewLogEntry().WithLevel(ERROR).WithMessage("timeout")); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	waitIdle(t, n, 5*time.Second)
+	if elapsed := time.Since(started); elapsed > 3*time.Second {
+		t.Fatalf("slot released after %s", elapsed)
+	}
+
+	// A command exiting at once while its child holds stderr does not hold the slot either
+	n = newTestExecNotifier("sleep 5 &", 10*time.Second, 1)
+	started = time.Now()
+	if err := n.Notify(NewLogEntry().WithLevel(ERROR).WithMessage("background")); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	waitIdle(t, n, 5*time.Second)
+	if elapsed := time.Since(started); elapsed > 3*time.Second {
+		t.Fatalf("slot released after %s", elapsed)
+	}
+}
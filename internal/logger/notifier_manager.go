@@ -1,12 +1,30 @@
 package logger
 
 import (
+	"errors"
 	"fmt"
 	"github.com/godbus/dbus/v5"
 	"github.com/spf13/viper"
+	"io"
+	"log"
 	"net/http"
+	"reflect"
+	"sort"
+	"sync"
 )
 
+// NotifierChangeEvent describes how the set of notifiers changed after a configuration reconcile.
+type NotifierChangeEvent struct {
+	Added   []string // Names of notifiers created.
+	Updated []string // Names of notifiers recreated with a new definition.
+	Removed []string // Names of notifiers that vanished from the configuration.
+}
+
+// Empty reports whether the event carries no changes.
+func (e NotifierChangeEvent) Empty() bool {
+	return len(e.Added) == 0 && len(e.Updated) == 0 && len(e.Removed) == 0
+}
+
 // NotifierManager defines the interface for managing notifiers.
 type NotifierManager interface {
 	// WebServer returns the HTTP server instance.
@@ -30,8 +48,11 @@ type NotifierManager interface {
 	// ListNotifiers lists all registered notifier names.
 	ListNotifiers() []string
 
-	// UpdateFromConfig updates notifiers dynamically based on the provided configuration.
-	UpdateFromConfig() error
+	// UpdateFromConfig reconciles the notifiers declared under "notifiers" in the given configuration,
+	// adding, updating and removing them as needed.
+	UpdateFromConfig(vpr *viper.Viper) error
+	// OnChange registers a callback invoked whenever UpdateFromConfig changes the set of notifiers.
+	OnChange(fn func(NotifierChangeEvent))
 }
 
 // NotifierManagerImpl is the implementation of the NotifierManager interface.
@@ -43,6 +64,10 @@ type NotifierManagerImpl struct {
 	webClient  *http.Client
 	dbusClient *dbus.Conn
 	notifiers  map[string]Notifier
+	configured map[string]NotifierConfig // Definitions of the notifiers managed by the configuration file.
+	plugins    map[string]PluginConfig   // Plugin definitions used by the configured notifiers.
+	listeners  []func(NotifierChangeEvent)
+	mu         sync.RWMutex
 }
 
 // NewNotifierManager creates a new instance of NotifierManagerImpl.
@@ -51,30 +76,40 @@ func NewNotifierManager(notifiers map[string]Notifier) NotifierManager {
 		notifiers = make(map[string]Notifier)
 	}
 	return &NotifierManagerImpl{
-		notifiers: notifiers,
+		notifiers:  notifiers,
+		configured: make(map[string]NotifierConfig),
 	}
 }
 
 // AddNotifier adds or updates a notifier with the given name.
 func (nm *NotifierManagerImpl) AddNotifier(name string, notifier Notifier) {
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
 	nm.notifiers[name] = notifier
 	fmt.Printf("Notifier '%s' added/updated.\n", name)
 }
 
 // RemoveNotifier removes the notifier with the given name.
 func (nm *NotifierManagerImpl) RemoveNotifier(name string) {
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
 	delete(nm.notifiers, name)
+	delete(nm.configured, name)
 	fmt.Printf("Notifier '%s' removed.\n", name)
 }
 
 // GetNotifier retrieves the notifier with the given name.
 func (nm *NotifierManagerImpl) GetNotifier(name string) (Notifier, bool) {
+	nm.mu.RLock()
+	defer nm.mu.RUnlock()
 	notifier, ok := nm.notifiers[name]
 	return notifier, ok
 }
 
 // ListNotifiers lists all registered notifier names.
 func (nm *NotifierManagerImpl) ListNotifiers() []string {
+	nm.mu.RLock()
+	defer nm.mu.RUnlock()
 	keys := make([]string, 0, len(nm.notifiers))
 	for name := range nm.notifiers {
 		keys = append(keys, name)
@@ -82,39 +117,151 @@ func (nm *NotifierManagerImpl) ListNotifiers() []string {
 	return keys
 }
 
-// UpdateFromConfig updates notifiers dynamically based on the provided configuration.
-func (nm *NotifierManagerImpl) UpdateFromConfig() error {
-	var configNotifiers map[string]map[string]interface{}
-	if err := viper.UnmarshalKey("notifiers", &configNotifiers); err != nil {
+// UpdateFromConfig reconciles the notifiers declared under "notifiers" in the given configuration.
+// New definitions are created, changed ones are recreated and those that vanished from the
+// configuration are removed. Invalid entries are reported and leave any previous instance untouched.
+// Notifiers added programmatically through AddNotifier are never removed by a reconcile.
+func (nm *NotifierManagerImpl) UpdateFromConfig(vpr *viper.Viper) error {
+	if vpr == nil {
+		return errors.New("no configuration provided to update notifiers")
+	}
+
+	var configNotifiers map[string]NotifierConfig
+	if err := vpr.UnmarshalKey("notifiers", &configNotifiers); err != nil {
 		return fmt.Errorf("failed to parse notifiers config: %w", err)
 	}
 
-	// Update or recreate notifiers dynamically
+	var errs []error
+	var event NotifierChangeEvent
+	// Replaced and removed notifiers are closed once the lock is released, since closing may
+	// wait for a plugin or a queue to drain.
+	var retired []Notifier
+
+	plugins, pluginErr := loadPlugins(vpr)
+	if pluginErr != nil {
+		errs = append(errs, pluginErr)
+	}
+
+	nm.mu.Lock()
 	for name, conf := range configNotifiers {
-		typ, ok := conf["type"].(string)
-		if !ok {
-			fmt.Printf("Notifier '%s' does not specify a type and will be ignored.\n", name)
+		if err := conf.Validate(name, plugins); err != nil {
+			errs = append(errs, err)
+			if _, known := nm.configured[name]; known {
+				// Keep the previous definition alive until the entry is fixed.
+				configNotifiers[name] = nm.configured[name]
+			}
+			continue
+		}
+		previous, known := nm.configured[name]
+		samePlugin := reflect.DeepEqual(nm.plugins[conf.Type], plugins[conf.Type])
+		if known && previous.Equal(conf) && samePlugin {
 			continue
 		}
+		if previous, ok := nm.notifiers[name]; ok {
+			retired = append(retired, previous)
+		}
+		nm.notifiers[name] = conf.build(name, nm, plugins)
+		nm.configured[name] = conf
+		if known {
+			event.Updated = append(event.Updated, name)
+		} else {
+			event.Added = append(event.Added, name)
+		}
+	}
+	for name := range nm.configured {
+		if _, ok := configNotifiers[name]; ok {
+			continue
+		}
+		if previous, ok := nm.notifiers[name]; ok {
+			retired = append(retired, previous)
+		}
+		delete(nm.notifiers, name)
+		delete(nm.configured, name)
+		event.Removed = append(event.Removed, name)
+	}
+	nm.plugins = plugins
+	listeners := append([]func(NotifierChangeEvent){}, nm.listeners...)
+	nm.mu.Unlock()
+
+	for _, notifier := range retired {
+		closeNotifier(notifier)
+	}
 
-		switch typ {
-		case "http":
-			webhookURL, _ := conf["webhookURL"].(string)
-			authToken, _ := conf["authToken"].(string)
-			notifier := NewHTTPNotifier(webhookURL, authToken)
-			nm.AddNotifier(name, notifier)
-		case "zmq":
-			endpoint, _ := conf["endpoint"].(string)
-			notifier := NewZMQNotifier(endpoint)
-			nm.AddNotifier(name, notifier)
-		case "dbus":
-			notifier := NewDBusNotifier()
-			nm.AddNotifier(name, notifier)
-		default:
-			fmt.Printf("Unknown notifier type '%s' for notifier '%s'.\n", typ, name)
+	if !event.Empty() {
+		sort.Strings(event.Added)
+		sort.Strings(event.Updated)
+		sort.Strings(event.Removed)
+		log.Printf("Notifiers reconciled: added=%v updated=%v removed=%v\n", event.Added, event.Updated, event.Removed)
+		for _, fn := range listeners {
+			fn(event)
 		}
 	}
-	return nil
+
+	return errors.Join(errs...)
+}
+
+// closeNotifier releases the resources held by a replaced or removed notifier.
+func closeNotifier(notifier Notifier) {
+	if closer, ok := notifier.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			log.Printf("Error closing notifier: %v\n", err)
+		}
+	}
+}
+
+// closeAll removes and closes all the notifiers, once the configuration of the manager was discarded.
+func (nm *NotifierManagerImpl) closeAll() {
+	nm.mu.Lock()
+	notifiers := nm.notifiers
+	nm.notifiers, nm.configured = make(map[string]Notifier), make(map[string]NotifierConfig)
+	nm.mu.Unlock()
+
+	for _, notifier := range notifiers {
+		closeNotifier(notifier)
+	}
+}
+
+// fromConfig reports whether the notifier was built from the configuration file.
+func (nm *NotifierManagerImpl) fromConfig(name string) bool {
+	nm.mu.RLock()
+	defer nm.mu.RUnlock()
+	_, ok := nm.configured[name]
+	return ok
+}
+
+// handOver passes the manager's notifiers on to the manager of a reloaded configuration. Those
+// built from the configuration were rebuilt by the new manager and are closed; those added through
+// AddNotifier are moved over, as are the OnChange callbacks.
+func (nm *NotifierManagerImpl) handOver(to NotifierManager) {
+	nm.mu.Lock()
+	notifiers, configured, listeners := nm.notifiers, nm.configured, nm.listeners
+	nm.notifiers, nm.configured, nm.listeners = make(map[string]Notifier), make(map[string]NotifierConfig), nil
+	nm.mu.Unlock()
+
+	for name, notifier := range notifiers {
+		if _, fromConfig := configured[name]; fromConfig {
+			closeNotifier(notifier)
+			continue
+		}
+		if _, exists := to.GetNotifier(name); exists {
+			closeNotifier(notifier)
+			continue
+		}
+		to.AddNotifier(name, notifier)
+	}
+	for _, fn := range listeners {
+		to.OnChange(fn)
+	}
+}
+
+// OnChange registers a callback invoked whenever UpdateFromConfig changes the set of notifiers.
+func (nm *NotifierManagerImpl) OnChange(fn func(NotifierChangeEvent)) {
+	if fn == nil {
+		return
+	}
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+	nm.listeners = append(nm.listeners, fn)
 }
 
 // WebServer returns the HTTP server instance.
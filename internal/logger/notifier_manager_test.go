@@ -0,0 +1,119 @@
+package logger
+
+import (
+	"github.com/spf13/viper"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// notifierConfig returns a viper holding the JSON configuration.
+func notifierConfig(t *testing.T, content string) *viper.Viper {
+	t.Helper()
+	vpr := viper.New()
+	vpr.SetConfigType("json")
+	if err := vpr.ReadConfig(strings.NewReader(content)); err != nil {
+		t.Fatalf("invalid test configuration: %v", err)
+	}
+	return vpr
+}
+
+func TestNotifierManagerReconcile(t *testing.T) {
+	nm := NewNotifierManager(nil).(*NotifierManagerImpl)
+	var events []NotifierChangeEvent
+	nm.OnChange(func(e NotifierChangeEvent) { events = append(events, e) })
+
+	kept := newRecordingNotifier()
+	nm.AddNotifier("kept", kept)
+	// A notifier added programmatically is replaced once the configuration declares its name
+	overridden := newRecordingNotifier()
+	nm.AddNotifier("script", overridden)
+
+	apply := func(content string, want NotifierChangeEvent) {
+		t.Helper()
+		before := len(events)
+		if err := nm.UpdateFromConfig(notifierConfig(t, content)); err != nil {
+			t.Fatalf("UpdateFromConfig: %v", err)
+		}
+		if want.Empty() {
+			if len(events) != before {
+				t.Fatalf("unexpected event %+v", events[len(events)-1])
+			}
+			return
+		}
+		if len(events) != before+1 {
+			t.Fatalf("%d events emitted, want 1", len(events)-before)
+		}
+		if got := events[len(events)-1]; !reflect.DeepEqual(got, want) {
+			t.Fatalf("event = %+v, want %+v", got, want)
+		}
+	}
+	names := func(nm NotifierManager) []string {
+		list := nm.ListNotifiers()
+		sort.Strings(list)
+		return list
+	}
+
+	apply(`{"notifiers": {
+		"alerts": {"type": "exec", "command": "true", "throttle": {"window": "1h"}},
+		"audit": {"type": "exec", "command": "true"}
+	}}`, NotifierChangeEvent{Added: []string{"alerts", "audit"}})
+
+	// Throttling an entry leaves a pending summary, which closing the notifier drops
+	alerts, _ := nm.GetNotifier("alerts")
+	throttled := alerts.(*ThrottledNotifier)
+	if err := throttled.Notify(NewLogEntry().WithLevel(ERROR).WithMessage("disk full")); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+
+	apply(`{"notifiers": {
+		"alerts": {"type": "exec", "command": "true", "timeout": "2s", "throttle": {"window": "1h"}},
+		"script": {"type": "exec", "command": "true"}
+	}}`, NotifierChangeEvent{Added: []string{"script"}, Updated: []string{"alerts"}, Removed: []string{"audit"}})
+	if !overridden.closed {
+		t.Error("notifier replaced by the configuration not closed")
+	}
+	throttled.mu.Lock()
+	pending := len(throttled.states)
+	throttled.mu.Unlock()
+	if pending != 0 {
+		t.Error("replaced notifier not closed")
+	}
+
+	// The same configuration again changes nothing
+	apply(`{"notifiers": {
+		"alerts": {"type": "exec", "command": "true", "timeout": "2s", "throttle": {"window": "1h"}},
+		"script": {"type": "exec", "command": "true"}
+	}}`, NotifierChangeEvent{})
+
+	apply(`{"notifiers": {"alerts": {"type": "exec", "command": "true", "timeout": "2s", "throttle": {"window": "1h"}}}}`,
+		NotifierChangeEvent{Removed: []string{"script"}})
+	if got, want := names(nm), []string{"alerts", "kept"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("notifiers = %v, want %v", got, want)
+	}
+	if kept.closed {
+		t.Fatal("notifier added through AddNotifier closed by a reconcile")
+	}
+
+	// A reload builds a new manager: the added notifier and the callbacks move over to it, twice
+	for reload := 1; reload <= 2; reload++ {
+		next := NewNotifierManager(nil).(*NotifierManagerImpl)
+		if err := next.UpdateFromConfig(notifierConfig(t, `{"notifiers": {"audit": {"type": "exec", "command": "true"}}}`)); err != nil {
+			t.Fatalf("UpdateFromConfig: %v", err)
+		}
+		nm.handOver(next)
+		nm = next
+
+		if got, want := names(nm), []string{"audit", "kept"}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("reload %d: notifiers = %v, want %v", reload, got, want)
+		}
+		if n, _ := nm.GetNotifier("kept"); n != Notifier(kept) || kept.closed {
+			t.Fatalf("reload %d: added notifier not handed over", reload)
+		}
+		apply(`{"notifiers": {}}`, NotifierChangeEvent{Removed: []string{"audit"}})
+		if _, ok := nm.GetNotifier("kept"); !ok {
+			t.Fatalf("reload %d: added notifier removed by a reconcile", reload)
+		}
+	}
+}
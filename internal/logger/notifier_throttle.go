@@ -0,0 +1,234 @@
+package logger
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultFingerprintFields are the entry fields used to group repeated notifications.
+var defaultFingerprintFields = []string{"level", "source", "message"}
+
+var (
+	uuidRegex   = regexp.MustCompile(`(?i)\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`)
+	hexRegex    = regexp.MustCompile(`(?i)\b0x[0-9a-f]+\b|\b[0-9a-f]{16,}\b`)
+	numberRegex = regexp.MustCompile(`\d+`)
+	spaceRegex  = regexp.MustCompile(`\s+`)
+)
+
+// ThrottleConfig defines how repeated notifications are grouped and summarized.
+type ThrottleConfig struct {
+	Window          time.Duration `json:"window" mapstructure:"window"`                             // Quiet period after the last occurrence before a fingerprint is forgotten.
+	SummaryInterval time.Duration `json:"summaryInterval,omitempty" mapstructure:"summaryInterval"` // How often a "repeated N times" summary is sent, defaults to the window.
+	Fingerprint     []string      `json:"fingerprint,omitempty" mapstructure:"fingerprint"`         // Fields used to group entries: level, source, message, context, tag:<key>, metadata:<key>.
+}
+
+// Validate checks the throttle definition.
+func (tc *ThrottleConfig) Validate(name string) error {
+	if tc.Window <= 0 {
+		return fmt.Errorf("notifier '%s': throttle 'window' must be greater than zero", name)
+	}
+	if tc.SummaryInterval < 0 {
+		return fmt.Errorf("notifier '%s': throttle 'summaryInterval' must not be negative", name)
+	}
+	for _, field := range tc.Fingerprint {
+		switch {
+		case field == "level", field == "source", field == "message", field == "context":
+		case strings.HasPrefix(field, "tag:"), strings.HasPrefix(field, "metadata:"):
+		default:
+			return fmt.Errorf("notifier '%s': unknown throttle fingerprint field '%s'", name, field)
+		}
+	}
+	return nil
+}
+
+// throttleState tracks the occurrences of a single fingerprint.
+type throttleState struct {
+	last       *LogEntry
+	suppressed int
+	lastSeen   time.Time
+	timer      *time.Timer
+}
+
+// ThrottledNotifier wraps a Notifier and forwards only the first occurrence of a fingerprint
+// within the window, followed by periodic "repeated N times" summaries.
+type ThrottledNotifier struct {
+	Notifier
+	name            string
+	window          time.Duration
+	summaryInterval time.Duration
+	fields          []string
+	states          map[string]*throttleState
+	mu              sync.Mutex
+	now             func() time.Time // Clock of the window, replaced in tests
+}
+
+// NewThrottledNotifier wraps the given notifier with the provided throttle configuration.
+func NewThrottledNotifier(name string, notifier Notifier, cfg ThrottleConfig) *ThrottledNotifier {
+	fields := cfg.Fingerprint
+	if len(fields) == 0 {
+		fields = defaultFingerprintFields
+	}
+	summaryInterval := cfg.SummaryInterval
+	if summaryInterval <= 0 {
+		summaryInterval = cfg.Window
+	}
+	return &ThrottledNotifier{
+		Notifier:        notifier,
+		name:            name,
+		window:          cfg.Window,
+		summaryInterval: summaryInterval,
+		fields:          fields,
+		states:          make(map[string]*throttleState),
+		now:             time.Now,
+	}
+}
+
+// Notify forwards the entry unless an identical fingerprint was seen within the window.
+func (t *ThrottledNotifier) Notify(entry LogzEntry) error {
+	if !t.Enabled() {
+		return nil
+	}
+	le := cloneEntry(entry)
+	fp := Fingerprint(le, t.fields)
+	now := t.now()
+
+	t.mu.Lock()
+	state, seen := t.states[fp]
+	if seen {
+		state.suppressed++
+		state.last = le
+		state.lastSeen = now
+		t.mu.Unlock()
+		return nil
+	}
+	state = &throttleState{last: le, lastSeen: now}
+	state.timer = time.AfterFunc(t.summaryInterval, func() { t.tick(fp) })
+	t.states[fp] = state
+	t.mu.Unlock()
+
+	return t.Notifier.Notify(entry)
+}
+
+// accepts forwards the filters of the wrapped notifier.
+func (t *ThrottledNotifier) accepts(entry LogzEntry) bool {
+	if filter, ok := t.Notifier.(entryFilter); ok {
+		return filter.accepts(entry)
+	}
+	return t.Enabled()
+}
+
+// QueueDepth returns the number of entries held back for summaries, plus the queue of the
+// wrapped notifier.
+func (t *ThrottledNotifier) QueueDepth() int {
+	t.mu.Lock()
+	depth := 0
+	for _, state := range t.states {
+		depth += state.suppressed
+	}
+	t.mu.Unlock()
+	if inner, ok := t.Notifier.(QueueDepther); ok {
+		depth += inner.QueueDepth()
+	}
+	return depth
+}
+
+// tick sends the pending summary for a fingerprint, unless the notifier is silenced for it, and
+// forgets the fingerprint once the window has passed.
+func (t *ThrottledNotifier) tick(fp string) {
+	t.mu.Lock()
+	state, ok := t.states[fp]
+	if !ok {
+		t.mu.Unlock()
+		return
+	}
+	count := state.suppressed
+	last := state.last
+	state.suppressed = 0
+	if count == 0 && t.now().Sub(state.lastSeen) >= t.window {
+		delete(t.states, fp)
+	} else {
+		state.timer.Reset(t.summaryInterval)
+	}
+	t.mu.Unlock()
+
+	if count == 0 {
+		return
+	}
+	summary := *last
+	summary.Message = fmt.Sprintf("%s (repeated %d times)", last.Message, count)
+	summary.Metadata = mergeContext(last.Metadata, map[string]interface{}{"repeated": count})
+	// The summary goes through the same checks as the entries dispatched by the logger
+	if GetSilenceStore().Silenced(t.name, &summary) {
+		return
+	}
+	started := time.Now()
+	err := t.Notifier.Notify(&summary)
+	recordNotification(t.name, time.Since(started), err)
+	if err != nil {
+		log.Printf("Error notifying %s: %v", t.name, err)
+	}
+}
+
+// Close stops pending summaries and closes the wrapped notifier if it holds resources.
+func (t *ThrottledNotifier) Close() error {
+	t.mu.Lock()
+	for fp, state := range t.states {
+		state.timer.Stop()
+		delete(t.states, fp)
+	}
+	t.mu.Unlock()
+	if closer, ok := t.Notifier.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// Fingerprint computes the grouping key of an entry from the given fields.
+func Fingerprint(le *LogEntry, fields []string) string {
+	parts := make([]string, 0, len(fields))
+	for _, field := range fields {
+		switch {
+		case field == "level":
+			parts = append(parts, string(le.Level))
+		case field == "source":
+			parts = append(parts, le.Source)
+		case field == "message":
+			parts = append(parts, NormalizeMessage(le.Message))
+		case field == "context":
+			parts = append(parts, le.Context)
+		case strings.HasPrefix(field, "tag:"):
+			parts = append(parts, le.Tags[strings.TrimPrefix(field, "tag:")])
+		case strings.HasPrefix(field, "metadata:"):
+			parts = append(parts, fmt.Sprintf("%v", le.Metadata[strings.TrimPrefix(field, "metadata:")]))
+		}
+	}
+	sum := sha1.Sum([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+// NormalizeMessage replaces volatile parts of a message (ids, numbers, whitespace) so that
+// repeated messages differing only in those parts share a fingerprint.
+func NormalizeMessage(msg string) string {
+	msg = uuidRegex.ReplaceAllString(msg, "<uuid>")
+	msg = hexRegex.ReplaceAllString(msg, "<hex>")
+	msg = numberRegex.ReplaceAllString(msg, "<n>")
+	msg = spaceRegex.ReplaceAllString(msg, " ")
+	return strings.TrimSpace(strings.ToLower(msg))
+}
+
+// cloneEntry returns a standalone LogEntry copy of any LogzEntry implementation.
+func cloneEntry(entry LogzEntry) *LogEntry {
+	var le LogEntry
+	if data, err := json.Marshal(entry); err == nil {
+		_ = json.Unmarshal(data, &le)
+	}
+	return &le
+}
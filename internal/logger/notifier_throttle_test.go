@@ -0,0 +1,143 @@
+package logger
+
+import (
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingNotifier is an enabled notifier keeping the messages it was notified of.
+type recordingNotifier struct {
+	NotifierImpl
+	mu       sync.Mutex
+	messages []string
+	closed   bool
+}
+
+func newRecordingNotifier() *recordingNotifier {
+	return &recordingNotifier{NotifierImpl: NotifierImpl{EnabledFlag: true}}
+}
+
+func (n *recordingNotifier) Notify(entry LogzEntry) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.messages = append(n.messages, entry.GetMessage())
+	return nil
+}
+
+func (n *recordingNotifier) Close() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.closed = true
+	return nil
+}
+
+func (n *recordingNotifier) received() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]string(nil), n.messages...)
+}
+
+// fakeClock is a settable clock for the time-dependent notifiers.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestThrottledNotifierWindow(t *testing.T) {
+	t.Setenv("LOGZ_SILENCES_FILE", filepath.Join(t.TempDir(), "silences.json"))
+	clock := newFakeClock()
+	inner := newRecordingNotifier()
+	// The timers never fire during the test: the summaries are sent by calling tick
+	n := NewThrottledNotifier("test", inner, ThrottleConfig{Window: time.Hour, SummaryInterval: 10 * time.Minute})
+	n.now = clock.Now
+	n.Enable()
+	defer n.Close()
+
+	notify := func(msg string) {
+		t.Helper()
+		if err := n.Notify(NewLogEntry().WithLevel(ERROR).WithSource("db").WithMessage(msg)); err != nil {
+			t.Fatalf("Notify: %v", err)
+		}
+	}
+	expect := func(want ...string) {
+		t.Helper()
+		if got := inner.received(); !reflect.DeepEqual(got, want) {
+			t.Fatalf("notified %q, want %q", got, want)
+		}
+	}
+	fp := Fingerprint(NewLogEntry().WithLevel(ERROR).WithSource("db").WithMessage("query 1 failed").(*LogEntry), n.fields)
+
+	notify("query 1 failed")
+	notify("query 2 failed")
+	notify("query 3 failed")
+	notify("connection lost")
+	expect("query 1 failed", "connection lost")
+	if depth := n.QueueDepth(); depth != 2 {
+		t.Fatalf("QueueDepth = %d, want 2", depth)
+	}
+
+	clock.Advance(10 * time.Minute)
+	n.tick(fp)
+	expect("query 1 failed", "connection lost", "query 3 failed (repeated 2 times)")
+
+	// Nothing to summarize: the fingerprint is kept until the window has passed since the last occurrence
+	clock.Advance(10 * time.Minute)
+	n.tick(fp)
+	notify("query 4 failed")
+	clock.Advance(55 * time.Minute)
+	n.tick(fp)
+	expect("query 1 failed", "connection lost", "query 3 failed (repeated 2 times)", "query 4 failed (repeated 1 times)")
+
+	clock.Advance(time.Hour)
+	n.tick(fp)
+	n.mu.Lock()
+	_, kept := n.states[fp]
+	n.mu.Unlock()
+	if kept {
+		t.Fatal("fingerprint kept after the window")
+	}
+	notify("query 5 failed")
+	expect("query 1 failed", "connection lost", "query 3 failed (repeated 2 times)", "query 4 failed (repeated 1 times)", "query 5 failed")
+}
+
+func TestThrottledNotifierFingerprintFields(t *testing.T) {
+	clock := newFakeClock()
+	inner := newRecordingNotifier()
+	n := NewThrottledNotifier("test", inner, ThrottleConfig{Window: time.Hour, Fingerprint: []string{"tag:host"}})
+	n.now = clock.Now
+	n.Enable()
+	defer n.Close()
+
+	for _, tc := range []struct{ host, msg string }{{"a", "one"}, {"a", "two"}, {"b", "three"}} {
+		entry := NewLogEntry().WithLevel(ERROR).WithMessage(tc.msg)
+		entry.AddTag("host", tc.host)
+		if err := n.Notify(entry); err != nil {
+			t.Fatalf("Notify: %v", err)
+		}
+	}
+	if got, want := inner.received(), []string{"one", "three"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("notified %q, want %q", got, want)
+	}
+	if err := n.Close(); err != nil || !inner.closed {
+		t.Fatalf("Close = %v, inner closed = %v", err, inner.closed)
+	}
+}
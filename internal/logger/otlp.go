@@ -0,0 +1,997 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OTLP/HTTP logs (https://opentelemetry.io/docs/specs/otlp/), in both the JSON and the binary
+// protobuf encodings. The messages are modelled by the otlp* types below, which follow the OTLP
+// JSON mapping, and are converted to and from protobuf by hand, like the remote-write encoder.
+
+const (
+	otlpIntegration  = "otlp"     // Integration whose receiver also serves otlpLogsPath.
+	otlpLogsPath     = "/v1/logs" // Path of the OTLP/HTTP logs endpoint.
+	otlpScopeName    = "logz"
+	otlpTagPrefix    = "logz.tag."     // Attributes carrying the tags of an entry.
+	otlpContextAttr  = "logz.context"  // Attribute carrying the context of an entry.
+	otlpCallerAttr   = "logz.caller"   // Attribute carrying the caller of an entry.
+	otlpTraceIDAttr  = "logz.trace_id" // Attribute carrying a trace ID that is not a W3C trace ID.
+	otlpSpanIDKey    = "span_id"       // Metadata receiving the span ID of a record.
+	contentTypeJSON  = "application/json"
+	contentTypeProto = "application/x-protobuf"
+	// otlpMaxValueDepth bounds the nesting of array and key-value list values in protobuf requests
+	otlpMaxValueDepth = 32
+)
+
+// otlpSeverities maps the log levels to the OTLP severity numbers.
+var otlpSeverities = map[LogLevel]int{
+	DEBUG: 5,
+	INFO:  9,
+	WARN:  13,
+	ERROR: 17,
+	FATAL: 21,
+}
+
+// otlpLevel maps an OTLP severity number to a log level, falling back on the severity text for
+// records without one, and to INFO.
+func otlpLevel(number int, text string) LogLevel {
+	switch {
+	case number >= 21:
+		return FATAL
+	case number >= 17:
+		return ERROR
+	case number >= 13:
+		return WARN
+	case number >= 9:
+		return INFO
+	case number >= 1:
+		return DEBUG
+	}
+	level := LogLevel(strings.ToUpper(text))
+	switch level {
+	case "WARNING":
+		return WARN
+	case "TRACE":
+		return DEBUG
+	case "CRITICAL", "PANIC":
+		return FATAL
+	}
+	if _, ok := logLevels[level]; ok {
+		return level
+	}
+	return INFO
+}
+
+// otlpInt is a 64-bit integer, sent as a string in OTLP JSON. Both strings and numbers are accepted.
+type otlpInt int64
+
+func (i otlpInt) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(strconv.FormatInt(int64(i), 10))), nil
+}
+
+func (i *otlpInt) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	if s == "" || s == "null" {
+		*i = 0
+		return nil
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		u, uErr := strconv.ParseUint(s, 10, 64)
+		if uErr != nil {
+			return fmt.Errorf("invalid integer %s", data)
+		}
+		n = int64(u)
+	}
+	*i = otlpInt(n)
+	return nil
+}
+
+// otlpLogsData is an ExportLogsServiceRequest.
+type otlpLogsData struct {
+	ResourceLogs []otlpResourceLogs `json:"resourceLogs"`
+}
+
+type otlpResourceLogs struct {
+	Resource  otlpResource    `json:"resource"`
+	ScopeLogs []otlpScopeLogs `json:"scopeLogs"`
+	SchemaURL string          `json:"schemaUrl,omitempty"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+type otlpScopeLogs struct {
+	Scope      otlpScope       `json:"scope"`
+	LogRecords []otlpLogRecord `json:"logRecords"`
+	SchemaURL  string          `json:"schemaUrl,omitempty"`
+}
+
+type otlpScope struct {
+	Name    string `json:"name,omitempty"`
+	Version string `json:"version,omitempty"`
+}
+
+type otlpLogRecord struct {
+	TimeUnixNano         otlpInt        `json:"timeUnixNano,omitempty"`
+	ObservedTimeUnixNano otlpInt        `json:"observedTimeUnixNano,omitempty"`
+	SeverityNumber       int            `json:"severityNumber,omitempty"`
+	SeverityText         string         `json:"severityText,omitempty"`
+	Body                 *otlpAnyValue  `json:"body,omitempty"`
+	Attributes           []otlpKeyValue `json:"attributes,omitempty"`
+	Flags                uint32         `json:"flags,omitempty"`
+	TraceID              string         `json:"traceId,omitempty"` // Hex encoded, as in OTLP JSON.
+	SpanID               string         `json:"spanId,omitempty"`  // Hex encoded, as in OTLP JSON.
+	EventName            string         `json:"eventName,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue *string         `json:"stringValue,omitempty"`
+	BoolValue   *bool           `json:"boolValue,omitempty"`
+	IntValue    *otlpInt        `json:"intValue,omitempty"`
+	DoubleValue *float64        `json:"doubleValue,omitempty"`
+	ArrayValue  *otlpArrayValue `json:"arrayValue,omitempty"`
+	KvlistValue *otlpKvlist     `json:"kvlistValue,omitempty"`
+	BytesValue  []byte          `json:"bytesValue,omitempty"` // Base64 encoded in JSON.
+}
+
+type otlpArrayValue struct {
+	Values []otlpAnyValue `json:"values"`
+}
+
+type otlpKvlist struct {
+	Values []otlpKeyValue `json:"values"`
+}
+
+// otlpPartialSuccess is the partial success of an ExportLogsServiceResponse.
+type otlpPartialSuccess struct {
+	RejectedLogRecords otlpInt `json:"rejectedLogRecords,omitempty"`
+	ErrorMessage       string  `json:"errorMessage,omitempty"`
+}
+
+// otlpExportResponse is an ExportLogsServiceResponse.
+type otlpExportResponse struct {
+	PartialSuccess *otlpPartialSuccess `json:"partialSuccess,omitempty"`
+}
+
+// otlpStatus is the google.rpc.Status body of failed OTLP responses.
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// toOTLPValue converts a metadata value to an OTLP value. Numbers decoded from JSON are sent as
+// integers when they are integral.
+func toOTLPValue(value interface{}) otlpAnyValue {
+	switch v := value.(type) {
+	case nil:
+		return otlpAnyValue{}
+	case string:
+		return otlpAnyValue{StringValue: &v}
+	case bool:
+		return otlpAnyValue{BoolValue: &v}
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		n, _ := strconv.ParseInt(fmt.Sprint(v), 10, 64)
+		i := otlpInt(n)
+		return otlpAnyValue{IntValue: &i}
+	case float32:
+		f := float64(v)
+		return otlpAnyValue{DoubleValue: &f}
+	case float64:
+		return otlpAnyValue{DoubleValue: &v}
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			i := otlpInt(n)
+			return otlpAnyValue{IntValue: &i}
+		}
+		f, _ := v.Float64()
+		return otlpAnyValue{DoubleValue: &f}
+	case []byte:
+		return otlpAnyValue{BytesValue: v}
+	case []interface{}:
+		array := &otlpArrayValue{Values: make([]otlpAnyValue, 0, len(v))}
+		for _, item := range v {
+			array.Values = append(array.Values, toOTLPValue(item))
+		}
+		return otlpAnyValue{ArrayValue: array}
+	case map[string]interface{}:
+		return otlpAnyValue{KvlistValue: &otlpKvlist{Values: toOTLPAttributes(v)}}
+	default:
+		s := fmt.Sprint(v)
+		return otlpAnyValue{StringValue: &s}
+	}
+}
+
+// toOTLPAttributes converts a map to attributes, sorted by key.
+func toOTLPAttributes(values map[string]interface{}) []otlpKeyValue {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	attrs := make([]otlpKeyValue, 0, len(keys))
+	for _, key := range keys {
+		attrs = append(attrs, otlpKeyValue{Key: key, Value: toOTLPValue(values[key])})
+	}
+	return attrs
+}
+
+// value converts an OTLP value back to a metadata value.
+func (v otlpAnyValue) value() interface{} {
+	switch {
+	case v.StringValue != nil:
+		return *v.StringValue
+	case v.BoolValue != nil:
+		return *v.BoolValue
+	case v.IntValue != nil:
+		return int64(*v.IntValue)
+	case v.DoubleValue != nil:
+		return *v.DoubleValue
+	case v.ArrayValue != nil:
+		items := make([]interface{}, 0, len(v.ArrayValue.Values))
+		for _, item := range v.ArrayValue.Values {
+			items = append(items, item.value())
+		}
+		return items
+	case v.KvlistValue != nil:
+		values := make(map[string]interface{}, len(v.KvlistValue.Values))
+		for _, kv := range v.KvlistValue.Values {
+			values[kv.Key] = kv.Value.value()
+		}
+		return values
+	case v.BytesValue != nil:
+		return v.BytesValue
+	default:
+		return nil
+	}
+}
+
+// text returns the value as a message: strings as they are, other values in JSON.
+func (v otlpAnyValue) text() string {
+	if v.StringValue != nil {
+		return *v.StringValue
+	}
+	value := v.value()
+	if value == nil {
+		return ""
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
+
+// encodeOTLPLogs maps the entries to an OTLP request. Entries are grouped into resources by
+// source (service.name), hostname (host.name) and pid (process.pid), to which the extra resource
+// attributes are added. Metadata becomes the record attributes, and tags, context and caller
+// are kept in logz.* attributes.
+func encodeOTLPLogs(entries []*LogEntry, resource map[string]string, observed time.Time) otlpLogsData {
+	type resourceKey struct {
+		source, hostname string
+		pid              int
+	}
+	var data otlpLogsData
+	index := make(map[resourceKey]int)
+	for _, entry := range entries {
+		key := resourceKey{entry.Source, entry.Hostname, entry.ProcessID}
+		i, ok := index[key]
+		if !ok {
+			attrs := make(map[string]interface{}, len(resource)+3)
+			for k, v := range resource {
+				attrs[k] = v
+			}
+			if entry.Source != "" {
+				attrs["service.name"] = entry.Source
+			}
+			if entry.Hostname != "" {
+				attrs["host.name"] = entry.Hostname
+			}
+			if entry.ProcessID != 0 {
+				attrs["process.pid"] = entry.ProcessID
+			}
+			i = len(data.ResourceLogs)
+			index[key] = i
+			data.ResourceLogs = append(data.ResourceLogs, otlpResourceLogs{
+				Resource:  otlpResource{Attributes: toOTLPAttributes(attrs)},
+				ScopeLogs: []otlpScopeLogs{{Scope: otlpScope{Name: otlpScopeName}}},
+			})
+		}
+		scope := &data.ResourceLogs[i].ScopeLogs[0]
+		scope.LogRecords = append(scope.LogRecords, toOTLPRecord(entry, observed))
+	}
+	return data
+}
+
+// toOTLPRecord maps an entry to a log record.
+func toOTLPRecord(entry *LogEntry, observed time.Time) otlpLogRecord {
+	attrs := make(map[string]interface{}, len(entry.Metadata)+len(entry.Tags)+2)
+	for k, v := range entry.Metadata {
+		attrs[k] = v
+	}
+	for k, v := range entry.Tags {
+		attrs[otlpTagPrefix+k] = v
+	}
+	if entry.Context != "" {
+		attrs[otlpContextAttr] = entry.Context
+	}
+	if entry.Caller != "" {
+		attrs[otlpCallerAttr] = entry.Caller
+	}
+	record := otlpLogRecord{
+		ObservedTimeUnixNano: otlpInt(observed.UnixNano()),
+		SeverityNumber:       otlpSeverities[entry.Level],
+		SeverityText:         string(entry.Level),
+		Body:                 &otlpAnyValue{StringValue: &entry.Message},
+	}
+	if !entry.Timestamp.IsZero() {
+		record.TimeUnixNano = otlpInt(entry.Timestamp.UnixNano())
+	}
+	if traceID, err := hex.DecodeString(entry.TraceID); err == nil && len(traceID) == 16 {
+		record.TraceID = strings.ToLower(entry.TraceID)
+	} else if entry.TraceID != "" {
+		attrs[otlpTraceIDAttr] = entry.TraceID
+	}
+	record.Attributes = toOTLPAttributes(attrs)
+	return record
+}
+
+// decodeOTLPLogs maps an OTLP request to entries. The source comes from service.name, the
+// hostname from host.name and the pid from process.pid; the other resource attributes and the
+// record attributes become metadata, except the logz.* attributes set by encodeOTLPLogs. Invalid
+// records are reported by index across the whole request.
+func decodeOTLPLogs(data otlpLogsData, received time.Time) ([]*LogEntry, IngestResult) {
+	var entries []*LogEntry
+	result := IngestResult{}
+	index := 0
+	for _, rl := range data.ResourceLogs {
+		resource := make(map[string]interface{}, len(rl.Resource.Attributes))
+		for _, kv := range rl.Resource.Attributes {
+			resource[kv.Key] = kv.Value.value()
+		}
+		for _, sl := range rl.ScopeLogs {
+			for _, record := range sl.LogRecords {
+				entry, err := fromOTLPRecord(record, resource, sl.Scope.Name, received)
+				if err != nil {
+					result.Rejected++
+					result.Errors = append(result.Errors, IngestError{Index: index, Error: err.Error()})
+				} else {
+					result.Accepted++
+					entries = append(entries, entry)
+				}
+				index++
+			}
+		}
+	}
+	return entries, result
+}
+
+// fromOTLPRecord maps a log record and the attributes of its resource to an entry.
+func fromOTLPRecord(record otlpLogRecord, resource map[string]interface{}, scope string, received time.Time) (*LogEntry, error) {
+	level := otlpLevel(record.SeverityNumber, record.SeverityText)
+	entry := &LogEntry{
+		Level:    level,
+		Severity: logLevels[level],
+		Tags:     make(map[string]string),
+		Metadata: make(map[string]interface{}),
+	}
+	switch {
+	case record.TimeUnixNano > 0:
+		entry.Timestamp = time.Unix(0, int64(record.TimeUnixNano))
+	case record.ObservedTimeUnixNano > 0:
+		entry.Timestamp = time.Unix(0, int64(record.ObservedTimeUnixNano))
+	default:
+		entry.Timestamp = received
+	}
+
+	for key, value := range resource {
+		switch key {
+		case "service.name":
+			entry.Source = fmt.Sprint(value)
+		case "host.name":
+			entry.Hostname = fmt.Sprint(value)
+		case "process.pid":
+			if pid, ok := value.(int64); ok {
+				entry.ProcessID = int(pid)
+			}
+		default:
+			entry.Metadata[key] = value
+		}
+	}
+	for _, kv := range record.Attributes {
+		switch {
+		case strings.HasPrefix(kv.Key, otlpTagPrefix):
+			entry.Tags[strings.TrimPrefix(kv.Key, otlpTagPrefix)] = kv.Value.text()
+		case kv.Key == otlpContextAttr:
+			entry.Context = kv.Value.text()
+		case kv.Key == otlpCallerAttr:
+			entry.Caller = kv.Value.text()
+		case kv.Key == otlpTraceIDAttr:
+			entry.TraceID = kv.Value.text()
+		default:
+			entry.Metadata[kv.Key] = kv.Value.value()
+		}
+	}
+
+	if record.TraceID != "" {
+		entry.TraceID = strings.ToLower(record.TraceID)
+	}
+	if record.SpanID != "" {
+		entry.Metadata[otlpSpanIDKey] = strings.ToLower(record.SpanID)
+	}
+	if record.EventName != "" {
+		entry.Metadata["event.name"] = record.EventName
+	}
+	if record.Body != nil {
+		entry.Message = record.Body.text()
+	}
+	if entry.Message == "" {
+		entry.Message = "-"
+	}
+	if entry.Source == "" {
+		entry.Source = getOrDefault(scope, otlpIntegration)
+	}
+	return entry, entry.Validate()
+}
+
+// Protobuf encoding:
+//
+//	ExportLogsServiceRequest { repeated ResourceLogs resource_logs = 1; }
+//	ResourceLogs      { Resource resource = 1; repeated ScopeLogs scope_logs = 2; string schema_url = 3; }
+//	Resource          { repeated KeyValue attributes = 1; }
+//	ScopeLogs         { InstrumentationScope scope = 1; repeated LogRecord log_records = 2; string schema_url = 3; }
+//	InstrumentationScope { string name = 1; string version = 2; }
+//	LogRecord         { fixed64 time_unix_nano = 1; SeverityNumber severity_number = 2; string severity_text = 3;
+//	                    AnyValue body = 5; repeated KeyValue attributes = 6; fixed32 flags = 8; bytes trace_id = 9;
+//	                    bytes span_id = 10; fixed64 observed_time_unix_nano = 11; string event_name = 12; }
+//	KeyValue          { string key = 1; AnyValue value = 2; }
+//	AnyValue          { oneof { string string_value = 1; bool bool_value = 2; int64 int_value = 3; double double_value = 4;
+//	                    ArrayValue array_value = 5; KeyValueList kvlist_value = 6; bytes bytes_value = 7; } }
+//	ArrayValue        { repeated AnyValue values = 1; }
+//	KeyValueList      { repeated KeyValue values = 1; }
+
+// marshalProto encodes the request in protobuf.
+func (d otlpLogsData) marshalProto() []byte {
+	var b []byte
+	for _, rl := range d.ResourceLogs {
+		b = protoAppendBytes(b, 1, rl.marshalProto())
+	}
+	return b
+}
+
+func (rl otlpResourceLogs) marshalProto() []byte {
+	var resource []byte
+	for _, kv := range rl.Resource.Attributes {
+		resource = protoAppendBytes(resource, 1, kv.marshalProto())
+	}
+	b := protoAppendBytes(nil, 1, resource)
+	for _, sl := range rl.ScopeLogs {
+		var scope []byte
+		if sl.Scope.Name != "" {
+			scope = protoAppendString(scope, 1, sl.Scope.Name)
+		}
+		if sl.Scope.Version != "" {
+			scope = protoAppendString(scope, 2, sl.Scope.Version)
+		}
+		s := protoAppendBytes(nil, 1, scope)
+		for _, record := range sl.LogRecords {
+			s = protoAppendBytes(s, 2, record.marshalProto())
+		}
+		if sl.SchemaURL != "" {
+			s = protoAppendString(s, 3, sl.SchemaURL)
+		}
+		b = protoAppendBytes(b, 2, s)
+	}
+	if rl.SchemaURL != "" {
+		b = protoAppendString(b, 3, rl.SchemaURL)
+	}
+	return b
+}
+
+func (r otlpLogRecord) marshalProto() []byte {
+	var b []byte
+	if r.TimeUnixNano != 0 {
+		b = protoAppendTag(b, 1, 1)
+		b = binary.LittleEndian.AppendUint64(b, uint64(r.TimeUnixNano))
+	}
+	if r.SeverityNumber != 0 {
+		b = protoAppendTag(b, 2, 0)
+		b = binary.AppendUvarint(b, uint64(r.SeverityNumber))
+	}
+	if r.SeverityText != "" {
+		b = protoAppendString(b, 3, r.SeverityText)
+	}
+	if r.Body != nil {
+		b = protoAppendBytes(b, 5, r.Body.marshalProto())
+	}
+	for _, kv := range r.Attributes {
+		b = protoAppendBytes(b, 6, kv.marshalProto())
+	}
+	if r.Flags != 0 {
+		b = protoAppendTag(b, 8, 5)
+		b = binary.LittleEndian.AppendUint32(b, r.Flags)
+	}
+	if id, err := hex.DecodeString(r.TraceID); err == nil && len(id) > 0 {
+		b = protoAppendBytes(b, 9, id)
+	}
+	if id, err := hex.DecodeString(r.SpanID); err == nil && len(id) > 0 {
+		b = protoAppendBytes(b, 10, id)
+	}
+	if r.ObservedTimeUnixNano != 0 {
+		b = protoAppendTag(b, 11, 1)
+		b = binary.LittleEndian.AppendUint64(b, uint64(r.ObservedTimeUnixNano))
+	}
+	if r.EventName != "" {
+		b = protoAppendString(b, 12, r.EventName)
+	}
+	return b
+}
+
+func (kv otlpKeyValue) marshalProto() []byte {
+	b := protoAppendString(nil, 1, kv.Key)
+	return protoAppendBytes(b, 2, kv.Value.marshalProto())
+}
+
+func (v otlpAnyValue) marshalProto() []byte {
+	var b []byte
+	switch {
+	case v.StringValue != nil:
+		b = protoAppendString(b, 1, *v.StringValue)
+	case v.BoolValue != nil:
+		b = protoAppendTag(b, 2, 0)
+		if *v.BoolValue {
+			b = append(b, 1)
+		} else {
+			b = append(b, 0)
+		}
+	case v.IntValue != nil:
+		b = protoAppendTag(b, 3, 0)
+		b = binary.AppendUvarint(b, uint64(*v.IntValue))
+	case v.DoubleValue != nil:
+		b = protoAppendTag(b, 4, 1)
+		b = binary.LittleEndian.AppendUint64(b, math.Float64bits(*v.DoubleValue))
+	case v.ArrayValue != nil:
+		var array []byte
+		for _, item := range v.ArrayValue.Values {
+			array = protoAppendBytes(array, 1, item.marshalProto())
+		}
+		b = protoAppendBytes(b, 5, array)
+	case v.KvlistValue != nil:
+		var list []byte
+		for _, kv := range v.KvlistValue.Values {
+			list = protoAppendBytes(list, 1, kv.marshalProto())
+		}
+		b = protoAppendBytes(b, 6, list)
+	case v.BytesValue != nil:
+		b = protoAppendBytes(b, 7, v.BytesValue)
+	}
+	return b
+}
+
+// protoField is a field read from a protobuf message: the integer of varint and fixed fields,
+// the data of length-delimited ones.
+type protoField struct {
+	num  int
+	wire int
+	int  uint64
+	data []byte
+}
+
+// protoReadFields calls fn for each field of a protobuf message.
+func protoReadFields(b []byte, fn func(f protoField) error) error {
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return errors.New("invalid protobuf field key")
+		}
+		b = b[n:]
+		f := protoField{num: int(key >> 3), wire: int(key & 7)}
+		switch f.wire {
+		case 0:
+			f.int, n = binary.Uvarint(b)
+			if n <= 0 {
+				return errors.New("invalid protobuf varint")
+			}
+			b = b[n:]
+		case 1:
+			if len(b) < 8 {
+				return errors.New("truncated protobuf fixed64")
+			}
+			f.int, b = binary.LittleEndian.Uint64(b), b[8:]
+		case 2:
+			length, n := binary.Uvarint(b)
+			if n <= 0 || length > uint64(len(b)-n) {
+				return errors.New("truncated protobuf field")
+			}
+			f.data, b = b[n:n+int(length)], b[n+int(length):]
+		case 5:
+			if len(b) < 4 {
+				return errors.New("truncated protobuf fixed32")
+			}
+			f.int, b = uint64(binary.LittleEndian.Uint32(b)), b[4:]
+		default:
+			return fmt.Errorf("unsupported protobuf wire type %d", f.wire)
+		}
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unmarshalProto decodes a protobuf request. Unknown fields are skipped.
+func (d *otlpLogsData) unmarshalProto(b []byte) error {
+	return protoReadFields(b, func(f protoField) error {
+		if f.num != 1 || f.wire != 2 {
+			return nil
+		}
+		var rl otlpResourceLogs
+		if err := rl.unmarshalProto(f.data); err != nil {
+			return err
+		}
+		d.ResourceLogs = append(d.ResourceLogs, rl)
+		return nil
+	})
+}
+
+func (rl *otlpResourceLogs) unmarshalProto(b []byte) error {
+	return protoReadFields(b, func(f protoField) error {
+		if f.wire != 2 {
+			return nil
+		}
+		switch f.num {
+		case 1:
+			return protoReadFields(f.data, func(f protoField) error {
+				if f.num != 1 || f.wire != 2 {
+					return nil
+				}
+				kv, err := unmarshalOTLPKeyValue(f.data, 0)
+				rl.Resource.Attributes = append(rl.Resource.Attributes, kv)
+				return err
+			})
+		case 2:
+			var sl otlpScopeLogs
+			if err := sl.unmarshalProto(f.data); err != nil {
+				return err
+			}
+			rl.ScopeLogs = append(rl.ScopeLogs, sl)
+		case 3:
+			rl.SchemaURL = string(f.data)
+		}
+		return nil
+	})
+}
+
+func (sl *otlpScopeLogs) unmarshalProto(b []byte) error {
+	return protoReadFields(b, func(f protoField) error {
+		if f.wire != 2 {
+			return nil
+		}
+		switch f.num {
+		case 1:
+			return protoReadFields(f.data, func(f protoField) error {
+				switch {
+				case f.num == 1 && f.wire == 2:
+					sl.Scope.Name = string(f.data)
+				case f.num == 2 && f.wire == 2:
+					sl.Scope.Version = string(f.data)
+				}
+				return nil
+			})
+		case 2:
+			var record otlpLogRecord
+			if err := record.unmarshalProto(f.data); err != nil {
+				return err
+			}
+			sl.LogRecords = append(sl.LogRecords, record)
+		case 3:
+			sl.SchemaURL = string(f.data)
+		}
+		return nil
+	})
+}
+
+func (r *otlpLogRecord) unmarshalProto(b []byte) error {
+	return protoReadFields(b, func(f protoField) error {
+		switch f.num {
+		case 1:
+			r.TimeUnixNano = otlpInt(f.int)
+		case 2:
+			r.SeverityNumber = int(f.int)
+		case 3:
+			r.SeverityText = string(f.data)
+		case 5:
+			body, err := unmarshalOTLPValue(f.data, 0)
+			if err != nil {
+				return err
+			}
+			r.Body = &body
+		case 6:
+			if f.wire != 2 {
+				return nil
+			}
+			kv, err := unmarshalOTLPKeyValue(f.data, 0)
+			if err != nil {
+				return err
+			}
+			r.Attributes = append(r.Attributes, kv)
+		case 8:
+			r.Flags = uint32(f.int)
+		case 9:
+			r.TraceID = hex.EncodeToString(f.data)
+		case 10:
+			r.SpanID = hex.EncodeToString(f.data)
+		case 11:
+			r.ObservedTimeUnixNano = otlpInt(f.int)
+		case 12:
+			r.EventName = string(f.data)
+		}
+		return nil
+	})
+}
+
+// unmarshalOTLPKeyValue decodes a KeyValue whose value is nested depth levels deep.
+func unmarshalOTLPKeyValue(b []byte, depth int) (otlpKeyValue, error) {
+	var kv otlpKeyValue
+	err := protoReadFields(b, func(f protoField) error {
+		switch {
+		case f.num == 1 && f.wire == 2:
+			kv.Key = string(f.data)
+		case f.num == 2 && f.wire == 2:
+			value, err := unmarshalOTLPValue(f.data, depth)
+			if err != nil {
+				return err
+			}
+			kv.Value = value
+		}
+		return nil
+	})
+	return kv, err
+}
+
+// unmarshalOTLPValue decodes an AnyValue nested depth levels deep. Arrays and key-value lists
+// deeper than otlpMaxValueDepth are rejected: the decoder recurses, and a small gzipped body
+// could otherwise nest values until the stack overflows.
+func unmarshalOTLPValue(b []byte, depth int) (otlpAnyValue, error) {
+	var v otlpAnyValue
+	if depth > otlpMaxValueDepth {
+		return v, fmt.Errorf("values nested deeper than %d levels", otlpMaxValueDepth)
+	}
+	err := protoReadFields(b, func(f protoField) error {
+		switch f.num {
+		case 1:
+			s := string(f.data)
+			v.StringValue = &s
+		case 2:
+			flag := f.int != 0
+			v.BoolValue = &flag
+		case 3:
+			i := otlpInt(f.int)
+			v.IntValue = &i
+		case 4:
+			d := math.Float64frombits(f.int)
+			v.DoubleValue = &d
+		case 5:
+			v.ArrayValue = &otlpArrayValue{}
+			return protoReadFields(f.data, func(f protoField) error {
+				if f.num != 1 || f.wire != 2 {
+					return nil
+				}
+				item, err := unmarshalOTLPValue(f.data, depth+1)
+				v.ArrayValue.Values = append(v.ArrayValue.Values, item)
+				return err
+			})
+		case 6:
+			v.KvlistValue = &otlpKvlist{}
+			return protoReadFields(f.data, func(f protoField) error {
+				if f.num != 1 || f.wire != 2 {
+					return nil
+				}
+				kv, err := unmarshalOTLPKeyValue(f.data, depth+1)
+				v.KvlistValue.Values = append(v.KvlistValue.Values, kv)
+				return err
+			})
+		case 7:
+			v.BytesValue = append([]byte{}, f.data...)
+		}
+		return nil
+	})
+	return v, err
+}
+
+// marshalProto encodes the response: ExportLogsServiceResponse { ExportLogsPartialSuccess
+// partial_success = 1; } with ExportLogsPartialSuccess { int64 rejected_log_records = 1;
+// string error_message = 2; }.
+func (r otlpExportResponse) marshalProto() []byte {
+	if r.PartialSuccess == nil {
+		return []byte{}
+	}
+	var partial []byte
+	if r.PartialSuccess.RejectedLogRecords != 0 {
+		partial = protoAppendTag(partial, 1, 0)
+		partial = binary.AppendUvarint(partial, uint64(r.PartialSuccess.RejectedLogRecords))
+	}
+	if r.PartialSuccess.ErrorMessage != "" {
+		partial = protoAppendString(partial, 2, r.PartialSuccess.ErrorMessage)
+	}
+	return protoAppendBytes(nil, 1, partial)
+}
+
+// unmarshalProto decodes a response.
+func (r *otlpExportResponse) unmarshalProto(b []byte) error {
+	return protoReadFields(b, func(f protoField) error {
+		if f.num != 1 || f.wire != 2 {
+			return nil
+		}
+		r.PartialSuccess = &otlpPartialSuccess{}
+		return protoReadFields(f.data, func(f protoField) error {
+			switch f.num {
+			case 1:
+				r.PartialSuccess.RejectedLogRecords = otlpInt(f.int)
+			case 2:
+				r.PartialSuccess.ErrorMessage = string(f.data)
+			}
+			return nil
+		})
+	})
+}
+
+// marshalProto encodes the status: Status { int32 code = 1; string message = 2; }.
+func (s otlpStatus) marshalProto() []byte {
+	b := protoAppendTag(nil, 1, 0)
+	b = binary.AppendUvarint(b, uint64(s.Code))
+	return protoAppendString(b, 2, s.Message)
+}
+
+// otlpStatusMessage returns the message of a failed OTLP response, decoding google.rpc.Status
+// bodies. Other bodies, such as those of proxies, are returned as they are.
+func otlpStatusMessage(contentType string, body []byte) string {
+	var status otlpStatus
+	if contentType == contentTypeProto {
+		err := protoReadFields(body, func(f protoField) error {
+			if f.num == 2 && f.wire == 2 {
+				status.Message = string(f.data)
+			}
+			return nil
+		})
+		if err == nil && status.Message != "" {
+			return status.Message
+		}
+	} else if json.Unmarshal(body, &status) == nil && status.Message != "" {
+		return status.Message
+	}
+	return strings.TrimSpace(string(body))
+}
+
+// otlpContentType returns the OTLP encoding of the request, JSON or protobuf.
+func otlpContentType(r *http.Request) (string, error) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err == nil && (mediaType == contentTypeJSON || mediaType == contentTypeProto) {
+		return mediaType, nil
+	}
+	return "", fmt.Errorf("unsupported content type '%s': use %s or %s", r.Header.Get("Content-Type"), contentTypeProto, contentTypeJSON)
+}
+
+// otlpLogsHandler returns the handler of the OTLP/HTTP logs endpoint. Records are mapped to
+// entries and passed through the service logger like those of ingestHandler; rejected records are
+// reported as a partial success.
+func otlpLogsHandler(integration string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeOTLPError(w, contentTypeJSON, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+			return
+		}
+		contentType, err := otlpContentType(r)
+		if err != nil {
+			writeOTLPError(w, contentTypeJSON, http.StatusUnsupportedMediaType, err)
+			return
+		}
+
+		body, err := readIngestBody(w, r)
+		if err != nil {
+			status := http.StatusBadRequest
+			var maxErr *http.MaxBytesError
+			switch {
+			case errors.As(err, &maxErr), errors.Is(err, errIngestBodyTooLarge):
+				status = http.StatusRequestEntityTooLarge
+			case errors.Is(err, errUnsupportedEncoding):
+				status = http.StatusUnsupportedMediaType
+			}
+			writeOTLPError(w, contentType, status, err)
+			return
+		}
+
+		var data otlpLogsData
+		if contentType == contentTypeProto {
+			err = data.unmarshalProto(body)
+		} else {
+			err = json.Unmarshal(body, &data)
+		}
+		if err != nil {
+			writeOTLPError(w, contentType, http.StatusBadRequest, fmt.Errorf("invalid OTLP logs request: %w", err))
+			return
+		}
+
+		principal, _ := PrincipalFromContext(r.Context())
+		entries, result := decodeOTLPLogs(data, time.Now())
+		for _, entry := range entries {
+			tagIngestedEntry(entry, integration, principal)
+			globalLogger.Ingest(entry)
+		}
+
+		var resp otlpExportResponse
+		if result.Rejected > 0 {
+			messages := make([]string, 0, len(result.Errors))
+			for _, e := range result.Errors {
+				messages = append(messages, fmt.Sprintf("record %d: %s", e.Index, e.Error))
+			}
+			resp.PartialSuccess = &otlpPartialSuccess{
+				RejectedLogRecords: otlpInt(result.Rejected),
+				ErrorMessage:       strings.Join(messages, "; "),
+			}
+		}
+		writeOTLP(w, contentType, http.StatusOK, resp, resp.marshalProto())
+	}
+}
+
+// writeOTLPError writes a google.rpc.Status in the encoding of the request.
+func writeOTLPError(w http.ResponseWriter, contentType string, status int, err error) {
+	code := 3 // INVALID_ARGUMENT
+	switch status {
+	case http.StatusRequestEntityTooLarge:
+		code = 8 // RESOURCE_EXHAUSTED
+	case http.StatusMethodNotAllowed, http.StatusUnsupportedMediaType:
+		code = 12 // UNIMPLEMENTED
+	}
+	s := otlpStatus{Code: code, Message: err.Error()}
+	writeOTLP(w, contentType, status, s, s.marshalProto())
+}
+
+// writeOTLP writes the response in JSON or in its protobuf encoding.
+func writeOTLP(w http.ResponseWriter, contentType string, status int, v interface{}, proto []byte) {
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	if contentType == contentTypeProto {
+		_, _ = w.Write(proto)
+		return
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		data = []byte("{}")
+	}
+	_, _ = w.Write(append(data, '\n'))
+}
+
+// otlpRejected returns the rejected records reported in an export response, if any.
+func otlpRejected(contentType string, body []byte) (int64, string) {
+	var resp otlpExportResponse
+	var err error
+	if contentType == contentTypeProto {
+		err = resp.unmarshalProto(body)
+	} else {
+		err = json.Unmarshal(bytes.TrimSpace(body), &resp)
+	}
+	if err != nil || resp.PartialSuccess == nil {
+		return 0, ""
+	}
+	return int64(resp.PartialSuccess.RejectedLogRecords), resp.PartialSuccess.ErrorMessage
+}
@@ -0,0 +1,46 @@
+package logger
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// nestedOTLPRequest returns a protobuf LogsData with one record whose body is an array nested
+// depth levels deep.
+func nestedOTLPRequest(depth int) []byte {
+	value := protoAppendString(nil, 1, "leaf")
+	for i := 0; i < depth; i++ {
+		value = protoAppendBytes(nil, 5, protoAppendBytes(nil, 1, value))
+	}
+	record := protoAppendBytes(nil, 5, value)
+	scopeLogs := protoAppendBytes(nil, 2, record)
+	resourceLogs := protoAppendBytes(nil, 2, scopeLogs)
+	return protoAppendBytes(nil, 1, resourceLogs)
+}
+
+func TestOTLPProtoNestingLimit(t *testing.T) {
+	var data otlpLogsData
+	if err := data.unmarshalProto(nestedOTLPRequest(otlpMaxValueDepth)); err != nil {
+		t.Fatalf("nesting at the limit rejected: %v", err)
+	}
+	if err := data.unmarshalProto(nestedOTLPRequest(otlpMaxValueDepth + 1)); err == nil {
+		t.Fatal("nesting beyond the limit accepted")
+	}
+}
+
+func TestOTLPHandlerRejectsDeepNesting(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, otlpLogsPath, bytes.NewReader(nestedOTLPRequest(5000)))
+	req.Header.Set("Content-Type", contentTypeProto)
+	rec := httptest.NewRecorder()
+	otlpLogsHandler(otlpIntegration)(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	if msg := otlpStatusMessage(contentTypeProto, rec.Body.Bytes()); !strings.Contains(msg, "invalid OTLP logs request") {
+		t.Fatalf("error message = %q", msg)
+	}
+}
@@ -0,0 +1,212 @@
+package logger
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// readyFDEnv carries the descriptor the spawned service reports its readiness on.
+	readyFDEnv = "LOGZ_READY_FD"
+	// readyMessage is written on the readiness pipe once the service serves requests.
+	readyMessage = "ready"
+)
+
+// ErrServiceRunning is returned when the PID file is locked by a running service.
+var ErrServiceRunning = errors.New("service already running")
+
+// pidLock is the PID file owned by the running service. The service holds an exclusive flock on it
+// for its whole life, so the kernel releases the lock when the process dies, however it dies.
+type pidLock struct {
+	path string
+	file *os.File
+}
+
+// acquirePidFile locks the PID file and records the current process in it. A file left behind by a
+// dead service is not locked anymore and is taken over.
+func acquirePidFile(path string) (*pidLock, error) {
+	for attempt := 0; ; attempt++ {
+		file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open PID file: %w", err)
+		}
+		if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+			_ = file.Close()
+			// The CLI briefly takes a shared lock to inspect the file: retry before giving up
+			if errors.Is(err, syscall.EWOULDBLOCK) && attempt < 5 {
+				time.Sleep(50 * time.Millisecond)
+				continue
+			}
+			if errors.Is(err, syscall.EWOULDBLOCK) {
+				if pid, _, readErr := readPidFile(path); readErr == nil {
+					return nil, fmt.Errorf("%w with pid %d (%s)", ErrServiceRunning, pid, path)
+				}
+				return nil, fmt.Errorf("%w (%s)", ErrServiceRunning, path)
+			}
+			return nil, fmt.Errorf("failed to lock PID file: %w", err)
+		}
+
+		// The previous owner may have removed the file between our open and our lock: the lock
+		// is then held on an unlinked file, so start over with the new one
+		if !sameFile(file, path) {
+			_ = file.Close()
+			continue
+		}
+
+		if pid, _, readErr := readPidFile(path); readErr == nil && pid != os.Getpid() {
+			log.Printf("Taking over stale PID file of pid %d (%s)", pid, path)
+		}
+		p := &pidLock{path: path, file: file}
+		if err := p.write(""); err != nil {
+			_ = p.release()
+			return nil, err
+		}
+		return p, nil
+	}
+}
+
+// sameFile reports whether the open file is still the one at path.
+func sameFile(file *os.File, path string) bool {
+	opened, err := file.Stat()
+	if err != nil {
+		return false
+	}
+	current, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(opened, current)
+}
+
+// write records the pid and the addresses the service listens on.
+func (p *pidLock) write(address string) error {
+	data := fmt.Sprintf("%d\n%s\n", os.Getpid(), address)
+	if err := p.file.Truncate(0); err != nil {
+		return fmt.Errorf("failed to write PID file: %w", err)
+	}
+	if _, err := p.file.WriteAt([]byte(data), 0); err != nil {
+		return fmt.Errorf("failed to write PID file: %w", err)
+	}
+	return p.file.Sync()
+}
+
+// release removes the PID file, then drops the lock. Removing it first keeps another service from
+// locking the file while it is being deleted.
+func (p *pidLock) release() error {
+	if p == nil || p.file == nil {
+		return nil
+	}
+	err := os.Remove(p.path)
+	if errors.Is(err, os.ErrNotExist) {
+		err = nil
+	}
+	_ = syscall.Flock(int(p.file.Fd()), syscall.LOCK_UN)
+	_ = p.file.Close()
+	p.file = nil
+	return err
+}
+
+// readPidFile returns the pid and the addresses recorded in the PID file.
+func readPidFile(path string) (int, string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, "", err
+	}
+	lines := strings.Split(string(data), "\n")
+	pid, err := strconv.Atoi(strings.TrimSpace(lines[0]))
+	if err != nil || pid <= 0 {
+		return 0, "", os.ErrInvalid
+	}
+	address := ""
+	if len(lines) > 1 {
+		address = strings.TrimSpace(lines[1])
+	}
+	return pid, address, nil
+}
+
+// pidFileLocked reports whether a live process holds the lock of the PID file.
+func pidFileLocked(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_SH|syscall.LOCK_NB); err != nil {
+		return errors.Is(err, syscall.EWOULDBLOCK)
+	}
+	_ = syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+	return false
+}
+
+// processAlive reports whether a process exists with the pid (kill 0). A process owned by another
+// user exists as well, even though it cannot be signalled.
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// readyPipe is the write end of the readiness handshake with 'logz service start'. It is nil when
+// the service was not spawned by it.
+type readyPipe struct {
+	file *os.File
+}
+
+// openReadyPipe returns the readiness pipe passed by the parent process, if any.
+func openReadyPipe() *readyPipe {
+	fd, err := strconv.Atoi(os.Getenv(readyFDEnv))
+	if err != nil || fd < 3 {
+		return nil
+	}
+	_ = os.Unsetenv(readyFDEnv)
+	// Processes started by the service, such as plugins, must not hold the pipe open
+	syscall.CloseOnExec(fd)
+	return &readyPipe{file: os.NewFile(uintptr(fd), "ready")}
+}
+
+// signal reports the outcome of the startup to the parent: ready when err is nil, the error
+// otherwise. Only the first call is reported.
+func (r *readyPipe) signal(err error) {
+	if r == nil || r.file == nil {
+		return
+	}
+	msg := readyMessage
+	if err != nil {
+		msg = "error: " + err.Error()
+	}
+	_, _ = r.file.Write([]byte(msg + "\n"))
+	_ = r.file.Close()
+	r.file = nil
+}
+
+// waitReady reads the outcome of the startup from the readiness pipe, up to the timeout.
+func waitReady(pipe *os.File, timeout time.Duration) error {
+	result := make(chan error, 1)
+	go func() {
+		data, err := io.ReadAll(pipe)
+		msg := strings.TrimSpace(string(data))
+		switch {
+		case msg == readyMessage:
+			result <- nil
+		case strings.HasPrefix(msg, "error: "):
+			result <- errors.New(strings.TrimPrefix(msg, "error: "))
+		case err != nil:
+			result <- err
+		default:
+			result <- errors.New("service exited during startup")
+		}
+	}()
+	select {
+	case err := <-result:
+		return err
+	case <-time.After(timeout):
+		_ = pipe.Close()
+		return fmt.Errorf("service not ready after %s", timeout)
+	}
+}
@@ -0,0 +1,576 @@
+package logger
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/spf13/viper"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// PluginProtocolVersion is the version of the line-delimited JSON plugin protocol.
+	PluginProtocolVersion = 1
+
+	defaultPluginTimeout      = 5 * time.Second
+	defaultPluginPingInterval = 30 * time.Second
+	pluginMaxBackoff          = 30 * time.Second
+)
+
+// Plugin kinds and the capability each one requires.
+const (
+	PluginKindNotifier = "notifier"
+	PluginKindWriter   = "writer"
+
+	PluginCapNotify = "notify"
+	PluginCapWrite  = "write"
+	PluginCapPing   = "ping"
+)
+
+// Plugin message types.
+const (
+	pluginMsgHandshake = "handshake"
+	pluginMsgNotify    = "notify"
+	pluginMsgWrite     = "write"
+	pluginMsgPing      = "ping"
+	pluginMsgPong      = "pong"
+	pluginMsgResult    = "result"
+	pluginMsgLog       = "log"
+	pluginMsgShutdown  = "shutdown"
+)
+
+// ErrPluginUnavailable is returned while a plugin process is down or restarting.
+var ErrPluginUnavailable = errors.New("plugin is not running")
+
+// PluginConfig maps a notifier or writer type to an external executable.
+type PluginConfig struct {
+	Command      string            `json:"command" mapstructure:"command"`                     // Executable implementing the plugin protocol.
+	Args         []string          `json:"args,omitempty" mapstructure:"args"`                 // Arguments passed to the executable.
+	Env          map[string]string `json:"env,omitempty" mapstructure:"env"`                   // Extra environment variables.
+	Timeout      time.Duration     `json:"timeout,omitempty" mapstructure:"timeout"`           // Timeout for the handshake and each request.
+	PingInterval time.Duration     `json:"pingInterval,omitempty" mapstructure:"pingInterval"` // Interval between health pings.
+}
+
+// Validate checks the plugin definition.
+func (pc PluginConfig) Validate(name string) error {
+	if pc.Command == "" {
+		return fmt.Errorf("plugin '%s': 'command' is required", name)
+	}
+	if _, err := exec.LookPath(pc.Command); err != nil {
+		return fmt.Errorf("plugin '%s': command '%s' not found: %w", name, pc.Command, err)
+	}
+	if pc.Timeout < 0 || pc.PingInterval < 0 {
+		return fmt.Errorf("plugin '%s': timeouts must not be negative", name)
+	}
+	return nil
+}
+
+// loadPlugins reads and validates the "plugins" section of the configuration.
+// Invalid plugins are left out of the returned map and reported in the error.
+func loadPlugins(vpr *viper.Viper) (map[string]PluginConfig, error) {
+	var plugins map[string]PluginConfig
+	if err := vpr.UnmarshalKey("plugins", &plugins); err != nil {
+		return nil, fmt.Errorf("failed to parse plugins config: %w", err)
+	}
+	var errs []error
+	for name, plugin := range plugins {
+		if builtinNotifierTypes[name] {
+			errs = append(errs, fmt.Errorf("plugin '%s': name clashes with a built-in notifier type", name))
+			delete(plugins, name)
+			continue
+		}
+		if err := plugin.Validate(name); err != nil {
+			errs = append(errs, err)
+			delete(plugins, name)
+		}
+	}
+	return plugins, errors.Join(errs...)
+}
+
+// pluginMessage is a single line of the plugin protocol, in either direction.
+type pluginMessage struct {
+	Type         string                 `json:"type"`
+	ID           uint64                 `json:"id,omitempty"`
+	Version      int                    `json:"version,omitempty"`
+	Kind         string                 `json:"kind,omitempty"`
+	Name         string                 `json:"name,omitempty"`
+	Capabilities []string               `json:"capabilities,omitempty"`
+	Config       map[string]interface{} `json:"config,omitempty"`
+	Entry        *LogEntry              `json:"entry,omitempty"`
+	Error        string                 `json:"error,omitempty"`
+	Level        LogLevel               `json:"level,omitempty"`
+	Message      string                 `json:"message,omitempty"`
+}
+
+// PluginProcess supervises an external plugin executable and exchanges protocol messages with it.
+// It restarts the process with backoff when it crashes or stops answering health pings.
+type PluginProcess struct {
+	name    string
+	kind    string
+	cfg     PluginConfig
+	options map[string]interface{}
+
+	mu           sync.Mutex
+	writeMu      sync.Mutex // Serializes the writes to stdin, made outside mu
+	cmd          *exec.Cmd
+	stdin        *os.File
+	encoder      *json.Encoder
+	pending      map[uint64]chan pluginMessage
+	capabilities map[string]bool
+	running      bool
+	closed       bool
+	nextID       atomic.Uint64
+	done         chan struct{}
+	stopped      chan struct{} // Closed when the supervision ends
+	launch       sync.Once     // Starts the process on the first request
+}
+
+// NewPluginProcess prepares the supervisor of a plugin. The process is started, and the handshake
+// performed, on the first request, so that configurations loaded without being used never spawn it.
+func NewPluginProcess(name, kind string, cfg PluginConfig, options map[string]interface{}) *PluginProcess {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultPluginTimeout
+	}
+	if cfg.PingInterval <= 0 {
+		cfg.PingInterval = defaultPluginPingInterval
+	}
+	return &PluginProcess{
+		name:    name,
+		kind:    kind,
+		cfg:     cfg,
+		options: options,
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+}
+
+// ensureStarted starts the process and its supervision once. If the first start fails the plugin
+// keeps retrying in the background.
+func (p *PluginProcess) ensureStarted() {
+	p.launch.Do(func() {
+		if p.isClosed() {
+			return
+		}
+		err := p.start()
+		if err != nil {
+			log.Printf("%v (retrying in background)", err)
+			p.reap()
+		}
+		go p.supervise(err == nil)
+		go p.pinger()
+	})
+}
+
+// start spawns the executable and negotiates capabilities.
+func (p *PluginProcess) start() error {
+	cmd := exec.Command(p.cfg.Command, p.cfg.Args...)
+	cmd.Env = os.Environ()
+	for k, v := range p.cfg.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	// A pipe of our own rather than StdinPipe, to bound the writes with a deadline
+	stdinR, stdin, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	cmd.Stdin = stdinR
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		_ = stdinR.Close()
+		_ = stdin.Close()
+		return err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		_ = stdinR.Close()
+		_ = stdin.Close()
+		return err
+	}
+	err = cmd.Start()
+	_ = stdinR.Close()
+	if err != nil {
+		_ = stdin.Close()
+		return fmt.Errorf("plugin '%s': failed to start: %w", p.name, err)
+	}
+
+	p.mu.Lock()
+	p.cmd = cmd
+	p.stdin = stdin
+	p.encoder = json.NewEncoder(stdin)
+	p.pending = make(map[uint64]chan pluginMessage)
+	p.capabilities = nil
+	p.mu.Unlock()
+
+	go p.copyStderr(stderr)
+	handshake := make(chan pluginMessage, 1)
+	go p.readLoop(stdout, handshake)
+
+	offered := []string{PluginCapPing}
+	if p.kind == PluginKindWriter {
+		offered = append(offered, PluginCapWrite)
+	} else {
+		offered = append(offered, PluginCapNotify)
+	}
+	if err := p.send(pluginMessage{
+		Type:         pluginMsgHandshake,
+		Version:      PluginProtocolVersion,
+		Kind:         p.kind,
+		Name:         p.name,
+		Capabilities: offered,
+		Config:       p.options,
+	}); err != nil {
+		_ = cmd.Process.Kill()
+		return fmt.Errorf("plugin '%s': handshake failed: %w", p.name, err)
+	}
+
+	select {
+	case reply, ok := <-handshake:
+		if !ok {
+			return fmt.Errorf("plugin '%s': exited during handshake", p.name)
+		}
+		if reply.Version != PluginProtocolVersion {
+			_ = cmd.Process.Kill()
+			return fmt.Errorf("plugin '%s': unsupported protocol version %d", p.name, reply.Version)
+		}
+		caps := make(map[string]bool)
+		for _, c := range reply.Capabilities {
+			caps[c] = true
+		}
+		required := PluginCapNotify
+		if p.kind == PluginKindWriter {
+			required = PluginCapWrite
+		}
+		if !caps[required] {
+			_ = cmd.Process.Kill()
+			return fmt.Errorf("plugin '%s': does not support the '%s' capability", p.name, required)
+		}
+		p.mu.Lock()
+		p.capabilities = caps
+		p.running = true
+		p.mu.Unlock()
+	case <-time.After(p.cfg.Timeout):
+		_ = cmd.Process.Kill()
+		return fmt.Errorf("plugin '%s': handshake timed out", p.name)
+	}
+	return nil
+}
+
+// supervise waits for the process to exit and restarts it with exponential backoff.
+func (p *PluginProcess) supervise(started bool) {
+	defer close(p.stopped)
+	backoff := time.Second
+	for {
+		if started {
+			p.mu.Lock()
+			cmd := p.cmd
+			p.mu.Unlock()
+			err := cmd.Wait()
+			p.markDown()
+			if p.isClosed() {
+				return
+			}
+			log.Printf("Plugin '%s' exited: %v, restarting", p.name, err)
+		}
+
+		select {
+		case <-p.done:
+			return
+		case <-time.After(backoff):
+		}
+
+		if err := p.start(); err != nil {
+			log.Printf("Plugin '%s' restart failed: %v", p.name, err)
+			p.reap()
+			started = false
+			backoff *= 2
+			if backoff > pluginMaxBackoff {
+				backoff = pluginMaxBackoff
+			}
+			continue
+		}
+		if p.isClosed() {
+			// Closed during the restart: the shutdown request went to the previous process
+			p.kill()
+		}
+		started = true
+		backoff = time.Second
+	}
+}
+
+// kill kills the current process, if any.
+func (p *PluginProcess) kill() {
+	p.mu.Lock()
+	cmd := p.cmd
+	p.mu.Unlock()
+	if cmd != nil && cmd.Process != nil {
+		_ = cmd.Process.Kill()
+	}
+}
+
+// reap kills and waits for a process whose start failed.
+func (p *PluginProcess) reap() {
+	p.mu.Lock()
+	cmd := p.cmd
+	p.mu.Unlock()
+	if cmd != nil && cmd.Process != nil && cmd.ProcessState == nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	}
+	p.markDown()
+}
+
+// pinger sends periodic health pings and kills the process when it stops answering.
+func (p *PluginProcess) pinger() {
+	ticker := time.NewTicker(p.cfg.PingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+			p.mu.Lock()
+			canPing := p.running && p.capabilities[PluginCapPing]
+			cmd := p.cmd
+			p.mu.Unlock()
+			if !canPing {
+				continue
+			}
+			if err := p.call(pluginMessage{Type: pluginMsgPing}); err != nil {
+				log.Printf("Plugin '%s' failed health check: %v", p.name, err)
+				_ = cmd.Process.Kill()
+			}
+		}
+	}
+}
+
+// readLoop dispatches the messages received from the plugin.
+func (p *PluginProcess) readLoop(stdout io.Reader, handshake chan<- pluginMessage) {
+	defer close(handshake)
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		var msg pluginMessage
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			log.Printf("Plugin '%s' sent invalid message: %v", p.name, err)
+			continue
+		}
+		switch msg.Type {
+		case pluginMsgHandshake:
+			handshake <- msg
+		case pluginMsgLog:
+			log.Printf("Plugin '%s' [%s]: %s", p.name, getOrDefault(string(msg.Level), string(INFO)), msg.Message)
+		case pluginMsgResult, pluginMsgPong:
+			p.mu.Lock()
+			ch, ok := p.pending[msg.ID]
+			delete(p.pending, msg.ID)
+			p.mu.Unlock()
+			if ok {
+				ch <- msg
+			}
+		default:
+			log.Printf("Plugin '%s' sent unknown message type '%s'", p.name, msg.Type)
+		}
+	}
+}
+
+// copyStderr forwards the plugin's stderr into logz's own log.
+func (p *PluginProcess) copyStderr(stderr io.Reader) {
+	scanner := bufio.NewScanner(stderr)
+	for scanner.Scan() {
+		log.Printf("Plugin '%s' stderr: %s", p.name, scanner.Text())
+	}
+}
+
+// send writes a single message to the plugin's stdin. The write is made outside mu, so that
+// readLoop keeps dispatching replies, and bounded by the timeout, so that a plugin that stops
+// reading cannot block the logger. A failed write may leave a partial line: the process is then
+// killed and restarted by the supervisor.
+func (p *PluginProcess) send(msg pluginMessage) error {
+	p.mu.Lock()
+	stdin, encoder := p.stdin, p.encoder
+	p.mu.Unlock()
+	if encoder == nil {
+		return ErrPluginUnavailable
+	}
+
+	p.writeMu.Lock()
+	defer p.writeMu.Unlock()
+	_ = stdin.SetWriteDeadline(time.Now().Add(p.cfg.Timeout))
+	if err := encoder.Encode(msg); err != nil {
+		p.kill()
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			return errors.New("plugin stopped reading its input")
+		}
+		return err
+	}
+	return nil
+}
+
+// call sends a request and waits for the matching reply.
+func (p *PluginProcess) call(msg pluginMessage) error {
+	p.ensureStarted()
+	msg.ID = p.nextID.Add(1)
+	reply := make(chan pluginMessage, 1)
+
+	p.mu.Lock()
+	if !p.running {
+		p.mu.Unlock()
+		return ErrPluginUnavailable
+	}
+	p.pending[msg.ID] = reply
+	p.mu.Unlock()
+
+	if err := p.send(msg); err != nil {
+		p.forget(msg.ID)
+		return fmt.Errorf("plugin '%s': %w", p.name, err)
+	}
+
+	select {
+	case res, ok := <-reply:
+		if !ok {
+			return ErrPluginUnavailable
+		}
+		if res.Error != "" {
+			return fmt.Errorf("plugin '%s': %s", p.name, res.Error)
+		}
+		return nil
+	case <-time.After(p.cfg.Timeout):
+		p.forget(msg.ID)
+		return fmt.Errorf("plugin '%s': request timed out", p.name)
+	}
+}
+
+// QueueDepth returns the number of requests waiting for a reply.
+func (p *PluginProcess) QueueDepth() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.pending)
+}
+
+// forget drops a pending request.
+func (p *PluginProcess) forget(id uint64) {
+	p.mu.Lock()
+	delete(p.pending, id)
+	p.mu.Unlock()
+}
+
+// markDown fails all pending requests after the process exited.
+func (p *PluginProcess) markDown() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.running = false
+	p.encoder = nil
+	for id, ch := range p.pending {
+		close(ch)
+		delete(p.pending, id)
+	}
+}
+
+// isClosed reports whether Close was called.
+func (p *PluginProcess) isClosed() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.closed
+}
+
+// Send delivers a log entry to the plugin using the request type matching its kind.
+func (p *PluginProcess) Send(entry LogzEntry) error {
+	msgType := pluginMsgNotify
+	if p.kind == PluginKindWriter {
+		msgType = pluginMsgWrite
+	}
+	return p.call(pluginMessage{Type: msgType, Entry: cloneEntry(entry)})
+}
+
+// Close asks the plugin to shut down and stops supervising it. A plugin still running after the
+// timeout is killed.
+func (p *PluginProcess) Close() error {
+	// Wait for a start in progress, and prevent any later one
+	p.launch.Do(func() {})
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	close(p.done)
+	started := p.cmd != nil
+	stdin := p.stdin
+	p.mu.Unlock()
+	if !started {
+		return nil
+	}
+
+	_ = p.send(pluginMessage{Type: pluginMsgShutdown})
+	if stdin != nil {
+		_ = stdin.Close()
+	}
+	select {
+	case <-p.stopped:
+	case <-time.After(p.cfg.Timeout):
+		log.Printf("Plugin '%s' did not exit after shutdown, killing it", p.name)
+		p.kill()
+		<-p.stopped
+	}
+	return nil
+}
+
+// PluginNotifier is a notifier implemented by an external plugin executable.
+type PluginNotifier struct {
+	NotifierImpl
+	process *PluginProcess
+}
+
+// NewPluginNotifier creates a notifier backed by a plugin, started by the first notification.
+func NewPluginNotifier(name string, cfg PluginConfig, options map[string]interface{}) *PluginNotifier {
+	return &PluginNotifier{process: NewPluginProcess(name, PluginKindNotifier, cfg, options)}
+}
+
+// Notify sends the entry to the plugin.
+func (n *PluginNotifier) Notify(entry LogzEntry) error {
+	if !n.accepts(entry) {
+		return nil
+	}
+	return n.process.Send(entry)
+}
+
+// Close stops the plugin process.
+func (n *PluginNotifier) Close() error { return n.process.Close() }
+
+// QueueDepth returns the number of entries waiting for the plugin's reply.
+func (n *PluginNotifier) QueueDepth() int { return n.process.QueueDepth() }
+
+// PluginWriter is a LogWriter implemented by an external plugin executable.
+type PluginWriter struct {
+	process *PluginProcess
+}
+
+// NewPluginWriter creates a writer backed by a plugin, started by the first entry.
+func NewPluginWriter(name string, cfg PluginConfig, options map[string]interface{}) *PluginWriter {
+	return &PluginWriter{process: NewPluginProcess(name, PluginKindWriter, cfg, options)}
+}
+
+// Write sends the entry to the plugin.
+func (w *PluginWriter) Write(entry LogzEntry) error {
+	if err := w.process.Send(entry); err != nil {
+		return err
+	}
+	if internalMetrics.Load() {
+		data, _ := json.Marshal(entry)
+		recordWrite("plugin:"+w.process.name, len(data))
+	}
+	return nil
+}
+
+// QueueDepth returns the number of entries waiting for the plugin's reply.
+func (w *PluginWriter) QueueDepth() int { return w.process.QueueDepth() }
+
+// Close stops the plugin process.
+func (w *PluginWriter) Close() error { return w.process.Close() }
@@ -4,14 +4,22 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
 	"regexp"
-	"strings"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 )
 
+// defaultSnapshotInterval is how often the service writes metrics to disk when not configured.
+const defaultSnapshotInterval = 10 * time.Second
+
 // Regular expression to validate metric names
 var metricNameRegex = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
 
@@ -24,24 +32,62 @@ func validateMetricName(name string) error {
 }
 
 // Metric represents a single Prometheus metric with a value and optional metadata.
+// It is the legacy persistence format, kept to migrate existing metrics files.
 type Metric struct {
 	Value    float64           `json:"value"`
 	Metadata map[string]string `json:"metadata,omitempty"`
 }
 
+// MetricDefinition declares a metric family with its type, help text and, for histograms
+// and summaries, its buckets or quantiles.
+type MetricDefinition struct {
+	Name      string
+	Help      string
+	Type      MetricType
+	Buckets   []float64
+	Quantiles []float64
+	Volatile  bool // Volatile families are not persisted, e.g. collected runtime metrics.
+}
+
+// persistedFamily is the on-disk representation of a metric family.
+type persistedFamily struct {
+	Help      string           `json:"help,omitempty"`
+	Type      MetricType       `json:"type"`
+	Buckets   []float64        `json:"buckets,omitempty"`
+	Quantiles []float64        `json:"quantiles,omitempty"`
+	Series    []SeriesSnapshot `json:"series"`
+}
+
+// persistedMetrics is the on-disk representation of all metric families.
+type persistedMetrics struct {
+	Version  int                        `json:"version"`
+	Families map[string]persistedFamily `json:"families"`
+}
+
 // PrometheusManager manages Prometheus metrics, including enabling/disabling the HTTP server,
 // loading/saving metrics, and handling metric operations.
+//
+// Metric updates only touch memory. The metrics are written to disk by a periodic snapshot
+// (see StartSnapshots) and by Flush, which callers run before exiting.
 type PrometheusManager struct {
 	enabled         bool
-	metrics         map[string]Metric
+	families        map[string]*MetricFamily
 	mutex           sync.RWMutex
 	metricsFile     string          // path to the persistence file
 	exportWhitelist map[string]bool // If not empty, only these metrics will be exported to Prometheus
 	httpServer      *http.Server    // HTTP server to expose metrics
+	dirty           atomic.Bool     // Set when metrics changed since the last snapshot
+	stopSnapshots   chan struct{}   // Closed to stop the snapshot loop
+	push            *pushState      // Running push loop, if any
+	collectors      CollectorsConfig
+	queueSources    []func() map[string]int
+	discovery       *DiscoveryConfig // Target file kept up to date with the exporter address, if any
+	discoveryTarget string           // Target currently registered in the target file
 }
 
 // Singleton instance of PrometheusManager
 var prometheusManagerInstance *PrometheusManager
+var prometheusManagerOnce sync.Once
 
 // getMetricsFilePath returns the path to the metrics persistence file, using an environment variable if set,
 // or a default location in the user's cache directory.
@@ -60,115 +106,417 @@ func getMetricsFilePath() string {
 
 // GetPrometheusManager returns the singleton instance of PrometheusManager, initializing it if necessary.
 func GetPrometheusManager() *PrometheusManager {
-	if prometheusManagerInstance == nil {
+	prometheusManagerOnce.Do(func() {
 		prometheusManagerInstance = &PrometheusManager{
 			enabled:         false,
-			metrics:         make(map[string]Metric),
+			families:        make(map[string]*MetricFamily),
 			metricsFile:     getMetricsFilePath(),
 			exportWhitelist: make(map[string]bool),
 		}
 		if err := prometheusManagerInstance.loadMetrics(); err != nil {
 			fmt.Printf("Warning: could not load metrics: %v\n", err)
 		}
-	}
+	})
 	return prometheusManagerInstance
 }
 
+// NewPrometheusManager creates an in-memory PrometheusManager that is never persisted to disk.
+// It is meant for evaluating metrics without touching the shared state, e.g. when testing metric rules.
+func NewPrometheusManager() *PrometheusManager {
+	return &PrometheusManager{
+		families:        make(map[string]*MetricFamily),
+		exportWhitelist: make(map[string]bool),
+	}
+}
+
+// lockMetricsFile takes an advisory flock on the lock file next to the metrics file, so that
+// the CLI and the service never read or write a half-written file. The returned function releases it.
+func (pm *PrometheusManager) lockMetricsFile(how int) (func(), error) {
+	lockFile, err := os.OpenFile(pm.metricsFile+".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open metrics lock file: %w", err)
+	}
+	if err := syscall.Flock(int(lockFile.Fd()), how); err != nil {
+		_ = lockFile.Close()
+		return nil, fmt.Errorf("failed to lock metrics file: %w", err)
+	}
+	return func() {
+		_ = syscall.Flock(int(lockFile.Fd()), syscall.LOCK_UN)
+		_ = lockFile.Close()
+	}, nil
+}
+
 // loadMetrics loads metrics from the persistence file into the PrometheusManager instance.
+// Files written in the legacy name-to-value format are migrated to untyped gauges. The metrics
+// in memory are only replaced once the file was read and parsed successfully.
 func (pm *PrometheusManager) loadMetrics() error {
-	pm.mutex.Lock()
-	defer pm.mutex.Unlock()
-	data, err := os.ReadFile(pm.metricsFile)
+	if pm.metricsFile == "" {
+		return nil
+	}
+	unlock, err := pm.lockMetricsFile(syscall.LOCK_SH)
 	if err != nil {
-		if os.IsNotExist(err) {
-			pm.metrics = make(map[string]Metric)
-			return nil
-		}
 		return err
 	}
-	var loaded map[string]Metric
-	if err := json.Unmarshal(data, &loaded); err != nil {
+	data, err := os.ReadFile(pm.metricsFile)
+	unlock()
+
+	families := make(map[string]*MetricFamily)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+	} else if families, err = parseMetrics(data); err != nil {
 		return err
 	}
-	pm.metrics = loaded
+
+	pm.mutex.Lock()
+	pm.families = families
+	pm.mutex.Unlock()
 	return nil
 }
 
-// saveMetrics saves the current metrics to the persistence file.
-func (pm *PrometheusManager) saveMetrics() error {
+// parseMetrics decodes the content of the persistence file, in the current or the legacy format.
+func parseMetrics(data []byte) (map[string]*MetricFamily, error) {
+	families := make(map[string]*MetricFamily)
+	var persisted persistedMetrics
+	if err := json.Unmarshal(data, &persisted); err == nil && persisted.Version > 0 {
+		for name, pf := range persisted.Families {
+			f := newMetricFamily(name, pf.Help, pf.Type, pf.Buckets, pf.Quantiles)
+			for _, snap := range pf.Series {
+				f.restore(snap)
+			}
+			families[name] = f
+		}
+		return families, nil
+	}
+
+	var legacy map[string]Metric
+	if err := json.Unmarshal(data, &legacy); err != nil {
+		return nil, err
+	}
+	for name, metric := range legacy {
+		f := newMetricFamily(name, "", GaugeMetric, nil, nil)
+		f.restore(SeriesSnapshot{Labels: metric.Metadata, Value: metric.Value})
+		families[name] = f
+	}
+	return families, nil
+}
+
+// saveMetrics writes a snapshot of the current metrics to the persistence file.
+// The file is replaced atomically (temp file + rename) while holding the file lock. The metrics
+// are marked clean before the snapshot, so that changes made meanwhile are saved next time, and
+// dirty again when it fails.
+func (pm *PrometheusManager) saveMetrics() (err error) {
+	pm.dirty.Store(false)
+	if pm.metricsFile == "" {
+		return nil
+	}
+	defer func() {
+		if err != nil {
+			pm.dirty.Store(true)
+		}
+	}()
+
 	pm.mutex.RLock()
-	defer pm.mutex.RUnlock()
-	data, err := json.MarshalIndent(pm.metrics, "", "  ")
+	persisted := persistedMetrics{Version: 1, Families: make(map[string]persistedFamily, len(pm.families))}
+	for name, f := range pm.families {
+		if f.Volatile {
+			continue
+		}
+		pf := persistedFamily{Help: f.Help, Type: f.Type, Buckets: f.Buckets, Quantiles: f.Quantiles, Series: []SeriesSnapshot{}}
+		for _, s := range f.Series {
+			pf.Series = append(pf.Series, s.snapshot())
+		}
+		persisted.Families[name] = pf
+	}
+	pm.mutex.RUnlock()
+
+	data, err := json.MarshalIndent(persisted, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	unlock, err := pm.lockMetricsFile(syscall.LOCK_EX)
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(pm.metricsFile, data, 0644)
+	defer unlock()
+
+	tmp, err := os.CreateTemp(filepath.Dir(pm.metricsFile), filepath.Base(pm.metricsFile)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary metrics file: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write metrics: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to sync metrics: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close metrics file: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return fmt.Errorf("failed to set metrics file mode: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), pm.metricsFile); err != nil {
+		return fmt.Errorf("failed to replace metrics file: %w", err)
+	}
+	return nil
+}
+
+// Reload replaces the in-memory metrics with the last snapshot on disk.
+func (pm *PrometheusManager) Reload() error {
+	return pm.loadMetrics()
+}
+
+// Flush writes the metrics to disk if they changed since the last snapshot.
+func (pm *PrometheusManager) Flush() error {
+	if !pm.dirty.Load() {
+		return nil
+	}
+	return pm.saveMetrics()
+}
+
+// StartSnapshots periodically flushes the metrics to disk until StopSnapshots is called.
+func (pm *PrometheusManager) StartSnapshots(interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultSnapshotInterval
+	}
+	pm.mutex.Lock()
+	if pm.stopSnapshots != nil {
+		pm.mutex.Unlock()
+		return
+	}
+	stop := make(chan struct{})
+	pm.stopSnapshots = stop
+	pm.mutex.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if err := pm.Flush(); err != nil {
+					fmt.Printf("Error saving metrics: %v\n", err)
+				}
+			}
+		}
+	}()
+}
+
+// StopSnapshots stops the snapshot loop and writes a final snapshot.
+func (pm *PrometheusManager) StopSnapshots() error {
+	pm.mutex.Lock()
+	if pm.stopSnapshots != nil {
+		close(pm.stopSnapshots)
+		pm.stopSnapshots = nil
+	}
+	pm.mutex.Unlock()
+	return pm.Flush()
 }
 
 // Enable starts the Prometheus HTTP server on the specified port to expose metrics.
-func (pm *PrometheusManager) Enable(port string) {
+// The port is bound before returning, so a busy port is reported to the caller.
+func (pm *PrometheusManager) Enable(port string) error {
 	pm.mutex.Lock()
 	defer pm.mutex.Unlock()
 	if pm.enabled {
-		fmt.Println("Prometheus metrics are already enabled.")
-		return
+		return fmt.Errorf("prometheus metrics are already enabled on %s", pm.httpServer.Addr)
 	}
-	pm.enabled = true
 
 	// Start the HTTP server to expose metrics
 	mux := http.NewServeMux()
-	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
-		metrics := pm.GetMetrics()
-		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
-		for name, value := range metrics {
-			_, fPrintFErr := fmt.Fprintf(w, "# TYPE %s gauge\n%s %f\n", name, name, value)
-			if fPrintFErr != nil {
-				return
-			}
-		}
-	})
+	mux.HandleFunc("/metrics", pm.ServeMetrics)
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%s", port))
+	if err != nil {
+		return fmt.Errorf("failed to listen on port %s: %w", port, err)
+	}
 	pm.httpServer = &http.Server{
-		Addr:    fmt.Sprintf(":%s", port),
+		Addr:    listener.Addr().String(),
 		Handler: mux,
 	}
-	go func() {
-		if err := pm.httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-			fmt.Printf("Error starting Prometheus metrics server: %v\n", err)
+	go func(srv *http.Server) {
+		if err := srv.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Printf("Error serving Prometheus metrics: %v\n", err)
 		}
-	}()
-	fmt.Println("Prometheus metrics enabled.")
+	}(pm.httpServer)
+	pm.enabled = true
+	pm.registerDiscovery()
+	return nil
 }
 
 // Disable stops the Prometheus HTTP server and disables metric exposure.
-func (pm *PrometheusManager) Disable() {
+func (pm *PrometheusManager) Disable() error {
 	pm.mutex.Lock()
 	defer pm.mutex.Unlock()
 	if !pm.enabled {
-		fmt.Println("Prometheus metrics are already disabled.")
-		return
+		return errors.New("prometheus metrics are already disabled")
 	}
 	pm.enabled = false
 	if pm.httpServer != nil {
 		_ = pm.httpServer.Close()
+		pm.httpServer = nil
+	}
+	pm.deregisterDiscovery()
+	return nil
+}
+
+// SetDiscovery sets the file_sd target file listing the exporter, registering it right away if enabled.
+// A nil configuration removes the exporter from the previous file.
+func (pm *PrometheusManager) SetDiscovery(cfg *DiscoveryConfig) {
+	pm.mutex.Lock()
+	defer pm.mutex.Unlock()
+	pm.deregisterDiscovery()
+	pm.discovery = cfg
+	if pm.enabled {
+		pm.registerDiscovery()
+	}
+}
+
+// registerDiscovery adds the exporter to the target file. The caller must hold the mutex.
+func (pm *PrometheusManager) registerDiscovery() {
+	if pm.discovery == nil || pm.httpServer == nil {
+		return
+	}
+	target, err := advertisedTarget(pm.httpServer.Addr, pm.discovery)
+	if err == nil {
+		err = RegisterTarget(pm.discovery, target)
+	}
+	if err != nil {
+		fmt.Printf("Error registering metrics target: %v\n", err)
+		return
+	}
+	pm.discoveryTarget = target
+}
+
+// deregisterDiscovery removes the exporter from the target file. The caller must hold the mutex.
+func (pm *PrometheusManager) deregisterDiscovery() {
+	if pm.discovery == nil || pm.discoveryTarget == "" {
+		return
+	}
+	if err := DeregisterTarget(pm.discovery, pm.discoveryTarget); err != nil {
+		fmt.Printf("Error removing metrics target: %v\n", err)
+	}
+	pm.discoveryTarget = ""
+}
+
+// Address returns the address the metrics are exposed on, or an empty string when disabled.
+func (pm *PrometheusManager) Address() string {
+	pm.mutex.RLock()
+	defer pm.mutex.RUnlock()
+	if pm.httpServer == nil {
+		return ""
+	}
+	return pm.httpServer.Addr
+}
+
+// exported reports whether a family passes the export whitelist. The caller must hold the mutex.
+func (pm *PrometheusManager) exported(name string) bool {
+	return len(pm.exportWhitelist) == 0 || pm.exportWhitelist[name]
+}
+
+// WriteExposition writes all exported metrics in the Prometheus text exposition format.
+func (pm *PrometheusManager) WriteExposition(w io.Writer) error {
+	return pm.WriteExpositionFormat(w, FormatPrometheusText)
+}
+
+// WriteExpositionFormat writes all exported metrics in the given exposition format.
+func (pm *PrometheusManager) WriteExpositionFormat(w io.Writer, format ExpositionFormat) error {
+	pm.runCollectors()
+	pm.mutex.RLock()
+	defer pm.mutex.RUnlock()
+	families := make([]*MetricFamily, 0, len(pm.families))
+	for name, f := range pm.families {
+		if pm.exported(name) {
+			families = append(families, f)
+		}
+	}
+	return writeFamilies(w, families, format)
+}
+
+// ServeMetrics writes the metrics in the format negotiated from the request's Accept header.
+func (pm *PrometheusManager) ServeMetrics(w http.ResponseWriter, r *http.Request) {
+	format := NegotiateExposition(r.Header.Get("Accept"))
+	if format == FormatOpenMetrics {
+		w.Header().Set("Content-Type", ContentTypeOpenMetrics)
+	} else {
+		w.Header().Set("Content-Type", ContentTypePrometheusText)
+	}
+	if err := pm.WriteExpositionFormat(w, format); err != nil {
+		fmt.Printf("Error writing metrics: %v\n", err)
 	}
-	fmt.Println("Prometheus metrics disabled.")
 }
 
 // GetMetrics returns the current metrics, filtered by the export whitelist if defined.
+// Series are keyed by name and labels; histograms and summaries report their sum and count.
 func (pm *PrometheusManager) GetMetrics() map[string]float64 {
 	pm.mutex.RLock()
 	defer pm.mutex.RUnlock()
 	filteredMetrics := make(map[string]float64)
-	for name, metric := range pm.metrics {
+	for name, f := range pm.families {
 		// Respect the exportWhitelist, if defined
-		if len(pm.exportWhitelist) > 0 && !pm.exportWhitelist[name] {
+		if !pm.exported(name) {
 			continue
 		}
-		filteredMetrics[name] = metric.Value
+		for _, series := range f.Series {
+			s := series.snapshot()
+			labels := formatLabels(s.Labels, "", "")
+			switch f.Type {
+			case HistogramMetric, SummaryMetric:
+				filteredMetrics[name+"_sum"+labels] = s.Sum
+				filteredMetrics[name+"_count"+labels] = float64(s.Count)
+			default:
+				filteredMetrics[name+labels] = s.Value
+			}
+		}
 	}
 	return filteredMetrics
 }
 
+// MetricFamilySnapshot is a point-in-time copy of a metric family and its series.
+type MetricFamilySnapshot struct {
+	Name      string           `json:"name"`
+	Help      string           `json:"help,omitempty"`
+	Type      MetricType       `json:"type"`
+	Buckets   []float64        `json:"buckets,omitempty"`   // Histogram upper bounds.
+	Quantiles []float64        `json:"quantiles,omitempty"` // Summary quantiles.
+	Series    []SeriesSnapshot `json:"series"`
+}
+
+// Snapshot returns the exported metric families sorted by name, with their series sorted by
+// labels. Summary samples are left out.
+func (pm *PrometheusManager) Snapshot() []MetricFamilySnapshot {
+	pm.runCollectors()
+	pm.mutex.RLock()
+	defer pm.mutex.RUnlock()
+	families := make([]MetricFamilySnapshot, 0, len(pm.families))
+	for name, f := range pm.families {
+		if !pm.exported(name) {
+			continue
+		}
+		keys := make([]string, 0, len(f.Series))
+		for key := range f.Series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		family := MetricFamilySnapshot{Name: name, Help: f.Help, Type: f.Type, Buckets: f.Buckets, Quantiles: f.Quantiles, Series: make([]SeriesSnapshot, 0, len(keys))}
+		for _, key := range keys {
+			s := f.Series[key].snapshot()
+			s.Samples = nil
+			family.Series = append(family.Series, s)
+		}
+		families = append(families, family)
+	}
+	sort.Slice(families, func(i, j int) bool { return families[i].Name < families[j].Name })
+	return families
+}
+
 // SetExportWhitelist sets the list of metrics that are allowed to be exported to Prometheus.
 func (pm *PrometheusManager) SetExportWhitelist(metrics []string) {
 	pm.mutex.Lock()
@@ -187,126 +535,225 @@ func (pm *PrometheusManager) IsEnabled() bool {
 	return pm.enabled
 }
 
-// AddMetric adds or updates a metric with the given name, value, and metadata.
-func (pm *PrometheusManager) AddMetric(name string, value float64, metadata map[string]string) {
-	if err := validateMetricName(name); err != nil {
-		fmt.Printf("Error adding metric: %v\n", err)
-		return
+// DefineMetric registers a metric family. Redefining an existing family with the same type
+// updates its help text; changing the type is an error.
+func (pm *PrometheusManager) DefineMetric(def MetricDefinition) error {
+	if err := validateMetricName(def.Name); err != nil {
+		return err
+	}
+	typ, err := ParseMetricType(string(def.Type))
+	if err != nil {
+		return err
 	}
 	pm.mutex.Lock()
 	defer pm.mutex.Unlock()
-	pm.metrics[name] = Metric{
-		Value:    value,
-		Metadata: metadata,
-	}
-	fmt.Printf("Metric '%s' added/updated with value: %f\n", name, value)
-	if err := pm.saveMetrics(); err != nil {
-		fmt.Printf("Error saving metrics: %v\n", err)
+	if f, ok := pm.families[def.Name]; ok {
+		if f.Type != typ {
+			return fmt.Errorf("metric '%s' is already registered as a %s", def.Name, f.Type)
+		}
+		if def.Help != "" && def.Help != f.Help {
+			f.Help = def.Help
+			pm.dirty.Store(true)
+		}
+		return nil
 	}
+	f := newMetricFamily(def.Name, def.Help, typ, def.Buckets, def.Quantiles)
+	f.Volatile = def.Volatile
+	pm.families[def.Name] = f
+	pm.dirty.Store(true)
+	return nil
 }
 
-// RemoveMetric removes a metric with the given name.
-func (pm *PrometheusManager) RemoveMetric(name string) {
-	pm.mutex.Lock()
-	defer pm.mutex.Unlock()
-	delete(pm.metrics, name)
-	fmt.Printf("Metric '%s' removed.\n", name)
-	if err := pm.saveMetrics(); err != nil {
-		fmt.Printf("Error saving metrics: %v\n", err)
+// series returns the series of a family for the label set, creating the family with the given
+// type and the series when missing. Lookups of existing series only take the read lock.
+func (pm *PrometheusManager) series(name string, typ MetricType, labels map[string]string) (*MetricFamily, *metricSeries, error) {
+	key := labelsKey(labels)
+	pm.mutex.RLock()
+	if f, ok := pm.families[name]; ok {
+		if s, ok := f.Series[key]; ok {
+			pm.mutex.RUnlock()
+			return f, s, nil
+		}
 	}
-}
+	pm.mutex.RUnlock()
 
-// IncrementMetric increments the value of a metric by the given delta.
-func (pm *PrometheusManager) IncrementMetric(name string, delta float64) {
 	if err := validateMetricName(name); err != nil {
-		fmt.Printf("Error incrementing metric: %v\n", err)
-		return
+		return nil, nil, err
 	}
 	pm.mutex.Lock()
 	defer pm.mutex.Unlock()
-	metric, exists := pm.metrics[name]
-	if !exists {
-		metric = Metric{Value: 0, Metadata: nil}
+	f, ok := pm.families[name]
+	if !ok {
+		f = newMetricFamily(name, "", typ, nil, nil)
+		pm.families[name] = f
 	}
-	metric.Value += delta
-	pm.metrics[name] = metric
-	fmt.Printf("Metric '%s' incremented by %f, new value: %f\n", name, delta, metric.Value)
-	if err := pm.saveMetrics(); err != nil {
-		fmt.Printf("Error saving metrics: %v\n", err)
+	if err := validateLabels(f.Type, labels); err != nil {
+		return nil, nil, fmt.Errorf("metric '%s': %w", name, err)
 	}
+	s, ok := f.Series[key]
+	if !ok {
+		s = f.newSeries(labels)
+		f.Series[key] = s
+	}
+	return f, s, nil
 }
 
-// ListMetrics prints all registered metrics to the console.
-func (pm *PrometheusManager) ListMetrics() {
-	pm.mutex.RLock()
-	defer pm.mutex.RUnlock()
-	if len(pm.metrics) == 0 {
-		fmt.Println("No metrics registered.")
-		return
+// Inc increments a counter or gauge series by delta, creating a counter when the metric is unknown.
+func (pm *PrometheusManager) Inc(name string, labels map[string]string, delta float64) error {
+	return pm.IncWithExemplar(name, labels, delta, nil)
+}
+
+// IncWithExemplar increments a series like Inc and, for counters, records an exemplar with the
+// given labels (e.g. trace_id). Exemplars are exposed in the OpenMetrics format.
+func (pm *PrometheusManager) IncWithExemplar(name string, labels map[string]string, delta float64, exemplar map[string]string) error {
+	f, s, err := pm.series(name, CounterMetric, labels)
+	if err != nil {
+		return err
 	}
-	fmt.Println("Registered metrics:")
-	for name, metric := range pm.metrics {
-		fmt.Printf("- %s: %f", name, metric.Value)
-		if len(metric.Metadata) > 0 {
-			metadataJSON, _ := json.Marshal(metric.Metadata)
-			fmt.Printf(" (metadata: %s)", string(metadataJSON))
+	switch f.Type {
+	case CounterMetric:
+		if delta < 0 {
+			return fmt.Errorf("counter '%s' cannot be decreased", name)
+		}
+	case GaugeMetric:
+	default:
+		return fmt.Errorf("metric '%s' is a %s and cannot be incremented", name, f.Type)
+	}
+	s.add(delta)
+	if f.Type == CounterMetric {
+		if e := newExemplar(exemplar, delta); e != nil {
+			s.setExemplar(e)
+		}
+	}
+	pm.dirty.Store(true)
+	if sd := GetStatsDEmitter(); sd != nil {
+		if f.Type == CounterMetric {
+			sd.Count(name, labels, delta)
+		} else {
+			sd.Gauge(name, labels, s.get())
 		}
-		fmt.Println()
 	}
+	return nil
 }
 
-// setPrometheusSysConfig configures the Prometheus system to scrape metrics from this application.
-func (pm *PrometheusManager) setPrometheusSysConfig() error {
-	// Logz specific configuration for Prometheus
-	prometheusConfig := `
-scrape_configs:
-  - job_name: 'logz'
-    static_configs:
-      - targets: ['localhost:2112']
-`
+// Set sets a gauge series to value, creating a gauge when the metric is unknown.
+func (pm *PrometheusManager) Set(name string, labels map[string]string, value float64) error {
+	f, s, err := pm.series(name, GaugeMetric, labels)
+	if err != nil {
+		return err
+	}
+	if f.Type != GaugeMetric {
+		return fmt.Errorf("metric '%s' is a %s and cannot be set", name, f.Type)
+	}
+	s.set(value)
+	pm.dirty.Store(true)
+	if sd := GetStatsDEmitter(); sd != nil {
+		sd.Gauge(name, labels, value)
+	}
+	return nil
+}
 
-	configFilePath := "/etc/prometheus/prometheus.yml"
+// Observe records a value in a histogram or summary series, creating a histogram when the metric is unknown.
+func (pm *PrometheusManager) Observe(name string, labels map[string]string, value float64) error {
+	f, s, err := pm.series(name, HistogramMetric, labels)
+	if err != nil {
+		return err
+	}
+	if f.Type != HistogramMetric && f.Type != SummaryMetric {
+		return fmt.Errorf("metric '%s' is a %s and cannot observe values", name, f.Type)
+	}
+	f.observe(s, value)
+	pm.dirty.Store(true)
+	if sd := GetStatsDEmitter(); sd != nil {
+		sd.Histogram(name, labels, value)
+	}
+	return nil
+}
 
-	// Check if the configuration file exists
-	_, err := os.Stat(configFilePath)
-	if os.IsNotExist(err) {
-		// Create the configuration file if it does not exist
-		if err := os.WriteFile(configFilePath, []byte(prometheusConfig), 0644); err != nil {
-			return fmt.Errorf("failed to create Prometheus configuration file: %w", err)
-		}
-		fmt.Println("Prometheus configuration file created successfully.")
-	} else if err == nil {
-		// Check if there is already a configuration for 'logz'
-		configContent, readErr := os.ReadFile(configFilePath)
-		if readErr != nil {
-			return fmt.Errorf("failed to read Prometheus configuration file: %w", readErr)
-		}
+// MetricUpdate describes a change to a metric: a gauge is set, a counter incremented and a
+// histogram or summary observes the value.
+type MetricUpdate struct {
+	Name      string            `json:"name"`
+	Value     float64           `json:"value"`
+	Type      MetricType        `json:"type,omitempty"`
+	Help      string            `json:"help,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Buckets   []float64         `json:"buckets,omitempty"`
+	Quantiles []float64         `json:"quantiles,omitempty"`
+}
 
-		if strings.Contains(string(configContent), "job_name: 'logz'") {
-			fmt.Println("Prometheus configuration for 'logz' already exists.")
-		} else {
-			// Add the configuration to the existing file
-			f, openErr := os.OpenFile(configFilePath, os.O_APPEND|os.O_WRONLY, 0644)
-			if openErr != nil {
-				return fmt.Errorf("failed to open Prometheus configuration file: %w", openErr)
-			}
-			defer func(f *os.File) {
-				_ = f.Close()
-			}(f)
+// UpdateMetric defines the metric family if needed and applies the update to it.
+func (pm *PrometheusManager) UpdateMetric(u MetricUpdate) error {
+	typ, err := ParseMetricType(string(u.Type))
+	if err != nil {
+		return err
+	}
+	if err := pm.DefineMetric(MetricDefinition{
+		Name:      u.Name,
+		Help:      u.Help,
+		Type:      typ,
+		Buckets:   u.Buckets,
+		Quantiles: u.Quantiles,
+	}); err != nil {
+		return err
+	}
+	switch typ {
+	case CounterMetric:
+		return pm.Inc(u.Name, u.Labels, u.Value)
+	case HistogramMetric, SummaryMetric:
+		return pm.Observe(u.Name, u.Labels, u.Value)
+	default:
+		return pm.Set(u.Name, u.Labels, u.Value)
+	}
+}
 
-			if _, writeErr := f.WriteString(prometheusConfig); writeErr != nil {
-				return fmt.Errorf("failed to append to Prometheus configuration file: %w", writeErr)
-			}
-			fmt.Println("Prometheus configuration for 'logz' added successfully.")
-		}
-	} else {
-		return fmt.Errorf("failed to check Prometheus configuration file: %w", err)
+// AddMetric adds or updates a gauge with the given name, value, and metadata rendered as labels.
+func (pm *PrometheusManager) AddMetric(name string, value float64, metadata map[string]string) {
+	if err := pm.Set(name, metadata, value); err != nil {
+		fmt.Printf("Error adding metric: %v\n", err)
+		return
 	}
+	fmt.Printf("Metric '%s' added/updated with value: %f\n", name, value)
+}
 
-	return nil
+// RemoveMetric removes a metric family with the given name, reporting whether it existed.
+func (pm *PrometheusManager) RemoveMetric(name string) bool {
+	pm.mutex.Lock()
+	defer pm.mutex.Unlock()
+	if _, ok := pm.families[name]; !ok {
+		return false
+	}
+	delete(pm.families, name)
+	pm.dirty.Store(true)
+	return true
+}
+
+// IncrementMetric increments the value of an unlabelled counter by the given delta.
+func (pm *PrometheusManager) IncrementMetric(name string, delta float64) {
+	if err := pm.Inc(name, nil, delta); err != nil {
+		fmt.Printf("Error incrementing metric: %v\n", err)
+	}
 }
 
-// initPrometheus initializes the Prometheus metrics and system configuration.
+// ListMetrics prints all registered metrics to the console.
+func (pm *PrometheusManager) ListMetrics() {
+	metrics := pm.GetMetrics()
+	if len(metrics) == 0 {
+		fmt.Println("No metrics registered.")
+		return
+	}
+	names := make([]string, 0, len(metrics))
+	for name := range metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Println("Registered metrics:")
+	for _, name := range names {
+		fmt.Printf("- %s: %s\n", name, formatFloat(metrics[name]))
+	}
+}
+
+// initPrometheus initializes the default Prometheus metrics.
 func (pm *PrometheusManager) initPrometheus() error {
 	if !pm.IsEnabled() {
 		return fmt.Errorf("prometheus is not enabled")
@@ -321,10 +768,6 @@ func (pm *PrometheusManager) initPrometheus() error {
 		pm.AddMetric(metric, 0, nil) // Initialize with value 0 and no metadata
 	}
 
-	if err := pm.setPrometheusSysConfig(); err != nil {
-		return fmt.Errorf("failed to configure Prometheus system: %w", err)
-	}
-
 	fmt.Println("Prometheus initialized successfully with default metrics.")
 	return nil
 }
@@ -0,0 +1,397 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/spf13/viper"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	defaultPushJob      = "logz"
+	defaultPushInterval = 15 * time.Second
+	defaultPushTimeout  = 10 * time.Second
+)
+
+// PushConfig configures the push mode of the PrometheusManager, for processes that live too
+// short to be scraped. Metrics are pushed on every interval and once more when the push stops.
+type PushConfig struct {
+	URL         string             `json:"url,omitempty" mapstructure:"url"`                 // Pushgateway base URL, e.g. http://pushgateway:9091.
+	Job         string             `json:"job,omitempty" mapstructure:"job"`                 // Job label, "logz" by default.
+	Grouping    map[string]string  `json:"grouping,omitempty" mapstructure:"grouping"`       // Additional grouping labels, e.g. instance.
+	Method      string             `json:"method,omitempty" mapstructure:"method"`           // PUT replaces the group (default), POST merges into it.
+	Headers     map[string]string  `json:"headers,omitempty" mapstructure:"headers"`         // Extra request headers, e.g. Authorization.
+	Interval    time.Duration      `json:"interval,omitempty" mapstructure:"interval"`       // Push interval, 15s by default.
+	Timeout     time.Duration      `json:"timeout,omitempty" mapstructure:"timeout"`         // Request timeout, 10s by default.
+	RemoteWrite *RemoteWriteConfig `json:"remoteWrite,omitempty" mapstructure:"remoteWrite"` // Optional Prometheus remote-write target.
+}
+
+// RemoteWriteConfig configures sending samples with the Prometheus remote-write protocol.
+type RemoteWriteConfig struct {
+	URL     string            `json:"url" mapstructure:"url"`                   // Remote-write endpoint, e.g. http://prometheus:9090/api/v1/write.
+	Headers map[string]string `json:"headers,omitempty" mapstructure:"headers"` // Extra request headers, e.g. Authorization.
+}
+
+// Validate checks the push configuration.
+func (c *PushConfig) Validate() error {
+	if c.URL == "" && (c.RemoteWrite == nil || c.RemoteWrite.URL == "") {
+		return errors.New("metrics push: 'url' or 'remoteWrite.url' is required")
+	}
+	if c.URL != "" {
+		if _, err := url.ParseRequestURI(c.URL); err != nil {
+			return fmt.Errorf("metrics push: invalid url: %w", err)
+		}
+	}
+	if c.RemoteWrite != nil && c.RemoteWrite.URL != "" {
+		if _, err := url.ParseRequestURI(c.RemoteWrite.URL); err != nil {
+			return fmt.Errorf("metrics push: invalid remoteWrite url: %w", err)
+		}
+	}
+	switch strings.ToUpper(c.Method) {
+	case "", http.MethodPut, http.MethodPost:
+	default:
+		return fmt.Errorf("metrics push: method must be PUT or POST, got '%s'", c.Method)
+	}
+	for name := range c.Grouping {
+		if !labelNameRegex.MatchString(name) || name == "job" {
+			return fmt.Errorf("metrics push: invalid grouping label '%s'", name)
+		}
+	}
+	return nil
+}
+
+// loadPushConfig reads the "metricsPush" section of the configuration, returning nil when absent.
+func loadPushConfig(vpr *viper.Viper) (*PushConfig, error) {
+	if !vpr.IsSet("metricsPush") {
+		return nil, nil
+	}
+	var cfg PushConfig
+	if err := vpr.UnmarshalKey("metricsPush", &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse metricsPush config: %w", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// pushState is the running push loop.
+type pushState struct {
+	cfg    PushConfig
+	client *http.Client
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// StartPush starts pushing the metrics on the configured interval until StopPush is called.
+func (pm *PrometheusManager) StartPush(cfg PushConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	if cfg.Job == "" {
+		cfg.Job = defaultPushJob
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = defaultPushInterval
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultPushTimeout
+	}
+
+	pm.mutex.Lock()
+	if pm.push != nil {
+		pm.mutex.Unlock()
+		return errors.New("metrics push is already running")
+	}
+	state := &pushState{
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.Timeout},
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	pm.push = state
+	pm.mutex.Unlock()
+
+	go func() {
+		defer close(state.done)
+		ticker := time.NewTicker(cfg.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-state.stop:
+				return
+			case <-ticker.C:
+				if err := pm.pushOnce(state); err != nil {
+					log.Printf("Error pushing metrics: %v", err)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// StopPush stops the push loop and pushes the metrics a last time, so that nothing recorded
+// by a short-lived process is lost. It does nothing when push mode is not running.
+func (pm *PrometheusManager) StopPush() error {
+	pm.mutex.Lock()
+	state := pm.push
+	pm.push = nil
+	pm.mutex.Unlock()
+	if state == nil {
+		return nil
+	}
+	close(state.stop)
+	<-state.done
+	return pm.pushOnce(state)
+}
+
+// IsPushing reports whether push mode is running.
+func (pm *PrometheusManager) IsPushing() bool {
+	pm.mutex.RLock()
+	defer pm.mutex.RUnlock()
+	return pm.push != nil
+}
+
+// Push sends the current metrics immediately, using the running push configuration.
+func (pm *PrometheusManager) Push() error {
+	pm.mutex.RLock()
+	state := pm.push
+	pm.mutex.RUnlock()
+	if state == nil {
+		return errors.New("metrics push is not running")
+	}
+	return pm.pushOnce(state)
+}
+
+// pushOnce pushes to the Pushgateway and the remote-write endpoint, whichever are configured.
+func (pm *PrometheusManager) pushOnce(state *pushState) error {
+	ctx, cancel := context.WithTimeout(context.Background(), state.cfg.Timeout)
+	defer cancel()
+	var errs []error
+	if state.cfg.URL != "" {
+		if err := pm.pushGateway(ctx, state.client, state.cfg); err != nil {
+			errs = append(errs, fmt.Errorf("pushgateway: %w", err))
+		}
+	}
+	if state.cfg.RemoteWrite != nil && state.cfg.RemoteWrite.URL != "" {
+		if err := pm.remoteWrite(ctx, state.client, state.cfg); err != nil {
+			errs = append(errs, fmt.Errorf("remote write: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// pushGateway sends the text exposition to the grouping key URL of the Pushgateway.
+func (pm *PrometheusManager) pushGateway(ctx context.Context, client *http.Client, cfg PushConfig) error {
+	var body bytes.Buffer
+	if err := pm.WriteExposition(&body); err != nil {
+		return err
+	}
+	method := strings.ToUpper(cfg.Method)
+	if method == "" {
+		method = http.MethodPut
+	}
+	req, err := http.NewRequestWithContext(ctx, method, pushGatewayURL(cfg), &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", ContentTypePrometheusText)
+	for k, v := range cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	return doPushRequest(client, req)
+}
+
+// pushGatewayURL builds <url>/metrics/job/<job>{/<label>/<value>}, base64-encoding values
+// that cannot be used as a path segment.
+func pushGatewayURL(cfg PushConfig) string {
+	var b strings.Builder
+	b.WriteString(strings.TrimRight(cfg.URL, "/"))
+	b.WriteString("/metrics")
+	writeSegment := func(name, value string) {
+		if value == "" || strings.Contains(value, "/") {
+			encoded := base64.RawURLEncoding.EncodeToString([]byte(value))
+			if encoded == "" {
+				encoded = "="
+			}
+			fmt.Fprintf(&b, "/%s@base64/%s", name, encoded)
+			return
+		}
+		fmt.Fprintf(&b, "/%s/%s", name, url.PathEscape(value))
+	}
+	writeSegment("job", cfg.Job)
+	names := make([]string, 0, len(cfg.Grouping))
+	for name := range cfg.Grouping {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		writeSegment(name, cfg.Grouping[name])
+	}
+	return b.String()
+}
+
+// remoteWrite sends the current samples as a snappy-compressed protobuf WriteRequest.
+func (pm *PrometheusManager) remoteWrite(ctx context.Context, client *http.Client, cfg PushConfig) error {
+	external := map[string]string{"job": cfg.Job}
+	for k, v := range cfg.Grouping {
+		external[k] = v
+	}
+	payload := encodeWriteRequest(pm.collectSamples(), external, time.Now().UnixMilli())
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.RemoteWrite.URL, bytes.NewReader(snappyEncode(payload)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	for k, v := range cfg.RemoteWrite.Headers {
+		req.Header.Set(k, v)
+	}
+	return doPushRequest(client, req)
+}
+
+// doPushRequest sends the request and turns non-2xx responses into errors.
+func doPushRequest(client *http.Client, req *http.Request) error {
+	req.Header.Set("User-Agent", "logz")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s returned %s: %s", req.URL.Redacted(), resp.Status, strings.TrimSpace(string(msg)))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// metricSample is a single sample of the exposition, as sent by remote write.
+type metricSample struct {
+	name   string
+	labels map[string]string
+	value  float64
+}
+
+// collectSamples flattens the exported families into samples, expanding histograms and summaries
+// into their bucket, quantile, sum and count series.
+func (pm *PrometheusManager) collectSamples() []metricSample {
+	pm.runCollectors()
+	pm.mutex.RLock()
+	defer pm.mutex.RUnlock()
+	var samples []metricSample
+	withLabel := func(labels map[string]string, name, value string) map[string]string {
+		cp := make(map[string]string, len(labels)+1)
+		for k, v := range labels {
+			cp[k] = v
+		}
+		cp[name] = value
+		return cp
+	}
+	for name, f := range pm.families {
+		if !pm.exported(name) {
+			continue
+		}
+		for _, series := range f.Series {
+			s := series.snapshot()
+			switch f.Type {
+			case HistogramMetric:
+				var cumulative uint64
+				for i, bound := range f.Buckets {
+					cumulative += s.Buckets[i]
+					samples = append(samples, metricSample{name + "_bucket", withLabel(s.Labels, "le", formatFloat(bound)), float64(cumulative)})
+				}
+				samples = append(samples,
+					metricSample{name + "_bucket", withLabel(s.Labels, "le", "+Inf"), float64(s.Count)},
+					metricSample{name + "_sum", s.Labels, s.Sum},
+					metricSample{name + "_count", s.Labels, float64(s.Count)})
+			case SummaryMetric:
+				sorted := s.Samples
+				sort.Float64s(sorted)
+				for _, q := range f.Quantiles {
+					samples = append(samples, metricSample{name, withLabel(s.Labels, "quantile", formatFloat(q)), quantile(sorted, q)})
+				}
+				samples = append(samples,
+					metricSample{name + "_sum", s.Labels, s.Sum},
+					metricSample{name + "_count", s.Labels, float64(s.Count)})
+			default:
+				samples = append(samples, metricSample{name, s.Labels, s.Value})
+			}
+		}
+	}
+	return samples
+}
+
+// encodeWriteRequest encodes the samples as a remote-write WriteRequest protobuf message:
+//
+//	WriteRequest { repeated TimeSeries timeseries = 1; }
+//	TimeSeries   { repeated Label labels = 1; repeated Sample samples = 2; }
+//	Label        { string name = 1; string value = 2; }
+//	Sample       { double value = 1; int64 timestamp = 2; }
+//
+// Labels are sorted by name, as required by the protocol. External labels do not override
+// labels of the series.
+func encodeWriteRequest(samples []metricSample, external map[string]string, timestamp int64) []byte {
+	var req, ts, buf []byte
+	for _, sample := range samples {
+		labels := map[string]string{"__name__": sample.name}
+		for k, v := range external {
+			labels[k] = v
+		}
+		for k, v := range sample.labels {
+			labels[k] = v
+		}
+		names := make([]string, 0, len(labels))
+		for name := range labels {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		ts = ts[:0]
+		for _, name := range names {
+			buf = protoAppendString(buf[:0], 1, name)
+			buf = protoAppendString(buf, 2, labels[name])
+			ts = protoAppendBytes(ts, 1, buf)
+		}
+		buf = protoAppendTag(buf[:0], 1, 1)
+		buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(sample.value))
+		buf = protoAppendTag(buf, 2, 0)
+		buf = binary.AppendUvarint(buf, uint64(timestamp))
+		ts = protoAppendBytes(ts, 2, buf)
+
+		req = protoAppendBytes(req, 1, ts)
+	}
+	return req
+}
+
+// protoAppendTag appends a protobuf field key.
+func protoAppendTag(b []byte, field, wireType int) []byte {
+	return binary.AppendUvarint(b, uint64(field<<3|wireType))
+}
+
+// protoAppendBytes appends a length-delimited protobuf field.
+func protoAppendBytes(b []byte, field int, data []byte) []byte {
+	b = protoAppendTag(b, field, 2)
+	b = binary.AppendUvarint(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+// protoAppendString appends a protobuf string field.
+func protoAppendString(b []byte, field int, s string) []byte {
+	b = protoAppendTag(b, field, 2)
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
@@ -0,0 +1,263 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// snappyDecode decompresses the snappy block format, to check what the remote-write encoder sends.
+func snappyDecode(src []byte) ([]byte, error) {
+	length, n := binary.Uvarint(src)
+	if n <= 0 {
+		return nil, errors.New("invalid snappy length")
+	}
+	src = src[n:]
+	dst := make([]byte, 0, length)
+	for len(src) > 0 {
+		tag := src[0]
+		var size, offset int
+		switch tag & 3 {
+		case 0:
+			size = int(tag>>2) + 1
+			src = src[1:]
+			if extra := size - 60; extra > 0 {
+				if len(src) < extra {
+					return nil, errors.New("truncated snappy literal length")
+				}
+				size = 0
+				for i := extra - 1; i >= 0; i-- {
+					size = size<<8 | int(src[i])
+				}
+				size++
+				src = src[extra:]
+			}
+			if len(src) < size {
+				return nil, errors.New("truncated snappy literal")
+			}
+			dst = append(dst, src[:size]...)
+			src = src[size:]
+			continue
+		case 1:
+			if len(src) < 2 {
+				return nil, errors.New("truncated snappy copy")
+			}
+			size = 4 + int(tag>>2&7)
+			offset = int(tag>>5)<<8 | int(src[1])
+			src = src[2:]
+		case 2:
+			if len(src) < 3 {
+				return nil, errors.New("truncated snappy copy")
+			}
+			size = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint16(src[1:]))
+			src = src[3:]
+		case 3:
+			if len(src) < 5 {
+				return nil, errors.New("truncated snappy copy")
+			}
+			size = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint32(src[1:]))
+			src = src[5:]
+		}
+		if offset <= 0 || offset > len(dst) {
+			return nil, errors.New("invalid snappy copy offset")
+		}
+		for i := 0; i < size; i++ {
+			dst = append(dst, dst[len(dst)-offset])
+		}
+	}
+	if uint64(len(dst)) != length {
+		return nil, errors.New("snappy length mismatch")
+	}
+	return dst, nil
+}
+
+// decodeWriteRequest decodes a remote-write WriteRequest into "name=value,..." label strings
+// mapped to the sample value, checking that labels are sorted and timestamps set.
+func decodeWriteRequest(t *testing.T, b []byte) map[string]float64 {
+	t.Helper()
+	series := make(map[string]float64)
+	err := protoReadFields(b, func(ts protoField) error {
+		var labels []string
+		var value float64
+		var timestamp uint64
+		err := protoReadFields(ts.data, func(f protoField) error {
+			switch f.num {
+			case 1:
+				var name, val string
+				err := protoReadFields(f.data, func(l protoField) error {
+					if l.num == 1 {
+						name = string(l.data)
+					} else {
+						val = string(l.data)
+					}
+					return nil
+				})
+				labels = append(labels, name+"="+val)
+				return err
+			case 2:
+				return protoReadFields(f.data, func(s protoField) error {
+					if s.num == 1 {
+						value = math.Float64frombits(s.int)
+					} else {
+						timestamp = s.int
+					}
+					return nil
+				})
+			}
+			return nil
+		})
+		if !sort.StringsAreSorted(labels) {
+			t.Errorf("labels not sorted: %v", labels)
+		}
+		if timestamp == 0 {
+			t.Errorf("sample of %v has no timestamp", labels)
+		}
+		series[strings.Join(labels, ",")] = value
+		return err
+	})
+	if err != nil {
+		t.Errorf("decode WriteRequest: %v", err)
+	}
+	return series
+}
+
+// pushTestManager returns a manager holding a counter and a histogram.
+func pushTestManager(t *testing.T) *PrometheusManager {
+	t.Helper()
+	pm := NewPrometheusManager()
+	if err := pm.DefineMetric(MetricDefinition{Name: "logz_test_total", Help: "Test counter.", Type: CounterMetric}); err != nil {
+		t.Fatalf("DefineMetric: %v", err)
+	}
+	if err := pm.DefineMetric(MetricDefinition{Name: "logz_test_seconds", Help: "Test histogram.", Type: HistogramMetric, Buckets: []float64{1}}); err != nil {
+		t.Fatalf("DefineMetric: %v", err)
+	}
+	_ = pm.Inc("logz_test_total", map[string]string{"level": "ERROR"}, 3)
+	_ = pm.Observe("logz_test_seconds", nil, 0.5)
+	return pm
+}
+
+func TestPushGateway(t *testing.T) {
+	var method, path, contentType, auth, body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		method, path, body = r.Method, r.URL.EscapedPath(), string(data)
+		contentType, auth = r.Header.Get("Content-Type"), r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	pm := pushTestManager(t)
+	err := pm.StartPush(PushConfig{URL: srv.URL, Job: "batch", Interval: time.Hour,
+		Grouping: map[string]string{"instance": "host/1"}, Headers: map[string]string{"Authorization": "Bearer x"}})
+	if err != nil {
+		t.Fatalf("StartPush: %v", err)
+	}
+	if err := pm.StopPush(); err != nil {
+		t.Fatalf("StopPush: %v", err)
+	}
+
+	if method != http.MethodPut {
+		t.Errorf("method = %s, want PUT", method)
+	}
+	if want := "/metrics/job/batch/instance@base64/aG9zdC8x"; path != want {
+		t.Errorf("path = %s, want %s", path, want)
+	}
+	if contentType != ContentTypePrometheusText || auth != "Bearer x" {
+		t.Errorf("headers: Content-Type %q, Authorization %q", contentType, auth)
+	}
+	for _, want := range []string{`logz_test_total{level="ERROR"} 3`, `logz_test_seconds_bucket{le="1"} 1`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("body misses %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestPushGatewayError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad grouping key", http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	pm := pushTestManager(t)
+	if err := pm.StartPush(PushConfig{URL: srv.URL, Interval: time.Hour}); err != nil {
+		t.Fatalf("StartPush: %v", err)
+	}
+	err := pm.StopPush()
+	if err == nil || !strings.Contains(err.Error(), "bad grouping key") {
+		t.Fatalf("StopPush error = %v", err)
+	}
+}
+
+func TestRemoteWrite(t *testing.T) {
+	var series map[string]float64
+	var encoding, version string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding, version = r.Header.Get("Content-Encoding"), r.Header.Get("X-Prometheus-Remote-Write-Version")
+		data, _ := io.ReadAll(r.Body)
+		decoded, err := snappyDecode(data)
+		if err != nil {
+			t.Errorf("snappy: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		series = decodeWriteRequest(t, decoded)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	pm := pushTestManager(t)
+	err := pm.StartPush(PushConfig{Job: "batch", Interval: time.Hour, Grouping: map[string]string{"instance": "a"},
+		RemoteWrite: &RemoteWriteConfig{URL: srv.URL}})
+	if err != nil {
+		t.Fatalf("StartPush: %v", err)
+	}
+	if err := pm.StopPush(); err != nil {
+		t.Fatalf("StopPush: %v", err)
+	}
+
+	if encoding != "snappy" || version != "0.1.0" {
+		t.Errorf("headers: Content-Encoding %q, version %q", encoding, version)
+	}
+	want := map[string]float64{
+		"__name__=logz_test_total,instance=a,job=batch,level=ERROR":      3,
+		"__name__=logz_test_seconds_bucket,instance=a,job=batch,le=1":    1,
+		"__name__=logz_test_seconds_bucket,instance=a,job=batch,le=+Inf": 1,
+		"__name__=logz_test_seconds_sum,instance=a,job=batch":            0.5,
+		"__name__=logz_test_seconds_count,instance=a,job=batch":          1,
+	}
+	if len(series) != len(want) {
+		t.Errorf("series = %v, want %v", series, want)
+	}
+	for labels, value := range want {
+		if got, ok := series[labels]; !ok || got != value {
+			t.Errorf("series %s = %v (present %v), want %v", labels, got, ok, value)
+		}
+	}
+}
+
+func TestSnappyRoundTrip(t *testing.T) {
+	inputs := [][]byte{
+		nil,
+		[]byte("short"),
+		bytes.Repeat([]byte("logz_test_total{level=\"ERROR\"} "), 5000),
+	}
+	for _, input := range inputs {
+		decoded, err := snappyDecode(snappyEncode(input))
+		if err != nil {
+			t.Fatalf("decode %d bytes: %v", len(input), err)
+		}
+		if !bytes.Equal(decoded, input) {
+			t.Fatalf("round trip of %d bytes returned %d different bytes", len(input), len(decoded))
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package logger
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFlushRetriesAfterFailedSnapshot(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "missing")
+	pm := NewPrometheusManager()
+	pm.metricsFile = filepath.Join(dir, "metrics.json")
+	if err := pm.DefineMetric(MetricDefinition{Name: "logz_test_total", Type: CounterMetric}); err != nil {
+		t.Fatalf("DefineMetric: %v", err)
+	}
+	_ = pm.Inc("logz_test_total", nil, 1)
+
+	if err := pm.Flush(); err == nil {
+		t.Fatal("Flush succeeded without the metrics directory")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := pm.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if _, err := os.Stat(pm.metricsFile); err != nil {
+		t.Fatalf("metrics not saved after the failed snapshot: %v", err)
+	}
+}
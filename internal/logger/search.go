@@ -0,0 +1,157 @@
+package logger
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultSearchLimit = 200
+	maxSearchLimit     = 1000
+	// searchScanLimit bounds the tail of the output file read by a search
+	searchScanLimit = 64 << 20
+)
+
+// SearchResult is the answer to a search over the recent entries of the service.
+type SearchResult struct {
+	Entries []*LogEntry `json:"entries"` // Matching entries, newest first.
+	Source  string      `json:"source"`  // "file" for the output file, "memory" for the stream backlog.
+	Scanned int         `json:"scanned"` // Entries examined.
+	Partial bool        `json:"partial"` // Only the end of the output file was searched.
+}
+
+// entrySearch collects the last matching entries.
+type entrySearch struct {
+	matcher *streamMatcher
+	text    string // Lower-cased text the message must contain
+	limit   int
+	matches []*LogEntry // Ring of the last matches, next is the oldest once full
+	next    int
+	scanned int
+}
+
+// add examines an entry, keeping the last limit matches.
+func (s *entrySearch) add(le *LogEntry) {
+	s.scanned++
+	if !s.matcher.matches(le) {
+		return
+	}
+	if s.text != "" && !strings.Contains(strings.ToLower(le.Message), s.text) {
+		return
+	}
+	if len(s.matches) < s.limit {
+		s.matches = append(s.matches, le)
+		return
+	}
+	s.matches[s.next] = le
+	s.next = (s.next + 1) % s.limit
+}
+
+// newest returns the matches, newest first.
+func (s *entrySearch) newest() []*LogEntry {
+	entries := make([]*LogEntry, 0, len(s.matches))
+	for i := len(s.matches) - 1; i >= 0; i-- {
+		entries = append(entries, s.matches[(s.next+i)%len(s.matches)])
+	}
+	return entries
+}
+
+// searchEntries returns the last entries matching the filter and containing text in their
+// message. The output file is searched when the service writes JSON to a file, and the stream
+// backlog otherwise, since text lines cannot be read back into entries.
+func searchEntries(matcher *streamMatcher, text string, limit int) (*SearchResult, error) {
+	search := &entrySearch{matcher: matcher, text: strings.ToLower(text), limit: limit}
+	output, format := globalLogger.outputFile()
+	if output == "" || format != string(JSON) {
+		for _, le := range logStreams.recent() {
+			search.add(le)
+		}
+		return &SearchResult{Entries: search.newest(), Source: "memory", Scanned: search.scanned}, nil
+	}
+
+	partial, err := scanLogFile(output, search.add)
+	if err != nil {
+		return nil, err
+	}
+	return &SearchResult{Entries: search.newest(), Source: "file", Scanned: search.scanned, Partial: partial}, nil
+}
+
+// scanLogFile calls fn for each JSON entry in the last searchScanLimit bytes of a log file,
+// skipping the lines that are not entries. It reports whether the start of the file was skipped.
+func scanLogFile(path string, fn func(*LogEntry)) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, fmt.Errorf("failed to open the output file: %w", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return false, fmt.Errorf("failed to read the output file: %w", err)
+	}
+	partial := info.Size() > searchScanLimit
+	if partial {
+		if _, err := f.Seek(info.Size()-searchScanLimit, io.SeekStart); err != nil {
+			return false, fmt.Errorf("failed to read the output file: %w", err)
+		}
+	}
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), maxIngestBodySize)
+	if partial {
+		// The first line is likely cut
+		scanner.Scan()
+	}
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 || line[0] != '{' {
+			continue
+		}
+		var le LogEntry
+		if err := json.Unmarshal(line, &le); err != nil || le.Level == "" {
+			continue
+		}
+		fn(&le)
+	}
+	if err := scanner.Err(); err != nil {
+		return partial, fmt.Errorf("failed to read the output file: %w", err)
+	}
+	return partial, nil
+}
+
+// searchHandler searches the recent entries with the filter of /stream, plus text (in the
+// message) and limit (200 by default, up to 1000).
+func searchHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter, err := ParseStreamFilter(query)
+	if err != nil {
+		writeAdminError(w, http.StatusBadRequest, err)
+		return
+	}
+	matcher, err := filter.compile()
+	if err != nil {
+		writeAdminError(w, http.StatusBadRequest, err)
+		return
+	}
+	limit := defaultSearchLimit
+	if value := query.Get("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 {
+			writeAdminError(w, http.StatusBadRequest, errors.New("limit must be a positive integer"))
+			return
+		}
+		limit = min(limit, maxSearchLimit)
+	}
+
+	result, err := searchEntries(matcher, query.Get("text"), limit)
+	if err != nil {
+		writeAdminError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, result)
+}
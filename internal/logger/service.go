@@ -2,7 +2,6 @@ package logger
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/godbus/dbus/v5"
@@ -27,8 +26,12 @@ const (
 )
 
 var (
-	lSrv    *http.Server
-	lClient *http.Client
+	lSrv     *http.Server
+	lAdmin   *http.Server // Admin API served on the local unix socket
+	lClient  *http.Client
+	lUnix    string            // Path of the service's unix socket listener, if any
+	lSyslog  []*SyslogListener // Syslog receivers of the service
+	lPidFile *pidLock          // PID file locked by the running service
 	// Temporarily disabled due to external dependency on zmq4
 	// Uncomment and ensure the required libraries are installed if needed in the future
 	//lSocket      *zmq4.Socket
@@ -37,14 +40,27 @@ var (
 	startTime    = time.Now()
 )
 
-// Run starts the logging service.
-func Run() error {
-	// Check if the service is already running to avoid multiple instances
-	if IsRunning() {
-		if stopErr := shutdown(); stopErr != nil {
-			return stopErr
-		}
+// Run starts the logging service and serves until SIGINT or SIGTERM.
+func Run() (err error) {
+	// Report the outcome of the startup to 'logz service start', if it spawned the service
+	ready := openReadyPipe()
+	defer func() { ready.signal(err) }()
+
+	// The PID file stays locked while the service runs, so a second instance stops here
+	lPidFile, err = acquirePidFile(getPidPath())
+	if err != nil {
+		return err
 	}
+	serving := false
+	defer func() {
+		if err != nil && !serving {
+			if lAdmin != nil {
+				_ = lAdmin.Close()
+				_ = os.Remove(getAdminSocketPath())
+			}
+			_ = lPidFile.release()
+		}
+	}()
 
 	// Initialize the ConfigManager and load the configuration
 	configManager := NewConfigManager()
@@ -58,9 +74,51 @@ func Run() error {
 		return fmt.Errorf("failed to load config: %w", err)
 	}
 
+	// Keep the last entries for /stream clients resuming after a disconnection
+	logStreams = newStreamHub(config.GetInt("streamBacklog", defaultStreamBacklog))
+
 	// Initialize the global logger with the configuration
 	initializeGlobalLogger(config)
 
+	// Persist metrics periodically instead of on every update
+	snapshotInterval := time.Duration(config.GetInt("metricsSnapshotInterval", int(defaultSnapshotInterval/time.Second))) * time.Second
+	pm := GetPrometheusManager()
+	pm.StartSnapshots(snapshotInterval)
+
+	// Built-in collectors, and the queues of the service's notifiers and writer
+	pm.EnableCollectors(config.MetricsCollectors())
+	pm.RegisterQueueSource(func() map[string]int {
+		depths := make(map[string]int)
+		notifiers := globalLogger.GetConfig().NotifierManager()
+		for _, name := range notifiers.ListNotifiers() {
+			if notifier, ok := notifiers.GetNotifier(name); ok {
+				if queue, ok := notifier.(QueueDepther); ok {
+					depths["notifier:"+name] = queue.QueueDepth()
+				}
+			}
+		}
+		if queue, ok := globalLogger.GetWriter().(QueueDepther); ok {
+			depths["writer"] = queue.QueueDepth()
+		}
+		return depths
+	})
+
+	// The metrics exporter lives in the service; "metricsPort" enables it on start and
+	// "metricsDiscovery" lists it in a Prometheus file_sd target file while it runs
+	pm.SetDiscovery(config.MetricsDiscovery())
+	if metricsPort := config.GetInt("metricsPort", 0); metricsPort > 0 {
+		if err := pm.Enable(strconv.Itoa(metricsPort)); err != nil {
+			globalLogger.Error(fmt.Sprintf("Failed to enable metrics exporter: %v", err), nil)
+		}
+	}
+
+	// Serve the admin API used by the CLI
+	admin, err := listenAdmin()
+	if err != nil {
+		return err
+	}
+	lAdmin = admin
+
 	// Set up the HTTP server
 	mux := http.NewServeMux()
 	if err := registerHandlers(mux); err != nil {
@@ -74,84 +132,202 @@ func Run() error {
 		WriteTimeout: config.WriteTimeout(),
 		IdleTimeout:  config.IdleTimeout(),
 	}
+	// Stream clients stay connected until the service ends them
+	lSrv.RegisterOnShutdown(func() { logStreams.disconnectAll() })
+
+	// Open the TCP, TLS and unix socket listeners
+	listenersCfg, err := loadListenersConfig(viper.GetViper())
+	if err != nil {
+		return fmt.Errorf("invalid listeners configuration: %w", err)
+	}
+	listeners, err := openListeners(config.Address(), listenersCfg)
+	if err != nil {
+		return err
+	}
+	if listenersCfg.UnixSocket != nil {
+		lUnix = listenersCfg.UnixSocket.Path
+	}
+
+	// Open the syslog listeners, whose entries go through the same pipeline as the ingested ones
+	syslogCfgs, err := loadSyslogConfig(viper.GetViper())
+	if err != nil {
+		return fmt.Errorf("invalid syslog configuration: %w", err)
+	}
+	for _, cfg := range syslogCfgs {
+		listener, err := ListenSyslog(cfg, func(entry *LogEntry) { globalLogger.Ingest(entry) })
+		if err != nil {
+			closeSyslogListeners()
+			return err
+		}
+		lSyslog = append(lSyslog, listener)
+	}
 
-	// Start the HTTP server
+	// Start the HTTP server. SIGHUP reloads the configuration and SIGUSR1 toggles DEBUG
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
-	go func() {
-		globalLogger.Info(fmt.Sprintf("Service running on %s", config.Address()), nil)
-		if err := lSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-			globalLogger.Error(fmt.Sprintf("Service encountered an error: %v", err), nil)
+	control := make(chan os.Signal, 1)
+	signal.Notify(control, syscall.SIGHUP, syscall.SIGUSR1)
+	descriptions := make([]string, 0, len(listeners))
+	for _, l := range listeners {
+		descriptions = append(descriptions, l.description)
+		go func(l serviceListener) {
+			globalLogger.Info(fmt.Sprintf("Service running on %s", l.description), nil)
+			if err := lSrv.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				globalLogger.Error(fmt.Sprintf("Service encountered an error on %s: %v", l.description, err), nil)
+			}
+		}(l)
+	}
+	for _, l := range lSyslog {
+		descriptions = append(descriptions, l.String())
+		globalLogger.Info(fmt.Sprintf("Syslog receiver running on %s", l), nil)
+	}
+	serving = true
+	if err := lPidFile.write(strings.Join(descriptions, " ")); err != nil {
+		globalLogger.Error(err.Error(), nil)
+	}
+	ready.signal(nil)
+
+	for {
+		select {
+		case <-stop:
+			return shutdown()
+		case sig := <-control:
+			if sig == syscall.SIGUSR1 {
+				level := globalLogger.ToggleDebug()
+				globalLogger.Warn(fmt.Sprintf("Log level switched to %s (SIGUSR1)", level), nil)
+				continue
+			}
+			if err := reload(cfgMgr); err != nil {
+				globalLogger.Error(fmt.Sprintf("Reload failed, keeping the current configuration: %v", err), nil)
+			}
 		}
-	}()
+	}
+}
 
-	<-stop
-	return shutdown()
+// reload re-reads the configuration and switches the service to it: writer, formatter, level,
+// notifiers and metric rules. Output files are reopened, so external rotators only need to send
+// SIGHUP. Listeners, authentication and the metrics exporters keep their settings until a restart.
+func reload(cfgMgr ConfigManager) error {
+	config, err := cfgMgr.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	globalLogger.Reload(config)
+	GetPrometheusManager().EnableCollectors(config.MetricsCollectors())
+	globalLogger.Info("Configuration reloaded", nil)
+	return nil
 }
 
-// Start initiates the logging service on the specified port.
-func Start(port string) error {
-	if IsRunning() {
-		return errors.New("service already running (pid file exists: " + getPidPath() + ")")
+// Start spawns the service in the background and waits until it serves requests, up to the
+// timeout. It returns the pid of the service.
+func Start(timeout time.Duration) (int, error) {
+	if state, err := InspectService(); err == nil && state.Alive {
+		return 0, fmt.Errorf("%w with pid %d", ErrServiceRunning, state.PID)
 	}
 
 	// Use Viper to load runtime configuration
 	vpr := viper.GetViper()
 	if vpr == nil {
-		return errors.New("viper not initialized")
+		return 0, errors.New("viper not initialized")
+	}
+
+	// The service reports its readiness, or why it failed to start, on a pipe passed as fd 3
+	readyR, readyW, err := os.Pipe()
+	if err != nil {
+		return 0, fmt.Errorf("failed to create readiness pipe: %w", err)
 	}
+	defer readyR.Close()
 
 	cmd := exec.Command(os.Args[0], "service", "spawn", "-c", vpr.ConfigFileUsed())
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = []*os.File{readyW}
+	cmd.Env = append(os.Environ(), readyFDEnv+"=3")
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true} // Outlive the terminal of the CLI
 
-	if err := cmd.Start(); err != nil {
-		return fmt.Errorf("failed to start service: %w", err)
-	}
-
-	file, err := os.OpenFile(getPidPath(), os.O_WRONLY|os.O_CREATE, 0644)
+	err = cmd.Start()
+	_ = readyW.Close()
 	if err != nil {
-		return fmt.Errorf("failed to open PID file: %w", err)
-	}
-	defer file.Close()
-
-	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
-		return errors.New("another process is writing to the PID file")
+		return 0, fmt.Errorf("failed to start service: %w", err)
 	}
 
 	pid := cmd.Process.Pid
-	pidData := fmt.Sprintf("%d\n%s", pid, port)
-	if _, writeErr := file.Write([]byte(pidData)); writeErr != nil {
-		return fmt.Errorf("failed to write PID data: %w", writeErr)
+	if err := waitReady(readyR, timeout); err != nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return 0, fmt.Errorf("failed to start service: %w", err)
 	}
-
-	globalLogger.Info(fmt.Sprintf("Service started with pid %d", pid), nil)
-	return nil
+	_ = cmd.Process.Release()
+	return pid, nil
 }
 
-// Stop terminates the running logging service.
-func Stop() error {
-	pid, port, pidPath, err := GetServiceInfo()
+// Stop asks the running service to shut down with SIGTERM and waits for it up to the timeout,
+// then kills it with SIGKILL. It returns the pid of the service and whether it had to be killed.
+func Stop(timeout time.Duration) (int, bool, error) {
+	state, err := InspectService()
 	if err != nil {
-		return err
+		return 0, false, ErrServiceNotRunning
+	}
+	if !state.Alive {
+		removeStalePidFile(state.PidFile)
+		return state.PID, false, fmt.Errorf("service is not running (removed the stale PID file of pid %d)", state.PID)
 	}
 
-	process, err := os.FindProcess(pid)
+	process, err := os.FindProcess(state.PID)
 	if err != nil {
-		return fmt.Errorf("failed to find process: %w", err)
+		return state.PID, false, fmt.Errorf("failed to find process: %w", err)
 	}
-
 	if err := process.Signal(syscall.SIGTERM); err != nil {
-		return fmt.Errorf("failed to stop process: %w", err)
+		return state.PID, false, fmt.Errorf("failed to stop process: %w", err)
+	}
+	if waitStopped(state, timeout) {
+		return state.PID, false, nil
 	}
 
-	time.Sleep(1 * time.Second)
-	if err := os.Remove(pidPath); err != nil {
-		return err
+	if err := process.Signal(syscall.SIGKILL); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return state.PID, false, fmt.Errorf("failed to kill process: %w", err)
 	}
+	if !waitStopped(state, 5*time.Second) {
+		return state.PID, true, fmt.Errorf("service with pid %d did not exit after SIGKILL", state.PID)
+	}
+	// A killed service leaves its PID file and admin socket behind
+	removeStalePidFile(state.PidFile)
+	_ = os.Remove(getAdminSocketPath())
+	return state.PID, true, nil
+}
 
-	globalLogger.Info(fmt.Sprintf("Service with pid %d and port %s stopped", pid, port), nil)
-	return nil
+// Reload asks the running service to reload its configuration and reopen its output files with
+// SIGHUP. It returns the pid of the service.
+func Reload() (int, error) {
+	state, err := InspectService()
+	if err != nil || !state.Alive {
+		return 0, ErrServiceNotRunning
+	}
+	if err := syscall.Kill(state.PID, syscall.SIGHUP); err != nil {
+		return state.PID, fmt.Errorf("failed to signal process: %w", err)
+	}
+	return state.PID, nil
+}
+
+// waitStopped polls the service until it released its PID file or exited, up to the timeout.
+func waitStopped(state *ServiceState, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		if !pidFileLocked(state.PidFile) || !processAlive(state.PID) {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// removeStalePidFile removes the PID file unless a running service holds it.
+func removeStalePidFile(path string) {
+	if !pidFileLocked(path) {
+		_ = os.Remove(path)
+	}
 }
 
 // Server returns the HTTP server instance.
@@ -201,33 +377,52 @@ func getPidPath() string {
 	return cacheDir
 }
 
-// IsRunning checks if the service is currently running.
-func IsRunning() bool {
-	_, err := os.Stat(getPidPath())
-	return err == nil
+// ServiceState describes the service recorded in the PID file.
+type ServiceState struct {
+	PID     int    `json:"pid"`
+	Address string `json:"address"`
+	PidFile string `json:"pidFile"`
+	Alive   bool   `json:"alive"`   // The process exists (kill 0) and holds the PID file lock.
+	Healthy bool   `json:"healthy"` // The service answers on its admin socket.
+	Uptime  string `json:"uptime,omitempty"`
 }
 
-// GetServiceInfo retrieves the PID, port, and PID file path of the running service.
-func GetServiceInfo() (int, string, string, error) {
+// InspectService checks the service recorded in the PID file. A PID file whose process died or
+// whose lock is not held anymore is reported as not alive. It returns os.ErrNotExist when there is
+// no PID file.
+func InspectService() (*ServiceState, error) {
 	pidPath := getPidPath()
-
-	data, err := os.ReadFile(pidPath)
+	pid, address, err := readPidFile(pidPath)
 	if err != nil {
-		return 0, "", "", os.ErrNotExist
+		return nil, err
 	}
 
-	lines := strings.Split(string(data), "\n")
-	pid, pidErr := strconv.Atoi(lines[0])
-	if pidErr != nil {
-		return 0, "", "", os.ErrInvalid
+	state := &ServiceState{PID: pid, Address: address, PidFile: pidPath}
+	state.Alive = pidFileLocked(pidPath) && processAlive(pid)
+	if state.Alive {
+		client := NewAdminClient()
+		client.client.Timeout = 2 * time.Second
+		if health, healthErr := client.Health(); healthErr == nil && health.PID == pid {
+			state.Healthy = true
+			state.Uptime = health.Uptime
+		}
 	}
+	return state, nil
+}
 
-	port := "unknown"
-	if len(lines) > 1 {
-		port = lines[1]
-	}
+// IsRunning checks if the service is currently running.
+func IsRunning() bool {
+	state, err := InspectService()
+	return err == nil && state.Alive
+}
 
-	return pid, port, pidPath, nil
+// GetServiceInfo retrieves the PID, addresses, and PID file path of the running service.
+func GetServiceInfo() (int, string, string, error) {
+	state, err := InspectService()
+	if err != nil || !state.Alive {
+		return 0, "", "", os.ErrNotExist
+	}
+	return state.PID, state.Address, state.PidFile, nil
 }
 
 // registerHandlers registers HTTP handlers for the service.
@@ -237,6 +432,15 @@ func registerHandlers(mux *http.ServeMux) error {
 		return errors.New("no integrations configured")
 	}
 
+	authCfg, err := loadAuthConfig(viper.GetViper())
+	if err != nil {
+		return fmt.Errorf("invalid auth configuration: %w", err)
+	}
+	auth := newAuthMiddleware(authCfg)
+	if auth.open {
+		globalLogger.Warn("No credentials configured: service endpoints are not authenticated", nil)
+	}
+
 	for path := range integrations {
 		if !viper.GetBool("integrations." + path + ".enabled") {
 			continue
@@ -246,38 +450,36 @@ func registerHandlers(mux *http.ServeMux) error {
 		metricsPath, _ := url.JoinPath("/", path, "/metrics")
 		callbackPath, _ := url.JoinPath("/", path, "/receive")
 
-		mux.HandleFunc(healthPath, healthHandler)
-		mux.HandleFunc(metricsPath, metricsHandler)
-		mux.HandleFunc(callbackPath, callbackHandler)
-	}
-
-	return nil
-}
+		mux.Handle(healthPath, auth.require(ScopeRead, path, http.HandlerFunc(healthHandler)))
+		mux.Handle(metricsPath, auth.require(ScopeRead, path, http.HandlerFunc(metricsHandler)))
+		mux.Handle(callbackPath, auth.require(ScopeIngest, path, ingestHandler(path)))
 
-// callbackHandler handles incoming callback requests.
-func callbackHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+		// The "otlp" integration also receives OpenTelemetry logs on the standard OTLP/HTTP path
+		if path == otlpIntegration {
+			mux.Handle(otlpLogsPath, auth.require(ScopeIngest, path, otlpLogsHandler(path)))
+		}
 	}
 
-	// Limit the payload size to prevent abuse
-	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+	// Live entries for read-scoped clients
+	mux.Handle(streamPath, auth.require(ScopeRead, "", http.HandlerFunc(streamHandler)))
 
-	var payload map[string]interface{}
-	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
-		return
-	}
+	// The web UI, whose API also requires the read scope
+	uiMux := http.NewServeMux()
+	registerWebUIHandlers(uiMux)
+	mux.Handle(webUIAPIPath, auth.require(ScopeRead, "", uiMux))
+	mux.Handle(webUIPath, webUIHandler())
+	mux.Handle("GET /{$}", http.RedirectHandler(webUIPath, http.StatusFound))
 
-	if _, ok := payload["message"]; !ok {
-		http.Error(w, "Missing 'message' in payload", http.StatusBadRequest)
-		return
+	// The admin API can add exec notifiers: without credentials it stays on the admin socket
+	if auth.open {
+		globalLogger.Info("Admin API only served on the admin socket: configure credentials to serve it under /admin/", nil)
+		return nil
 	}
+	adminMux := http.NewServeMux()
+	registerAdminHandlers(adminMux)
+	mux.Handle("/admin/", auth.require(ScopeAdmin, "", adminMux))
 
-	globalLogger.Info(fmt.Sprintf("Callback received: %v", payload), nil)
-	w.WriteHeader(http.StatusOK)
-	_, _ = w.Write([]byte(`{"status":"success","message":"Callback processed"}`))
+	return nil
 }
 
 // healthHandler handles health check requests.
@@ -288,26 +490,24 @@ func healthHandler(w http.ResponseWriter, _ *http.Request) {
 	_, _ = w.Write([]byte(response))
 }
 
-// metricsHandler handles metrics requests.
-func metricsHandler(w http.ResponseWriter, _ *http.Request) {
+// metricsHandler handles metrics requests in the Prometheus text or OpenMetrics format.
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
 	pm := GetPrometheusManager()
 	if !pm.IsEnabled() {
 		http.Error(w, "Prometheus integration is not enabled", http.StatusForbidden)
 		return
 	}
+	pm.ServeMetrics(w, r)
+}
 
-	metrics := pm.GetMetrics()
-	if len(metrics) == 0 {
-		w.WriteHeader(http.StatusNoContent)
-		return
-	}
-
-	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
-	for name, value := range metrics {
-		if _, err := fmt.Fprintf(w, "# HELP %s Custom metric from Logz\n# TYPE %s gauge\n%s %f\n", name, name, name, value); err != nil {
-			fmt.Println(fmt.Sprintf("Error writing metric '%s': %v", name, err))
+// closeSyslogListeners stops the syslog listeners.
+func closeSyslogListeners() {
+	for _, l := range lSyslog {
+		if err := l.Close(); err != nil {
+			log.Printf("Error closing syslog listener %s: %v\n", l, err)
 		}
 	}
+	lSyslog = nil
 }
 
 // loggingMiddleware logs incoming HTTP requests.
@@ -318,17 +518,55 @@ func loggingMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-// shutdown gracefully shuts down the service.
+// shutdown gracefully shuts down the service and releases its PID file.
 func shutdown() error {
 	globalLogger.Info("Shutting down service gracefully...", nil)
+	defer func() {
+		if err := lPidFile.release(); err != nil {
+			globalLogger.Error(fmt.Sprintf("Failed to remove PID file: %v", err), nil)
+		}
+	}()
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	// Connections still open after the timeout are dropped, and the cleanup goes on
+	var shutdownErr error
 	if err := lSrv.Shutdown(ctx); err != nil {
 		globalLogger.Error(fmt.Sprintf("Service shutdown failed: %v", err), nil)
-		return fmt.Errorf("shutdown process failed: %w", err)
+		shutdownErr = fmt.Errorf("shutdown process failed: %w", err)
+		_ = lSrv.Close()
+	}
+	if lUnix != "" {
+		_ = os.Remove(lUnix)
+	}
+	closeSyslogListeners()
+
+	if lAdmin != nil {
+		adminCtx, adminCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := lAdmin.Shutdown(adminCtx); err != nil {
+			_ = lAdmin.Close()
+		}
+		adminCancel()
+		_ = os.Remove(getAdminSocketPath())
 	}
 
+	pm := GetPrometheusManager()
+	if pm.IsEnabled() {
+		_ = pm.Disable()
+	}
+	if err := pm.StopPush(); err != nil {
+		globalLogger.Error(fmt.Sprintf("Failed to push metrics: %v", err), nil)
+	}
+	if err := StopStatsD(); err != nil {
+		globalLogger.Error(fmt.Sprintf("Failed to flush StatsD metrics: %v", err), nil)
+	}
+	if err := pm.StopSnapshots(); err != nil {
+		globalLogger.Error(fmt.Sprintf("Failed to save metrics: %v", err), nil)
+	}
+
+	if shutdownErr != nil {
+		return shutdownErr
+	}
 	globalLogger.Info("Service stopped gracefully.", nil)
 	return nil
 }
@@ -0,0 +1,318 @@
+package logger
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// silenceReloadInterval limits how often the silences file is checked for changes.
+const silenceReloadInterval = time.Second
+
+// Silence mutes notifications matching its matchers until it expires.
+// Empty matchers match everything.
+type Silence struct {
+	ID        string    `json:"id"`
+	Notifier  string    `json:"notifier,omitempty"` // Name of the notifier to mute, empty for all.
+	Level     LogLevel  `json:"level,omitempty"`    // Level to mute.
+	Source    string    `json:"source,omitempty"`   // Source to mute.
+	Message   string    `json:"message,omitempty"`  // Regular expression matched against the message.
+	Comment   string    `json:"comment,omitempty"`
+	CreatedBy string    `json:"createdBy,omitempty"`
+	StartsAt  time.Time `json:"startsAt"`
+	EndsAt    time.Time `json:"endsAt"`
+
+	messageRegex *regexp.Regexp
+}
+
+// Active reports whether the silence is in effect at the given time.
+func (s *Silence) Active(at time.Time) bool {
+	return !at.Before(s.StartsAt) && at.Before(s.EndsAt)
+}
+
+// Matches reports whether the silence mutes the entry for the given notifier.
+func (s *Silence) Matches(notifier string, entry LogzEntry) bool {
+	if s.Notifier != "" && s.Notifier != notifier {
+		return false
+	}
+	if s.Level != "" && !strings.EqualFold(string(s.Level), string(entry.GetLevel())) {
+		return false
+	}
+	if s.Source != "" && s.Source != entry.GetSource() {
+		return false
+	}
+	if s.messageRegex != nil && !s.messageRegex.MatchString(entry.GetMessage()) {
+		return false
+	}
+	return true
+}
+
+// compile validates the silence and prepares its message matcher.
+func (s *Silence) compile() error {
+	if !s.EndsAt.After(s.StartsAt) {
+		return fmt.Errorf("silence '%s': end must be after start", s.ID)
+	}
+	if s.Level != "" {
+		if _, ok := logLevels[LogLevel(strings.ToUpper(string(s.Level)))]; !ok {
+			return fmt.Errorf("silence '%s': invalid level '%s'", s.ID, s.Level)
+		}
+	}
+	s.messageRegex = nil
+	if s.Message != "" {
+		re, err := regexp.Compile(s.Message)
+		if err != nil {
+			return fmt.Errorf("silence '%s': invalid message pattern: %w", s.ID, err)
+		}
+		s.messageRegex = re
+	}
+	return nil
+}
+
+// SilenceStore keeps the silences persisted next to the configuration file and
+// reloads them when another process (e.g. the CLI) changes the file.
+type SilenceStore struct {
+	path      string
+	silences  []*Silence
+	modTime   time.Time
+	lastCheck time.Time
+	mutex     sync.RWMutex
+	now       func() time.Time // Clock deciding which silences are active, replaced in tests
+}
+
+// Singleton instance of SilenceStore
+var silenceStoreInstance *SilenceStore
+var silenceStoreOnce sync.Once
+
+// getSilencesFilePath returns the path to the silences file, next to config.json.
+func getSilencesFilePath() string {
+	if envPath := os.Getenv("LOGZ_SILENCES_FILE"); envPath != "" {
+		return envPath
+	}
+	return filepath.Join(filepath.Dir(GetLogPath()), "silences.json")
+}
+
+// GetSilenceStore returns the singleton instance of SilenceStore, initializing it if necessary.
+func GetSilenceStore() *SilenceStore {
+	silenceStoreOnce.Do(func() {
+		silenceStoreInstance = newSilenceStore(getSilencesFilePath())
+		if err := silenceStoreInstance.load(); err != nil {
+			fmt.Printf("Warning: could not load silences: %v\n", err)
+		}
+	})
+	return silenceStoreInstance
+}
+
+// newSilenceStore creates a store persisted to the given file, without loading it.
+func newSilenceStore(path string) *SilenceStore {
+	return &SilenceStore{path: path, now: time.Now}
+}
+
+// lockSilencesFile takes an exclusive advisory flock on the lock file next to the silences file,
+// so that two processes adding or expiring silences never lose each other's changes. The
+// returned function releases it.
+func (ss *SilenceStore) lockSilencesFile() (func(), error) {
+	lockFile, err := os.OpenFile(ss.path+".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open silences lock file: %w", err)
+	}
+	if err := syscall.Flock(int(lockFile.Fd()), syscall.LOCK_EX); err != nil {
+		_ = lockFile.Close()
+		return nil, fmt.Errorf("failed to lock silences file: %w", err)
+	}
+	return func() {
+		_ = syscall.Flock(int(lockFile.Fd()), syscall.LOCK_UN)
+		_ = lockFile.Close()
+	}, nil
+}
+
+// load reads the silences file, replacing the in-memory silences.
+func (ss *SilenceStore) load() error {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+	info, err := os.Stat(ss.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			ss.silences = nil
+			return nil
+		}
+		return err
+	}
+	data, err := os.ReadFile(ss.path)
+	if err != nil {
+		return err
+	}
+	var loaded []*Silence
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &loaded); err != nil {
+			return fmt.Errorf("failed to parse silences: %w", err)
+		}
+	}
+	valid := loaded[:0]
+	for _, s := range loaded {
+		if err := s.compile(); err != nil {
+			fmt.Printf("Warning: ignoring %v\n", err)
+			continue
+		}
+		valid = append(valid, s)
+	}
+	ss.silences = valid
+	ss.modTime = info.ModTime()
+	return nil
+}
+
+// save writes the silences to disk atomically, dropping those that have expired. Callers hold
+// the lock of the silences file.
+func (ss *SilenceStore) save() error {
+	now := ss.now()
+	kept := make([]*Silence, 0, len(ss.silences))
+	for _, s := range ss.silences {
+		if now.Before(s.EndsAt) {
+			kept = append(kept, s)
+		}
+	}
+	ss.silences = kept
+	data, err := json.MarshalIndent(kept, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(ss.path), filepath.Base(ss.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary silences file: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write silences: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write silences: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return fmt.Errorf("failed to set silences file mode: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), ss.path); err != nil {
+		return fmt.Errorf("failed to replace silences: %w", err)
+	}
+	if info, err := os.Stat(ss.path); err == nil {
+		ss.modTime = info.ModTime()
+	}
+	return nil
+}
+
+// refresh reloads the file if it changed on disk, at most once per reload interval.
+func (ss *SilenceStore) refresh() {
+	ss.mutex.RLock()
+	due := ss.now().Sub(ss.lastCheck) >= silenceReloadInterval
+	modTime := ss.modTime
+	ss.mutex.RUnlock()
+	if !due {
+		return
+	}
+	ss.mutex.Lock()
+	ss.lastCheck = ss.now()
+	ss.mutex.Unlock()
+
+	info, err := os.Stat(ss.path)
+	if err != nil && !os.IsNotExist(err) {
+		return
+	}
+	if (info == nil && !modTime.IsZero()) || (info != nil && !info.ModTime().Equal(modTime)) {
+		if loadErr := ss.load(); loadErr != nil {
+			fmt.Printf("Warning: could not reload silences: %v\n", loadErr)
+		}
+	}
+}
+
+// Silenced reports whether an active silence mutes the entry for the given notifier.
+func (ss *SilenceStore) Silenced(notifier string, entry LogzEntry) bool {
+	ss.refresh()
+	now := ss.now()
+	ss.mutex.RLock()
+	defer ss.mutex.RUnlock()
+	for _, s := range ss.silences {
+		if s.Active(now) && s.Matches(notifier, entry) {
+			return true
+		}
+	}
+	return false
+}
+
+// Add validates and persists a new silence, assigning it an ID if missing.
+func (ss *SilenceStore) Add(s Silence) (*Silence, error) {
+	if s.ID == "" {
+		id := make([]byte, 6)
+		if _, err := rand.Read(id); err != nil {
+			return nil, fmt.Errorf("failed to generate silence id: %w", err)
+		}
+		s.ID = hex.EncodeToString(id)
+	}
+	if s.StartsAt.IsZero() {
+		s.StartsAt = ss.now()
+	}
+	s.Level = LogLevel(strings.ToUpper(string(s.Level)))
+	if err := s.compile(); err != nil {
+		return nil, err
+	}
+	unlock, err := ss.lockSilencesFile()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	if err := ss.load(); err != nil {
+		return nil, err
+	}
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+	ss.silences = append(ss.silences, &s)
+	if err := ss.save(); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// Expire ends the silence with the given ID immediately.
+func (ss *SilenceStore) Expire(id string) error {
+	unlock, err := ss.lockSilencesFile()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := ss.load(); err != nil {
+		return err
+	}
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+	for i, s := range ss.silences {
+		if s.ID == id {
+			ss.silences = append(ss.silences[:i], ss.silences[i+1:]...)
+			return ss.save()
+		}
+	}
+	return errors.New("silence not found: " + id)
+}
+
+// List returns the silences that have not expired yet, ordered by end time.
+func (ss *SilenceStore) List() []Silence {
+	ss.refresh()
+	now := ss.now()
+	ss.mutex.RLock()
+	defer ss.mutex.RUnlock()
+	list := make([]Silence, 0, len(ss.silences))
+	for _, s := range ss.silences {
+		if now.Before(s.EndsAt) {
+			list = append(list, *s)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].EndsAt.Before(list[j].EndsAt) })
+	return list
+}
@@ -0,0 +1,130 @@
+package logger
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSilenceMatches(t *testing.T) {
+	entry := NewLogEntry().WithLevel(ERROR).WithSource("api").WithMessage("disk /dev/sda1 full")
+	tests := []struct {
+		name     string
+		silence  Silence
+		notifier string
+		want     bool
+	}{
+		{"empty matchers", Silence{}, "mail", true},
+		{"notifier", Silence{Notifier: "mail"}, "mail", true},
+		{"other notifier", Silence{Notifier: "mail"}, "slack", false},
+		{"level", Silence{Level: "error"}, "mail", true},
+		{"other level", Silence{Level: WARN}, "mail", false},
+		{"source", Silence{Source: "api"}, "mail", true},
+		{"other source", Silence{Source: "db"}, "mail", false},
+		{"message pattern", Silence{Message: `disk .* full`}, "mail", true},
+		{"other message", Silence{Message: `^network`}, "mail", false},
+		{"all matchers", Silence{Notifier: "mail", Level: ERROR, Source: "api", Message: "sda"}, "mail", true},
+		{"one matcher differs", Silence{Notifier: "mail", Level: ERROR, Source: "db", Message: "sda"}, "mail", false},
+	}
+	for _, tt := range tests {
+		s := tt.silence
+		s.ID, s.EndsAt = "test", time.Now().Add(time.Hour)
+		if err := s.compile(); err != nil {
+			t.Fatalf("%s: compile: %v", tt.name, err)
+		}
+		if got := s.Matches(tt.notifier, entry); got != tt.want {
+			t.Errorf("%s: Matches = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSilenceStoreExpiry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "silences.json")
+	clock := newFakeClock()
+	store := newSilenceStore(path)
+	store.now = clock.Now
+	entry := NewLogEntry().WithLevel(ERROR).WithSource("api").WithMessage("timeout")
+
+	s, err := store.Add(Silence{Source: "api", Level: "error", EndsAt: clock.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if s.ID == "" || !s.StartsAt.Equal(clock.Now()) || s.Level != ERROR {
+		t.Fatalf("silence = %+v", s)
+	}
+	if !store.Silenced("mail", entry) {
+		t.Fatal("entry not silenced")
+	}
+	if store.Silenced("mail", NewLogEntry().WithLevel(ERROR).WithSource("db").WithMessage("timeout")) {
+		t.Fatal("entry of another source silenced")
+	}
+
+	// A silence starting later is listed but not active yet
+	later, err := store.Add(Silence{Notifier: "slack", StartsAt: clock.Now().Add(2 * time.Hour), EndsAt: clock.Now().Add(3 * time.Hour)})
+	if err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if len(store.List()) != 2 || store.Silenced("slack", NewLogEntry().WithLevel(INFO)) {
+		t.Fatalf("List = %+v", store.List())
+	}
+
+	clock.Advance(90 * time.Minute)
+	if store.Silenced("mail", entry) {
+		t.Fatal("entry silenced after the end of the silence")
+	}
+	clock.Advance(time.Hour)
+	if !store.Silenced("slack", NewLogEntry().WithLevel(INFO)) {
+		t.Fatal("entry not silenced once the silence started")
+	}
+	if list := store.List(); len(list) != 1 || list[0].ID != later.ID {
+		t.Fatalf("List = %+v", list)
+	}
+
+	// Expiring drops the silence from the file, with those that ended
+	if err := store.Expire(later.ID); err != nil {
+		t.Fatalf("Expire: %v", err)
+	}
+	if err := store.Expire(later.ID); err == nil {
+		t.Fatal("expiring an unknown silence succeeded")
+	}
+	reloaded := newSilenceStore(path)
+	if err := reloaded.load(); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if len(reloaded.silences) != 0 {
+		t.Fatalf("silences left in the file: %+v", reloaded.silences)
+	}
+}
+
+func TestSilenceStoreConcurrentAdd(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "silences.json")
+	const stores, silences = 4, 10
+	var wg sync.WaitGroup
+	for i := 0; i < stores; i++ {
+		// Separate stores on the same file stand for separate processes
+		store := newSilenceStore(path)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < silences; j++ {
+				if _, err := store.Add(Silence{Comment: fmt.Sprintf("%d-%d", i, j), EndsAt: time.Now().Add(time.Hour)}); err != nil {
+					t.Errorf("Add: %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	store := newSilenceStore(path)
+	if err := store.load(); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if len(store.silences) != stores*silences {
+		t.Fatalf("%d silences in the file, want %d", len(store.silences), stores*silences)
+	}
+	if matches, _ := filepath.Glob(path + ".*.tmp"); len(matches) != 0 {
+		t.Fatalf("temporary files left: %v", matches)
+	}
+}
@@ -0,0 +1,95 @@
+package logger
+
+import "encoding/binary"
+
+// The remote-write protocol requires snappy block compression. This is a minimal encoder of the
+// snappy block format (https://github.com/google/snappy/blob/main/format_description.txt),
+// emitting literals and copies found with a single-entry hash table, like the reference encoder.
+
+const (
+	snappyMaxBlockSize = 65536
+	snappyTableBits    = 14
+	snappyMinInput     = 16 // Inputs shorter than this are emitted as a single literal.
+)
+
+// snappyEncode compresses src using the snappy block format.
+func snappyEncode(src []byte) []byte {
+	dst := binary.AppendUvarint(make([]byte, 0, len(src)/2+16), uint64(len(src)))
+	for len(src) > 0 {
+		block := src
+		if len(block) > snappyMaxBlockSize {
+			block = block[:snappyMaxBlockSize]
+		}
+		src = src[len(block):]
+		dst = snappyEncodeBlock(dst, block)
+	}
+	return dst
+}
+
+// snappyEncodeBlock compresses a block of at most snappyMaxBlockSize bytes, so that every copy
+// offset fits in two bytes.
+func snappyEncodeBlock(dst, src []byte) []byte {
+	if len(src) < snappyMinInput {
+		return snappyLiteral(dst, src)
+	}
+	var table [1 << snappyTableBits]int32 // Position + 1 of the last occurrence of a hash
+	literalStart := 0
+	for i := 0; i+4 <= len(src); {
+		v := binary.LittleEndian.Uint32(src[i:])
+		h := (v * 0x1e35a7bd) >> (32 - snappyTableBits)
+		candidate := int(table[h]) - 1
+		table[h] = int32(i + 1)
+		if candidate < 0 || binary.LittleEndian.Uint32(src[candidate:]) != v {
+			i++
+			continue
+		}
+
+		dst = snappyLiteral(dst, src[literalStart:i])
+		length := 4
+		for i+length < len(src) && src[candidate+length] == src[i+length] {
+			length++
+		}
+		dst = snappyCopy(dst, i-candidate, length)
+		i += length
+		literalStart = i
+	}
+	return snappyLiteral(dst, src[literalStart:])
+}
+
+// snappyLiteral appends a literal element.
+func snappyLiteral(dst, lit []byte) []byte {
+	if len(lit) == 0 {
+		return dst
+	}
+	n := uint32(len(lit) - 1)
+	switch {
+	case n < 60:
+		dst = append(dst, byte(n<<2))
+	case n < 1<<8:
+		dst = append(dst, 60<<2, byte(n))
+	case n < 1<<16:
+		dst = append(dst, 61<<2, byte(n), byte(n>>8))
+	case n < 1<<24:
+		dst = append(dst, 62<<2, byte(n), byte(n>>8), byte(n>>16))
+	default:
+		dst = append(dst, 63<<2, byte(n), byte(n>>8), byte(n>>16), byte(n>>24))
+	}
+	return append(dst, lit...)
+}
+
+// snappyCopy appends copy elements for a match of the given offset and length.
+func snappyCopy(dst []byte, offset, length int) []byte {
+	// Copies with a 2-byte offset hold at most 64 bytes; keep at least 4 bytes for the last one
+	for length >= 68 {
+		dst = append(dst, 63<<2|2, byte(offset), byte(offset>>8))
+		length -= 64
+	}
+	if length > 64 {
+		dst = append(dst, 59<<2|2, byte(offset), byte(offset>>8))
+		length -= 60
+	}
+	if length >= 4 && length < 12 && offset < 2048 {
+		return append(dst, byte(offset>>8)<<5|byte(length-4)<<2|1, byte(offset))
+	}
+	return append(dst, byte(length-1)<<2|2, byte(offset), byte(offset>>8))
+}
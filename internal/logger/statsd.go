@@ -0,0 +1,343 @@
+package logger
+
+import (
+	"errors"
+	"fmt"
+	"github.com/spf13/viper"
+	"log"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// StatsDFlavor selects the wire format of the StatsD emitter.
+type StatsDFlavor string
+
+const (
+	StatsDPlain StatsDFlavor = "statsd"    // Labels are appended to the metric name.
+	DogStatsD   StatsDFlavor = "dogstatsd" // Labels are sent as tags.
+)
+
+const (
+	defaultStatsDAddress       = "127.0.0.1:8125"
+	defaultStatsDFlushInterval = 10 * time.Second
+	defaultStatsDPacketSize    = 1432 // Fits in a single Ethernet frame.
+)
+
+// statsdNameRegex matches the characters replaced in plain StatsD name segments.
+var statsdNameRegex = regexp.MustCompile(`[^a-zA-Z0-9_\-]`)
+
+// statsdEmitter is the running emitter, nil when StatsD is disabled.
+var statsdEmitter atomic.Pointer[StatsDEmitter]
+
+// StatsDConfig configures the StatsD emitter.
+type StatsDConfig struct {
+	Address       string            `json:"address,omitempty" mapstructure:"address"`             // Agent address, 127.0.0.1:8125 by default.
+	Flavor        StatsDFlavor      `json:"flavor,omitempty" mapstructure:"flavor"`               // statsd (default) or dogstatsd.
+	Prefix        string            `json:"prefix,omitempty" mapstructure:"prefix"`               // Prepended to every metric name, e.g. "myapp.".
+	Tags          map[string]string `json:"tags,omitempty" mapstructure:"tags"`                   // Constant tags (DogStatsD only).
+	FlushInterval time.Duration     `json:"flushInterval,omitempty" mapstructure:"flushInterval"` // Aggregation window, 10s by default.
+	MaxPacketSize int               `json:"maxPacketSize,omitempty" mapstructure:"maxPacketSize"` // Maximum UDP payload, 1432 bytes by default.
+}
+
+// Validate checks the StatsD configuration.
+func (c *StatsDConfig) Validate() error {
+	switch c.Flavor {
+	case "", StatsDPlain, DogStatsD:
+	default:
+		return fmt.Errorf("statsd: unknown flavor '%s': use statsd or dogstatsd", c.Flavor)
+	}
+	if c.Address != "" {
+		if _, _, err := net.SplitHostPort(c.Address); err != nil {
+			return fmt.Errorf("statsd: invalid address: %w", err)
+		}
+	}
+	if c.MaxPacketSize < 0 {
+		return errors.New("statsd: maxPacketSize must not be negative")
+	}
+	return nil
+}
+
+// loadStatsDConfig reads the "statsd" section of the configuration, returning nil when absent or disabled.
+func loadStatsDConfig(vpr *viper.Viper) (*StatsDConfig, error) {
+	if !vpr.IsSet("statsd") || (vpr.IsSet("statsd.enabled") && !vpr.GetBool("statsd.enabled")) {
+		return nil, nil
+	}
+	var cfg StatsDConfig
+	if err := vpr.UnmarshalKey("statsd", &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse statsd config: %w", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// statsdKey identifies an aggregated series.
+type statsdKey struct {
+	name   string
+	labels string // labelsKey of the labels
+}
+
+// statsdSeries is an aggregated series waiting for the next flush.
+type statsdSeries struct {
+	labels map[string]string
+	value  float64   // Counter sum or last gauge value.
+	values []float64 // Histogram observations.
+}
+
+// StatsDEmitter sends metrics to a StatsD agent over UDP. Counters are summed and gauges keep
+// their last value between flushes; histogram observations are sent individually, batched into packets.
+type StatsDEmitter struct {
+	cfg  StatsDConfig
+	conn net.Conn
+
+	mu         sync.Mutex
+	counters   map[statsdKey]*statsdSeries
+	gauges     map[statsdKey]*statsdSeries
+	histograms map[statsdKey]*statsdSeries
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewStatsDEmitter connects to the agent and starts the flush loop.
+func NewStatsDEmitter(cfg StatsDConfig) (*StatsDEmitter, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if cfg.Address == "" {
+		cfg.Address = defaultStatsDAddress
+	}
+	if cfg.Flavor == "" {
+		cfg.Flavor = StatsDPlain
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = defaultStatsDFlushInterval
+	}
+	if cfg.MaxPacketSize == 0 {
+		cfg.MaxPacketSize = defaultStatsDPacketSize
+	}
+	conn, err := net.Dial("udp", cfg.Address)
+	if err != nil {
+		return nil, fmt.Errorf("statsd: %w", err)
+	}
+
+	e := &StatsDEmitter{
+		cfg:        cfg,
+		conn:       conn,
+		counters:   make(map[statsdKey]*statsdSeries),
+		gauges:     make(map[statsdKey]*statsdSeries),
+		histograms: make(map[statsdKey]*statsdSeries),
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	go e.loop()
+	return e, nil
+}
+
+// StartStatsD starts the package-wide emitter that mirrors the metrics of the PrometheusManager.
+func StartStatsD(cfg StatsDConfig) error {
+	e, err := NewStatsDEmitter(cfg)
+	if err != nil {
+		return err
+	}
+	if !statsdEmitter.CompareAndSwap(nil, e) {
+		_ = e.Close()
+		return errors.New("statsd emitter is already running")
+	}
+	return nil
+}
+
+// StopStatsD flushes and stops the package-wide emitter, if running.
+func StopStatsD() error {
+	if e := statsdEmitter.Swap(nil); e != nil {
+		return e.Close()
+	}
+	return nil
+}
+
+// GetStatsDEmitter returns the package-wide emitter, or nil when StatsD is disabled.
+func GetStatsDEmitter() *StatsDEmitter {
+	return statsdEmitter.Load()
+}
+
+// Count adds delta to a counter.
+func (e *StatsDEmitter) Count(name string, labels map[string]string, delta float64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.entry(e.counters, name, labels).value += delta
+}
+
+// Gauge sets a gauge.
+func (e *StatsDEmitter) Gauge(name string, labels map[string]string, value float64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.entry(e.gauges, name, labels).value = value
+}
+
+// Histogram records an observation.
+func (e *StatsDEmitter) Histogram(name string, labels map[string]string, value float64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	s := e.entry(e.histograms, name, labels)
+	s.values = append(s.values, value)
+}
+
+// entry returns the aggregated series for the name and labels. The caller must hold mu.
+func (e *StatsDEmitter) entry(series map[statsdKey]*statsdSeries, name string, labels map[string]string) *statsdSeries {
+	key := statsdKey{name: name, labels: labelsKey(labels)}
+	s, ok := series[key]
+	if !ok {
+		s = &statsdSeries{labels: copyLabels(labels)}
+		series[key] = s
+	}
+	return s
+}
+
+// loop flushes on every interval until Close.
+func (e *StatsDEmitter) loop() {
+	defer close(e.done)
+	ticker := time.NewTicker(e.cfg.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-e.stop:
+			return
+		case <-ticker.C:
+			if err := e.Flush(); err != nil {
+				log.Printf("Error flushing StatsD metrics: %v", err)
+			}
+		}
+	}
+}
+
+// Flush sends the aggregated metrics and resets counters and histograms. Gauges are sent
+// again on every flush, as agents expect.
+func (e *StatsDEmitter) Flush() error {
+	e.mu.Lock()
+	var lines []string
+	for _, key := range sortedStatsDKeys(e.counters) {
+		s := e.counters[key]
+		lines = append(lines, e.line(key.name, s.labels, s.value, "c"))
+	}
+	for _, key := range sortedStatsDKeys(e.gauges) {
+		s := e.gauges[key]
+		if e.cfg.Flavor == StatsDPlain && s.value < 0 {
+			// A signed plain StatsD gauge is a delta, so reset it before sending a negative value
+			lines = append(lines, e.line(key.name, s.labels, 0, "g"))
+		}
+		lines = append(lines, e.line(key.name, s.labels, s.value, "g"))
+	}
+	histogramType := "ms"
+	if e.cfg.Flavor == DogStatsD {
+		histogramType = "h"
+	}
+	for _, key := range sortedStatsDKeys(e.histograms) {
+		s := e.histograms[key]
+		for _, v := range s.values {
+			lines = append(lines, e.line(key.name, s.labels, v, histogramType))
+		}
+	}
+	e.counters = make(map[statsdKey]*statsdSeries)
+	e.histograms = make(map[statsdKey]*statsdSeries)
+	e.mu.Unlock()
+
+	return e.send(lines)
+}
+
+// sortedStatsDKeys returns the keys of the series ordered by name and labels.
+func sortedStatsDKeys(series map[statsdKey]*statsdSeries) []statsdKey {
+	keys := make([]statsdKey, 0, len(series))
+	for key := range series {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].name != keys[j].name {
+			return keys[i].name < keys[j].name
+		}
+		return keys[i].labels < keys[j].labels
+	})
+	return keys
+}
+
+// send writes the lines in packets of at most MaxPacketSize bytes.
+func (e *StatsDEmitter) send(lines []string) error {
+	var errs []error
+	var packet strings.Builder
+	write := func() {
+		if packet.Len() == 0 {
+			return
+		}
+		if _, err := e.conn.Write([]byte(packet.String())); err != nil {
+			errs = append(errs, err)
+		}
+		packet.Reset()
+	}
+	for _, line := range lines {
+		if packet.Len() > 0 && packet.Len()+1+len(line) > e.cfg.MaxPacketSize {
+			write()
+		}
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(line)
+	}
+	write()
+	return errors.Join(errs...)
+}
+
+// line renders a metric line in the configured flavor.
+func (e *StatsDEmitter) line(name string, labels map[string]string, value float64, typ string) string {
+	var b strings.Builder
+	b.WriteString(e.cfg.Prefix)
+	b.WriteString(name)
+
+	names := make([]string, 0, len(labels))
+	for k := range labels {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	if e.cfg.Flavor == StatsDPlain {
+		for _, k := range names {
+			b.WriteByte('.')
+			b.WriteString(statsdNameRegex.ReplaceAllString(labels[k], "_"))
+		}
+	}
+
+	b.WriteByte(':')
+	b.WriteString(strconv.FormatFloat(value, 'f', -1, 64))
+	b.WriteByte('|')
+	b.WriteString(typ)
+
+	if e.cfg.Flavor == DogStatsD {
+		tags := make([]string, 0, len(names)+len(e.cfg.Tags))
+		for _, k := range names {
+			tags = append(tags, k+":"+labels[k])
+		}
+		for k, v := range e.cfg.Tags {
+			if _, ok := labels[k]; !ok {
+				tags = append(tags, k+":"+v)
+			}
+		}
+		if len(tags) > 0 {
+			sort.Strings(tags)
+			b.WriteString("|#")
+			b.WriteString(strings.Join(tags, ","))
+		}
+	}
+	return b.String()
+}
+
+// Close stops the flush loop, sends the pending metrics and closes the connection.
+func (e *StatsDEmitter) Close() error {
+	close(e.stop)
+	<-e.done
+	err := e.Flush()
+	return errors.Join(err, e.conn.Close())
+}
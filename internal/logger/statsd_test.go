@@ -0,0 +1,104 @@
+package logger
+
+import (
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// statsdReceiver listens on a local UDP port and returns its address with a function reading
+// the lines of the next packet.
+func statsdReceiver(t *testing.T) (string, func() []string) {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	read := func() []string {
+		t.Helper()
+		buf := make([]byte, 65536)
+		_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		return strings.Split(string(buf[:n]), "\n")
+	}
+	return conn.LocalAddr().String(), read
+}
+
+func TestStatsDPlainLines(t *testing.T) {
+	addr, read := statsdReceiver(t)
+	e, err := NewStatsDEmitter(StatsDConfig{Address: addr, Prefix: "app.", FlushInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("NewStatsDEmitter: %v", err)
+	}
+	defer e.Close()
+
+	e.Count("logs_total", map[string]string{"level": "ERROR", "source": "api/v1"}, 1)
+	e.Count("logs_total", map[string]string{"level": "ERROR", "source": "api/v1"}, 2)
+	e.Gauge("queue", nil, -3)
+	e.Histogram("latency", nil, 0.25)
+	if err := e.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	want := []string{
+		"app.logs_total.ERROR.api_v1:3|c",
+		"app.queue:0|g",
+		"app.queue:-3|g",
+		"app.latency:0.25|ms",
+	}
+	if got := read(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("lines = %q, want %q", got, want)
+	}
+}
+
+func TestStatsDDogStatsDLines(t *testing.T) {
+	addr, read := statsdReceiver(t)
+	e, err := NewStatsDEmitter(StatsDConfig{Address: addr, Flavor: DogStatsD, FlushInterval: time.Hour,
+		Tags: map[string]string{"env": "prod", "level": "ignored"}})
+	if err != nil {
+		t.Fatalf("NewStatsDEmitter: %v", err)
+	}
+	defer e.Close()
+
+	e.Count("logs_total", map[string]string{"level": "ERROR"}, 1)
+	e.Gauge("queue", nil, -3)
+	e.Histogram("latency", map[string]string{"source": "api"}, 2)
+	if err := e.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	want := []string{
+		"logs_total:1|c|#env:prod,level:ERROR",
+		"queue:-3|g|#env:prod,level:ignored",
+		"latency:2|h|#env:prod,level:ignored,source:api",
+	}
+	if got := read(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("lines = %q, want %q", got, want)
+	}
+}
+
+func TestStatsDPacketSize(t *testing.T) {
+	addr, read := statsdReceiver(t)
+	e, err := NewStatsDEmitter(StatsDConfig{Address: addr, FlushInterval: time.Hour, MaxPacketSize: 19})
+	if err != nil {
+		t.Fatalf("NewStatsDEmitter: %v", err)
+	}
+	defer e.Close()
+
+	e.Count("first", nil, 1)
+	e.Count("second", nil, 2)
+	if err := e.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	for _, want := range []string{"first:1|c", "second:2|c"} {
+		if got := read(); len(got) != 1 || got[0] != want {
+			t.Fatalf("packet = %q, want %q", got, want)
+		}
+	}
+}
@@ -0,0 +1,511 @@
+package logger
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	streamPath               = "/stream"
+	defaultStreamBacklog     = 1000             // Entries kept for clients resuming with Last-Event-ID.
+	streamSubscriberBuffer   = 256              // Entries queued per client before it is dropped as too slow.
+	streamHeartbeatInterval  = 15 * time.Second // Comment sent to idle clients, so that proxies keep the connection.
+	streamRetryInterval      = 3 * time.Second  // Reconnection delay advertised to clients.
+	streamClientIdleDeadline = 3 * streamHeartbeatInterval
+)
+
+// logStreams broadcasts the entries of the service to the /stream subscribers.
+var logStreams = newStreamHub(defaultStreamBacklog)
+
+// StreamFilter selects the entries sent to a stream subscriber. All the conditions must hold.
+type StreamFilter struct {
+	MinLevel LogLevel          // Entries of this level and above.
+	Sources  []string          // Entries of any of these sources.
+	Tags     map[string]string // Entries with all these tag values.
+	Metadata map[string]string // Entries with all these metadata values, compared as text.
+	TraceID  string            // Entries of this trace.
+	Match    string            // Expression in the syntax of metric rules, e.g. `message=~timeout OR level>=ERROR`.
+}
+
+// ParseStreamFilter reads the filter from the query of a /stream request: level, source (repeated
+// or comma-separated), tag and meta (repeated, as key:value), trace_id and match.
+func ParseStreamFilter(query url.Values) (StreamFilter, error) {
+	filter := StreamFilter{
+		MinLevel: LogLevel(strings.ToUpper(query.Get("level"))),
+		TraceID:  query.Get("trace_id"),
+		Match:    query.Get("match"),
+	}
+	if _, ok := logLevels[filter.MinLevel]; !ok && filter.MinLevel != "" {
+		return filter, fmt.Errorf("invalid level '%s': use debug, info, warn, error or fatal", query.Get("level"))
+	}
+	for _, value := range query["source"] {
+		for _, source := range strings.Split(value, ",") {
+			if source = strings.TrimSpace(source); source != "" {
+				filter.Sources = append(filter.Sources, source)
+			}
+		}
+	}
+	var err error
+	if filter.Tags, err = parseStreamPairs(query["tag"], "tag"); err != nil {
+		return filter, err
+	}
+	if filter.Metadata, err = parseStreamPairs(query["meta"], "meta"); err != nil {
+		return filter, err
+	}
+	return filter, nil
+}
+
+// parseStreamPairs parses key:value pairs.
+func parseStreamPairs(values []string, param string) (map[string]string, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+	pairs := make(map[string]string, len(values))
+	for _, value := range values {
+		key, v, ok := strings.Cut(value, ":")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid %s '%s': use key:value", param, value)
+		}
+		pairs[key] = v
+	}
+	return pairs, nil
+}
+
+// Query encodes the filter as the query of a /stream request.
+func (f StreamFilter) Query() url.Values {
+	query := url.Values{}
+	if f.MinLevel != "" {
+		query.Set("level", string(f.MinLevel))
+	}
+	for _, source := range f.Sources {
+		query.Add("source", source)
+	}
+	for key, value := range f.Tags {
+		query.Add("tag", key+":"+value)
+	}
+	for key, value := range f.Metadata {
+		query.Add("meta", key+":"+value)
+	}
+	if f.TraceID != "" {
+		query.Set("trace_id", f.TraceID)
+	}
+	if f.Match != "" {
+		query.Set("match", f.Match)
+	}
+	return query
+}
+
+// streamMatcher is a compiled StreamFilter.
+type streamMatcher struct {
+	sources map[string]bool
+	clauses []ruleClause   // ANDed conditions of the filter fields
+	match   [][]ruleClause // Compiled Match expression
+}
+
+// compile turns the filter into rule clauses, sharing the semantics of metric rules.
+func (f StreamFilter) compile() (*streamMatcher, error) {
+	m := &streamMatcher{}
+	if f.MinLevel != "" {
+		m.clauses = append(m.clauses, ruleClause{field: "level", op: ">=", value: strings.ToUpper(string(f.MinLevel))})
+	}
+	for key, value := range f.Tags {
+		m.clauses = append(m.clauses, ruleClause{field: "tag." + key, op: "=", value: value})
+	}
+	for key, value := range f.Metadata {
+		m.clauses = append(m.clauses, ruleClause{field: "metadata." + key, op: "=", value: value})
+	}
+	if f.TraceID != "" {
+		m.clauses = append(m.clauses, ruleClause{field: "trace_id", op: "=", value: f.TraceID})
+	}
+	if len(f.Sources) > 0 {
+		m.sources = make(map[string]bool, len(f.Sources))
+		for _, source := range f.Sources {
+			m.sources[source] = true
+		}
+	}
+	match, err := compileMatchExpr(f.Match)
+	if err != nil {
+		return nil, fmt.Errorf("invalid match: %w", err)
+	}
+	m.match = match
+	return m, nil
+}
+
+// matches reports whether the entry passes the filter.
+func (m *streamMatcher) matches(le *LogEntry) bool {
+	if m.sources != nil && !m.sources[le.Source] {
+		return false
+	}
+	for _, c := range m.clauses {
+		if !c.matches(le) {
+			return false
+		}
+	}
+	return matchClauses(m.match, le)
+}
+
+// streamEvent is an entry published to the subscribers, with its event ID.
+type streamEvent struct {
+	id    uint64
+	entry *LogEntry
+	data  []byte
+}
+
+// streamSubscriber is a connected /stream client.
+type streamSubscriber struct {
+	events chan streamEvent
+}
+
+// streamHub keeps a backlog of the last entries and fans them out to the subscribers. A subscriber
+// that does not keep up is disconnected, and can resume from the backlog with Last-Event-ID.
+type streamHub struct {
+	mu          sync.Mutex
+	size        int
+	lastID      uint64
+	backlog     []streamEvent
+	subscribers map[*streamSubscriber]struct{}
+}
+
+// newStreamHub creates a hub keeping size entries for resuming clients.
+func newStreamHub(size int) *streamHub {
+	if size <= 0 {
+		size = defaultStreamBacklog
+	}
+	return &streamHub{size: size, subscribers: make(map[*streamSubscriber]struct{})}
+}
+
+// publish records the entry in the backlog and sends it to the subscribers.
+func (h *streamHub) publish(entry LogzEntry) {
+	le, ok := entry.(*LogEntry)
+	if !ok {
+		le = cloneEntry(entry)
+	}
+	data, err := json.Marshal(le)
+	if err != nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastID++
+	event := streamEvent{id: h.lastID, entry: le, data: data}
+	// The backlog grows up to twice its size before being compacted, so that entries are not
+	// copied on every publish
+	h.backlog = append(h.backlog, event)
+	if len(h.backlog) >= 2*h.size {
+		h.backlog = append(make([]streamEvent, 0, 2*h.size), h.backlog[len(h.backlog)-h.size:]...)
+	}
+	for sub := range h.subscribers {
+		select {
+		case sub.events <- event:
+		default:
+			close(sub.events)
+			delete(h.subscribers, sub)
+		}
+	}
+}
+
+// subscribe registers a subscriber and returns the backlog entries after lastEventID. An ID
+// unknown to the hub, such as one from before a restart, replays the whole backlog. The
+// returned flag reports entries lost because they already left the backlog.
+func (h *streamHub) subscribe(lastEventID uint64, resume bool) (*streamSubscriber, []streamEvent, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	sub := &streamSubscriber{events: make(chan streamEvent, streamSubscriberBuffer)}
+	h.subscribers[sub] = struct{}{}
+	if !resume {
+		return sub, nil, false
+	}
+
+	backlog := h.backlog[max(0, len(h.backlog)-h.size):]
+	var replay []streamEvent
+	truncated := false
+	if lastEventID > h.lastID {
+		replay = append(replay, backlog...)
+	} else {
+		for i, event := range backlog {
+			if event.id > lastEventID {
+				replay = append(replay, backlog[i:]...)
+				truncated = i == 0 && event.id > lastEventID+1
+				break
+			}
+		}
+	}
+	return sub, replay, truncated
+}
+
+// recent returns the entries of the backlog, oldest first.
+func (h *streamHub) recent() []*LogEntry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	backlog := h.backlog[max(0, len(h.backlog)-h.size):]
+	entries := make([]*LogEntry, len(backlog))
+	for i, event := range backlog {
+		entries[i] = event.entry
+	}
+	return entries
+}
+
+// unsubscribe removes the subscriber, unless the hub already dropped it.
+func (h *streamHub) unsubscribe(sub *streamSubscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.subscribers[sub]; ok {
+		delete(h.subscribers, sub)
+		close(sub.events)
+	}
+}
+
+// disconnectAll ends the streams of all the subscribers, when the service shuts down.
+func (h *streamHub) disconnectAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for sub := range h.subscribers {
+		close(sub.events)
+		delete(h.subscribers, sub)
+	}
+}
+
+// subscriberCount returns the number of connected subscribers.
+func (h *streamHub) subscriberCount() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subscribers)
+}
+
+// streamHandler serves the entries of the service as Server-Sent Events: "log" events carrying
+// the entry in JSON, with their ID so that clients resume with Last-Event-ID after a disconnection.
+func streamHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeAdminError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeAdminError(w, http.StatusInternalServerError, errors.New("streaming is not supported"))
+		return
+	}
+	filter, err := ParseStreamFilter(r.URL.Query())
+	if err != nil {
+		writeAdminError(w, http.StatusBadRequest, err)
+		return
+	}
+	matcher, err := filter.compile()
+	if err != nil {
+		writeAdminError(w, http.StatusBadRequest, err)
+		return
+	}
+	lastEventID := getOrDefault(r.Header.Get("Last-Event-ID"), r.URL.Query().Get("lastEventId"))
+	resumeFrom, parseErr := strconv.ParseUint(lastEventID, 10, 64)
+	resume := lastEventID != "" && parseErr == nil
+
+	// The stream outlives the write timeout of the server
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	sub, replay, truncated := logStreams.subscribe(resumeFrom, resume)
+	defer logStreams.unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	_, _ = fmt.Fprintf(w, "retry: %d\n\n", streamRetryInterval.Milliseconds())
+	if truncated {
+		_, _ = fmt.Fprint(w, ": some entries left the backlog before the client resumed\n\n")
+	}
+	send := func(event streamEvent) error {
+		if !matcher.matches(event.entry) {
+			return nil
+		}
+		_, err := fmt.Fprintf(w, "id: %d\nevent: log\ndata: %s\n\n", event.id, event.data)
+		return err
+	}
+	for _, event := range replay {
+		if err := send(event); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-sub.events:
+			if !ok {
+				// Too slow, or the service is shutting down: the client reconnects and resumes
+				// from the backlog
+				return
+			}
+			if err := send(event); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// StreamClientConfig configures WatchStream.
+type StreamClientConfig struct {
+	URL    string       // Service address (host:port) or URL of the /stream endpoint.
+	Token  string       // Sent as "Authorization: Bearer <token>".
+	APIKey string       // Sent as "X-API-Key".
+	Filter StreamFilter // Server-side filter.
+	Client *http.Client // HTTP client, http.DefaultClient by default.
+}
+
+// streamURL returns the URL of the /stream endpoint for an address or URL.
+func streamURL(address string) (*url.URL, error) {
+	if !strings.Contains(address, "://") {
+		address = "http://" + address
+	}
+	u, err := url.Parse(address)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid stream address '%s'", address)
+	}
+	if strings.Trim(u.Path, "/") == "" {
+		u.Path = streamPath
+	}
+	return u, nil
+}
+
+// WatchStream subscribes to the /stream endpoint of a service and calls fn for each entry until
+// the context is done. Dropped connections are resumed with Last-Event-ID after the delay
+// advertised by the service; requests the service rejects end the watch with an error.
+func WatchStream(ctx context.Context, cfg StreamClientConfig, fn func(*LogEntry)) error {
+	u, err := streamURL(cfg.URL)
+	if err != nil {
+		return err
+	}
+	filter := cfg.Filter.Query()
+	for key, values := range u.Query() {
+		filter[key] = values
+	}
+	u.RawQuery = filter.Encode()
+	client := cfg.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	s := &streamReader{retry: streamRetryInterval}
+	for {
+		err := s.read(ctx, client, u.String(), cfg, fn)
+		var rejected *remoteRejectError
+		if errors.As(err, &rejected) {
+			return err
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			log.Printf("Stream interrupted, reconnecting in %s: %v\n", s.retry, err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(s.retry):
+		}
+	}
+}
+
+// streamReader reads Server-Sent Events, keeping the state needed to resume.
+type streamReader struct {
+	lastID string
+	retry  time.Duration
+}
+
+// read runs one connection to the stream until it ends.
+func (s *streamReader) read(ctx context.Context, client *http.Client, target string, cfg StreamClientConfig, fn func(*LogEntry)) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if s.lastID != "" {
+		req.Header.Set("Last-Event-ID", s.lastID)
+	}
+	if cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+cfg.Token)
+	}
+	if cfg.APIKey != "" {
+		req.Header.Set(apiKeyHeader, cfg.APIKey)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var apiErr adminError
+		_ = json.NewDecoder(resp.Body).Decode(&apiErr)
+		if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+			return fmt.Errorf("service answered %s: %s", resp.Status, apiErr.Error)
+		}
+		return &remoteRejectError{status: resp.StatusCode, body: apiErr.Error}
+	}
+
+	// The heartbeats keep a healthy connection busy: a silent one is dead
+	idle := time.AfterFunc(streamClientIdleDeadline, cancel)
+	defer idle.Stop()
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), maxIngestBodySize)
+	var id, event string
+	var data []string
+	for scanner.Scan() {
+		idle.Reset(streamClientIdleDeadline)
+		line := scanner.Text()
+		if line == "" {
+			if len(data) > 0 && (event == "" || event == "log") {
+				var entry LogEntry
+				if err := json.Unmarshal([]byte(strings.Join(data, "\n")), &entry); err == nil {
+					fn(&entry)
+				}
+			}
+			if id != "" {
+				s.lastID = id
+			}
+			id, event, data = "", "", nil
+			continue
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "id":
+			id = value
+		case "event":
+			event = value
+		case "data":
+			data = append(data, value)
+		case "retry":
+			if ms, err := strconv.Atoi(value); err == nil && ms > 0 {
+				s.retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return errors.New("stream closed by the service")
+}
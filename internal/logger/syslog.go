@@ -0,0 +1,542 @@
+package logger
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/spf13/viper"
+	"io"
+	"log"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	defaultSyslogIntegration    = "syslog"
+	defaultSyslogMaxMessageSize = 64 << 10
+	syslogIdleTimeout           = 5 * time.Minute // TCP connections without traffic are closed after this.
+)
+
+// syslogFacilities names the syslog facilities by code.
+var syslogFacilities = []string{
+	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
+	"uucp", "cron", "authpriv", "ftp", "ntp", "security", "console", "solaris-cron",
+	"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7",
+}
+
+// syslogLevels maps the syslog severities, from emerg (0) to debug (7), to log levels.
+var syslogLevels = []LogLevel{FATAL, FATAL, FATAL, ERROR, WARN, INFO, INFO, DEBUG}
+
+// SyslogListenerConfig configures a syslog listener (an item of "syslog" in the configuration).
+type SyslogListenerConfig struct {
+	Protocol       string   `json:"protocol" mapstructure:"protocol"`                       // udp or tcp.
+	Address        string   `json:"address" mapstructure:"address"`                         // Address to listen on, e.g. 0.0.0.0:514.
+	Allow          []string `json:"allow,omitempty" mapstructure:"allow"`                   // Source IPs or CIDRs allowed to send, everyone when empty.
+	Integration    string   `json:"integration,omitempty" mapstructure:"integration"`       // Value of the integration tag, "syslog" by default.
+	MaxMessageSize int      `json:"maxMessageSize,omitempty" mapstructure:"maxMessageSize"` // Longest accepted message, 64KiB by default.
+}
+
+// Validate checks the listener configuration.
+func (c *SyslogListenerConfig) Validate() error {
+	switch c.Protocol {
+	case "udp", "tcp":
+	default:
+		return fmt.Errorf("syslog: unknown protocol '%s': use udp or tcp", c.Protocol)
+	}
+	if _, _, err := net.SplitHostPort(c.Address); err != nil {
+		return fmt.Errorf("syslog: invalid address '%s': %w", c.Address, err)
+	}
+	if _, err := parseAllowlist(c.Allow); err != nil {
+		return err
+	}
+	if c.MaxMessageSize < 0 {
+		return errors.New("syslog: maxMessageSize must not be negative")
+	}
+	return nil
+}
+
+// loadSyslogConfig reads the "syslog" listeners of the configuration.
+func loadSyslogConfig(vpr *viper.Viper) ([]SyslogListenerConfig, error) {
+	if !vpr.IsSet("syslog") {
+		return nil, nil
+	}
+	var cfgs []SyslogListenerConfig
+	if err := vpr.UnmarshalKey("syslog", &cfgs); err != nil {
+		return nil, fmt.Errorf("failed to parse syslog config: %w", err)
+	}
+	for i := range cfgs {
+		if err := cfgs[i].Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return cfgs, nil
+}
+
+// parseAllowlist parses IPs and CIDRs into prefixes.
+func parseAllowlist(allow []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(allow))
+	for _, item := range allow {
+		item = strings.TrimSpace(item)
+		if strings.Contains(item, "/") {
+			prefix, err := netip.ParsePrefix(item)
+			if err != nil {
+				return nil, fmt.Errorf("syslog: invalid allow entry '%s': %w", item, err)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(item)
+		if err != nil {
+			return nil, fmt.Errorf("syslog: invalid allow entry '%s': %w", item, err)
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+	}
+	return prefixes, nil
+}
+
+// SyslogListener receives syslog messages over UDP or TCP and passes them through the service logger.
+type SyslogListener struct {
+	cfg     SyslogListenerConfig
+	allow   []netip.Prefix
+	packet  net.PacketConn
+	stream  net.Listener
+	conns   map[net.Conn]struct{}
+	mu      sync.Mutex
+	wg      sync.WaitGroup
+	closed  bool
+	handler func(*LogEntry)
+}
+
+// ListenSyslog opens a syslog listener. Received entries are passed to the handler.
+func ListenSyslog(cfg SyslogListenerConfig, handler func(*LogEntry)) (*SyslogListener, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if cfg.Integration == "" {
+		cfg.Integration = defaultSyslogIntegration
+	}
+	if cfg.MaxMessageSize == 0 {
+		cfg.MaxMessageSize = defaultSyslogMaxMessageSize
+	}
+	allow, _ := parseAllowlist(cfg.Allow)
+	s := &SyslogListener{cfg: cfg, allow: allow, conns: make(map[net.Conn]struct{}), handler: handler}
+
+	var err error
+	if cfg.Protocol == "udp" {
+		s.packet, err = net.ListenPacket("udp", cfg.Address)
+	} else {
+		s.stream, err = net.Listen("tcp", cfg.Address)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for syslog on %s/%s: %w", cfg.Address, cfg.Protocol, err)
+	}
+	s.wg.Add(1)
+	if s.packet != nil {
+		go s.servePackets()
+	} else {
+		go s.serveStream()
+	}
+	return s, nil
+}
+
+// Addr returns the address the listener is bound to.
+func (s *SyslogListener) Addr() net.Addr {
+	if s.packet != nil {
+		return s.packet.LocalAddr()
+	}
+	return s.stream.Addr()
+}
+
+// String describes the listener for the logs.
+func (s *SyslogListener) String() string {
+	return fmt.Sprintf("syslog://%s/%s", s.Addr(), s.cfg.Protocol)
+}
+
+// Close stops the listener and closes its connections, then waits for the messages being handled.
+func (s *SyslogListener) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	var err error
+	if s.packet != nil {
+		err = s.packet.Close()
+	} else {
+		err = s.stream.Close()
+	}
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+// allowed reports whether the sender is in the allowlist.
+func (s *SyslogListener) allowed(addr net.Addr) bool {
+	if len(s.allow) == 0 {
+		return true
+	}
+	ap, err := netip.ParseAddrPort(addr.String())
+	if err != nil {
+		return false
+	}
+	ip := ap.Addr().Unmap()
+	for _, prefix := range s.allow {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// servePackets handles the datagrams of a UDP listener, one message each.
+func (s *SyslogListener) servePackets() {
+	defer s.wg.Done()
+	buf := make([]byte, s.cfg.MaxMessageSize)
+	for {
+		n, addr, err := s.packet.ReadFrom(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Printf("Syslog listener %s stopped: %v\n", s, err)
+			}
+			return
+		}
+		if !s.allowed(addr) {
+			continue
+		}
+		s.handle(buf[:n], addr)
+	}
+}
+
+// serveStream accepts the connections of a TCP listener.
+func (s *SyslogListener) serveStream() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.stream.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Printf("Syslog listener %s stopped: %v\n", s, err)
+			}
+			return
+		}
+		if !s.allowed(conn.RemoteAddr()) {
+			_ = conn.Close()
+			continue
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			_ = conn.Close()
+			return
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+		go s.serveConn(conn)
+	}
+}
+
+// serveConn reads the messages of a TCP connection, octet-counted or delimited by newlines
+// (RFC 6587). The framing is detected per message.
+func (s *SyslogListener) serveConn(conn net.Conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		_ = conn.Close()
+		s.wg.Done()
+	}()
+	reader := bufio.NewReaderSize(conn, 64<<10)
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(syslogIdleTimeout))
+		msg, err := readSyslogFrame(reader, s.cfg.MaxMessageSize)
+		if len(msg) > 0 {
+			s.handle(msg, conn.RemoteAddr())
+		}
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				log.Printf("Syslog connection from %s closed: %v\n", conn.RemoteAddr(), err)
+			}
+			return
+		}
+	}
+}
+
+// readSyslogFrame reads the next message of a stream. Octet-counted messages start with their
+// length; the others end at a newline or a NUL byte.
+func readSyslogFrame(reader *bufio.Reader, maxSize int) ([]byte, error) {
+	first, err := reader.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	if first[0] >= '1' && first[0] <= '9' {
+		prefix, err := reader.ReadString(' ')
+		if err != nil {
+			return nil, err
+		}
+		length, err := strconv.Atoi(strings.TrimSuffix(prefix, " "))
+		if err != nil || length <= 0 {
+			return nil, fmt.Errorf("invalid octet count '%s'", strings.TrimSpace(prefix))
+		}
+		if length > maxSize {
+			return nil, fmt.Errorf("message of %d bytes exceeds %d bytes", length, maxSize)
+		}
+		msg := make([]byte, length)
+		if _, err := io.ReadFull(reader, msg); err != nil {
+			return nil, err
+		}
+		return msg, nil
+	}
+
+	var msg []byte
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return bytes.TrimSpace(msg), err
+		}
+		if b == '\n' || b == 0 {
+			return bytes.TrimSpace(msg), nil
+		}
+		if len(msg) >= maxSize {
+			return nil, fmt.Errorf("message exceeds %d bytes", maxSize)
+		}
+		msg = append(msg, b)
+	}
+}
+
+// handle parses a message and passes it to the handler. Unparseable messages are reported and dropped.
+func (s *SyslogListener) handle(msg []byte, addr net.Addr) {
+	entry, err := ParseSyslogMessage(msg, time.Now())
+	if err != nil {
+		log.Printf("Invalid syslog message from %s: %v\n", addr, err)
+		return
+	}
+	if entry.Hostname == "" {
+		if host, _, err := net.SplitHostPort(addr.String()); err == nil {
+			entry.Hostname = host
+		}
+	}
+	entry.Tags["integration"] = s.cfg.Integration
+	s.handler(entry)
+}
+
+// ParseSyslogMessage parses an RFC 5424 or RFC 3164 message into a LogEntry. The level comes from
+// the severity, the source from the app-name (or tag), and the facility is kept in the "facility"
+// tag. RFC 5424 message IDs and structured data go to the "msgid" and "structuredData" metadata.
+// Messages without a timestamp are stamped with received.
+func ParseSyslogMessage(msg []byte, received time.Time) (*LogEntry, error) {
+	msg = bytes.TrimRight(msg, "\r\n\x00")
+	if len(msg) < 3 || msg[0] != '<' {
+		return nil, errors.New("missing priority")
+	}
+	end := bytes.IndexByte(msg[:min(len(msg), 5)], '>')
+	if end < 2 {
+		return nil, errors.New("invalid priority")
+	}
+	pri, err := strconv.Atoi(string(msg[1:end]))
+	if err != nil || pri < 0 || pri > 191 {
+		return nil, fmt.Errorf("invalid priority '%s'", msg[1:end])
+	}
+	facility, severity := pri/8, pri%8
+	level := syslogLevels[severity]
+
+	entry := &LogEntry{
+		Level:    level,
+		Severity: logLevels[level],
+		Tags:     map[string]string{"facility": syslogFacilities[facility]},
+		Metadata: map[string]interface{}{"syslogSeverity": severity},
+	}
+	rest := msg[end+1:]
+	if len(rest) > 2 && rest[0] == '1' && rest[1] == ' ' {
+		err = parseRFC5424(entry, string(rest[2:]))
+	} else {
+		parseRFC3164(entry, string(rest), received)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = received
+	}
+	if entry.Source == "" {
+		entry.Source = defaultSyslogIntegration
+	}
+	if entry.Message == "" {
+		entry.Message = "-"
+	}
+	return entry, nil
+}
+
+// parseRFC5424 parses the part of an RFC 5424 message after the version:
+// TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA [MSG].
+func parseRFC5424(entry *LogEntry, rest string) error {
+	var fields [5]string
+	for i := range fields {
+		field, remaining, ok := strings.Cut(rest, " ")
+		if !ok && i < len(fields)-1 {
+			return errors.New("truncated RFC 5424 header")
+		}
+		fields[i], rest = field, remaining
+		if !ok {
+			rest = ""
+		}
+	}
+	if fields[0] != "-" {
+		ts, err := time.Parse(time.RFC3339Nano, fields[0])
+		if err != nil {
+			return fmt.Errorf("invalid timestamp '%s'", fields[0])
+		}
+		entry.Timestamp = ts
+	}
+	entry.Hostname = nilValue(fields[1])
+	entry.Source = nilValue(fields[2])
+	if pid, err := strconv.Atoi(fields[3]); err == nil {
+		entry.ProcessID = pid
+	} else if procID := nilValue(fields[3]); procID != "" {
+		entry.Metadata["procid"] = procID
+	}
+	if msgID := nilValue(fields[4]); msgID != "" {
+		entry.Metadata["msgid"] = msgID
+	}
+
+	if rest == "" {
+		return nil
+	}
+	if strings.HasPrefix(rest, "-") {
+		rest = strings.TrimPrefix(rest, "-")
+	} else {
+		data, remaining, err := parseStructuredData(rest)
+		if err != nil {
+			return err
+		}
+		entry.Metadata["structuredData"] = data
+		rest = remaining
+	}
+	if rest != "" && rest[0] != ' ' {
+		return errors.New("missing space after structured data")
+	}
+	entry.Message = strings.TrimSpace(strings.TrimPrefix(strings.TrimPrefix(rest, " "), "\ufeff"))
+	return nil
+}
+
+// nilValue returns the RFC 5424 field, or "" for the nil value "-".
+func nilValue(field string) string {
+	if field == "-" {
+		return ""
+	}
+	return field
+}
+
+// parseStructuredData parses the SD-ELEMENTs at the start of s into a map of SD-ID to parameters,
+// and returns what follows them.
+func parseStructuredData(s string) (map[string]interface{}, string, error) {
+	data := make(map[string]interface{})
+	for strings.HasPrefix(s, "[") {
+		end := strings.IndexAny(s, " ]")
+		if end < 0 {
+			return nil, "", errors.New("unterminated structured data")
+		}
+		id := s[1:end]
+		if id == "" {
+			return nil, "", errors.New("structured data element without an ID")
+		}
+		params := make(map[string]interface{})
+		s = s[end:]
+		for strings.HasPrefix(s, " ") {
+			s = strings.TrimLeft(s, " ")
+			name, remaining, ok := strings.Cut(s, "=\"")
+			if !ok || name == "" || strings.ContainsAny(name, " ]") {
+				return nil, "", fmt.Errorf("invalid parameter in structured data element '%s'", id)
+			}
+			value, remaining, err := readParamValue(remaining)
+			if err != nil {
+				return nil, "", fmt.Errorf("structured data element '%s': %w", id, err)
+			}
+			params[name] = value
+			s = remaining
+		}
+		if !strings.HasPrefix(s, "]") {
+			return nil, "", fmt.Errorf("unterminated structured data element '%s'", id)
+		}
+		data[id] = params
+		s = s[1:]
+	}
+	return data, s, nil
+}
+
+// readParamValue reads a quoted parameter value, unescaping \", \\ and \], and returns what
+// follows the closing quote.
+func readParamValue(s string) (string, string, error) {
+	var value strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 < len(s) && (s[i+1] == '"' || s[i+1] == '\\' || s[i+1] == ']') {
+				i++
+			}
+			value.WriteByte(s[i])
+		case '"':
+			return value.String(), s[i+1:], nil
+		default:
+			value.WriteByte(s[i])
+		}
+	}
+	return "", "", errors.New("unterminated parameter value")
+}
+
+// rfc3164TimeLayout is the timestamp of RFC 3164 messages, such as "Oct  8 22:14:15".
+const rfc3164TimeLayout = "Jan _2 15:04:05"
+
+// parseRFC3164 parses the part of an RFC 3164 message after the priority:
+// TIMESTAMP HOSTNAME TAG[PID]: MSG. The format is loosely followed by senders, so the parts that
+// do not match are left to the message.
+func parseRFC3164(entry *LogEntry, rest string, received time.Time) {
+	if len(rest) >= len(rfc3164TimeLayout) {
+		if ts, err := time.ParseInLocation(rfc3164TimeLayout, rest[:len(rfc3164TimeLayout)], received.Location()); err == nil {
+			// The year is not sent: take the one that puts the message closest to its reception
+			ts = ts.AddDate(received.Year(), 0, 0)
+			if ts.After(received.Add(24 * time.Hour)) {
+				ts = ts.AddDate(-1, 0, 0)
+			}
+			entry.Timestamp = ts
+			rest = strings.TrimPrefix(rest[len(rfc3164TimeLayout):], " ")
+
+			// The hostname follows the timestamp, unless the sender skipped it and the tag follows
+			if host, remaining, ok := strings.Cut(rest, " "); ok && !isSyslogTag(host) {
+				entry.Hostname = host
+				rest = remaining
+			}
+		}
+	}
+
+	if tag, remaining, ok := strings.Cut(rest, " "); ok && isSyslogTag(tag) {
+		tag = strings.TrimSuffix(tag, ":")
+		if name, pid, ok := strings.Cut(tag, "["); ok {
+			tag = name
+			if n, err := strconv.Atoi(strings.TrimSuffix(pid, "]")); err == nil {
+				entry.ProcessID = n
+			}
+		}
+		entry.Source = tag
+		rest = remaining
+	}
+	entry.Message = strings.TrimSpace(rest)
+}
+
+// isSyslogTag reports whether the word is an RFC 3164 tag: a name, optionally followed by a
+// bracketed pid, and ending with a colon.
+func isSyslogTag(word string) bool {
+	if !strings.HasSuffix(word, ":") || len(word) < 2 || !utf8.ValidString(word) {
+		return false
+	}
+	name, pid, hasPid := strings.Cut(strings.TrimSuffix(word, ":"), "[")
+	if name == "" || strings.ContainsAny(name, "[]") {
+		return false
+	}
+	return !hasPid || strings.HasSuffix(pid, "]")
+}
@@ -0,0 +1,44 @@
+package logger
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+const (
+	webUIPath    = "/ui/"
+	webUIAPIPath = "/ui/api/"
+)
+
+// webUIFiles holds the single-page UI. It has no external assets, so it works offline.
+//
+//go:embed webui
+var webUIFiles embed.FS
+
+// webUIHandler serves the files of the UI. They are public: the data comes from the API, with
+// the credentials entered in the UI.
+func webUIHandler() http.Handler {
+	files, err := fs.Sub(webUIFiles, "webui")
+	if err != nil {
+		panic(err)
+	}
+	fileServer := http.StripPrefix(webUIPath, http.FileServerFS(files))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Security-Policy", "default-src 'self'; frame-ancestors 'none'")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		fileServer.ServeHTTP(w, r)
+	})
+}
+
+// registerWebUIHandlers registers the API of the UI, served with the read scope: the status of
+// the service and its notifiers, the metrics and the search. The live tail uses /stream.
+func registerWebUIHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("GET "+webUIAPIPath+"status", func(w http.ResponseWriter, _ *http.Request) {
+		writeAdminJSON(w, http.StatusOK, currentStatus())
+	})
+	mux.HandleFunc("GET "+webUIAPIPath+"metrics", func(w http.ResponseWriter, _ *http.Request) {
+		writeAdminJSON(w, http.StatusOK, GetPrometheusManager().Snapshot())
+	})
+	mux.HandleFunc("GET "+webUIAPIPath+"search", searchHandler)
+}
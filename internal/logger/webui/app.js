@@ -0,0 +1,367 @@
+"use strict";
+
+// Paths are relative to /ui/, so that the UI also works behind a reverse proxy prefix.
+const streamURL = "../stream";
+const maxTailEntries = 1000;
+const refreshInterval = 5000;
+const tokenKey = "logz.token";
+
+const $ = (id) => document.getElementById(id);
+
+// headers returns the credentials entered in the UI, if any.
+function headers() {
+  const token = sessionStorage.getItem(tokenKey);
+  return token ? { Authorization: "Bearer " + token } : {};
+}
+
+// api fetches a JSON document from the API of the service.
+async function api(path) {
+  const resp = await fetch(path, { headers: headers(), cache: "no-store" });
+  let body = null;
+  try {
+    body = await resp.json();
+  } catch (err) {
+    // Not JSON: reported from the status below
+  }
+  if (!resp.ok) {
+    throw new Error(errorMessage(resp, body));
+  }
+  return body;
+}
+
+function errorMessage(resp, body) {
+  if (resp.status === 401 || resp.status === 403) {
+    return "Not authorized: enter a token with the read scope.";
+  }
+  return (body && body.error) || resp.status + " " + resp.statusText;
+}
+
+function showError(err) {
+  const box = $("error");
+  box.textContent = err ? err.message || String(err) : "";
+  box.hidden = !err;
+}
+
+function el(tag, className, text) {
+  const node = document.createElement(tag);
+  if (className) node.className = className;
+  if (text !== undefined) node.textContent = text;
+  return node;
+}
+
+// entryElement renders an entry with its level color. Clicking it shows the full entry.
+function entryElement(entry) {
+  const level = String(entry.level || "").toUpperCase();
+  const row = el("div", "entry lvl-" + level);
+  const time = entry.timestamp ? new Date(entry.timestamp) : null;
+  row.append(
+    el("span", "time", time && !isNaN(time) ? time.toISOString().replace("T", " ").replace("Z", "") : ""),
+    " ",
+    el("span", "level", level),
+    " ",
+    el("span", "source", entry.source ? "[" + entry.source + "] " : ""),
+    el("span", "message", entry.message || ""),
+  );
+  row.addEventListener("click", () => {
+    const details = row.querySelector("pre");
+    if (details) {
+      details.remove();
+    } else {
+      row.append(el("pre", "", JSON.stringify(entry, null, 2)));
+    }
+  });
+  return row;
+}
+
+// filterParams builds the query shared by /stream and the search.
+function filterParams(level, sources, match) {
+  const params = new URLSearchParams();
+  if (level) params.set("level", level);
+  if (sources.trim()) params.set("source", sources.trim());
+  if (match.trim()) params.set("match", match.trim());
+  return params;
+}
+
+// Live tail
+
+const tail = { controller: null, lastId: "", paused: false, held: [] };
+
+function setTailState(text) {
+  $("tail-state").textContent = text;
+}
+
+function startTail() {
+  if (tail.controller) tail.controller.abort();
+  tail.controller = new AbortController();
+  tail.lastId = "";
+  const params = filterParams($("tail-level").value, $("tail-source").value, $("tail-match").value);
+  readStream(tail.controller.signal, streamURL + "?" + params.toString());
+}
+
+// readStream reads the Server-Sent Events of /stream, resuming with Last-Event-ID when the
+// connection drops. fetch is used rather than EventSource, which cannot send credentials.
+async function readStream(signal, url) {
+  let retry = 3000;
+  while (!signal.aborted) {
+    try {
+      const requestHeaders = headers();
+      requestHeaders.Accept = "text/event-stream";
+      if (tail.lastId) requestHeaders["Last-Event-ID"] = tail.lastId;
+      const resp = await fetch(url, { headers: requestHeaders, signal, cache: "no-store" });
+      if (!resp.ok) {
+        let body = null;
+        try {
+          body = await resp.json();
+        } catch (err) {
+          // Reported from the status
+        }
+        if (resp.status < 500 && resp.status !== 429) {
+          setTailState("Stopped");
+          showError(new Error(errorMessage(resp, body)));
+          return;
+        }
+        throw new Error(errorMessage(resp, body));
+      }
+      setTailState(tail.paused ? "Paused" : "Live");
+      await readEvents(resp.body, (ms) => { retry = ms; });
+    } catch (err) {
+      if (signal.aborted) return;
+    }
+    setTailState("Reconnecting…");
+    await new Promise((resolve) => setTimeout(resolve, retry));
+  }
+}
+
+async function readEvents(body, setRetry) {
+  const reader = body.pipeThrough(new TextDecoderStream()).getReader();
+  let buffer = "";
+  let event = { id: "", type: "", data: [] };
+  for (;;) {
+    const { value, done } = await reader.read();
+    if (done) return;
+    buffer += value;
+    let newline;
+    while ((newline = buffer.indexOf("\n")) >= 0) {
+      let line = buffer.slice(0, newline);
+      buffer = buffer.slice(newline + 1);
+      if (line.endsWith("\r")) line = line.slice(0, -1);
+      if (line === "") {
+        handleEvent(event);
+        event = { id: "", type: "", data: [] };
+        continue;
+      }
+      if (line.startsWith(":")) continue;
+      const colon = line.indexOf(":");
+      const field = colon < 0 ? line : line.slice(0, colon);
+      let fieldValue = colon < 0 ? "" : line.slice(colon + 1);
+      if (fieldValue.startsWith(" ")) fieldValue = fieldValue.slice(1);
+      if (field === "id") event.id = fieldValue;
+      else if (field === "event") event.type = fieldValue;
+      else if (field === "data") event.data.push(fieldValue);
+      else if (field === "retry" && /^\d+$/.test(fieldValue)) setRetry(Number(fieldValue));
+    }
+  }
+}
+
+function handleEvent(event) {
+  if (event.id) tail.lastId = event.id;
+  if (event.data.length === 0 || (event.type && event.type !== "log")) return;
+  let entry;
+  try {
+    entry = JSON.parse(event.data.join("\n"));
+  } catch (err) {
+    return;
+  }
+  if (tail.paused) {
+    tail.held.push(entry);
+    if (tail.held.length > maxTailEntries) tail.held.shift();
+    setTailState("Paused (" + tail.held.length + " new)");
+    return;
+  }
+  showTailEntries([entry]);
+}
+
+// showTailEntries adds entries on top of the tail, dropping the oldest ones.
+function showTailEntries(entries) {
+  const list = $("tail-entries");
+  for (const entry of entries) {
+    list.prepend(entryElement(entry));
+  }
+  while (list.childElementCount > maxTailEntries) {
+    list.lastElementChild.remove();
+  }
+}
+
+function togglePause() {
+  tail.paused = !tail.paused;
+  $("tail-pause").textContent = tail.paused ? "Resume" : "Pause";
+  if (!tail.paused) {
+    showTailEntries(tail.held);
+    tail.held = [];
+  }
+  setTailState(tail.paused ? "Paused" : "Live");
+}
+
+// Search
+
+async function runSearch(event) {
+  event.preventDefault();
+  const query = $("search-query").value.trim();
+  // An operator makes the query an expression in the syntax of metric rules
+  const isExpression = /[=!<>~]/.test(query);
+  const params = filterParams($("search-level").value, "", isExpression ? query : "");
+  if (query && !isExpression) params.set("text", query);
+  params.set("limit", $("search-limit").value);
+
+  $("search-info").textContent = "Searching…";
+  const list = $("search-entries");
+  try {
+    const result = await api("api/search?" + params.toString());
+    showError(null);
+    list.replaceChildren(...result.entries.map(entryElement));
+    const where = result.source === "file"
+      ? (result.partial ? "the end of the output file" : "the output file")
+      : "the entries kept in memory (the output is not a JSON file)";
+    $("search-info").textContent =
+      result.entries.length + " matching of " + result.scanned + " entries in " + where + ", newest first";
+  } catch (err) {
+    $("search-info").textContent = "";
+    showError(err);
+  }
+}
+
+// Status, metrics and notifiers
+
+async function refreshStatus() {
+  const status = await api("api/status");
+  $("summary").textContent =
+    "PID " + status.pid + " · up " + status.uptime + " · level " + status.level +
+    (status.output ? " · " + status.output : "") + " · " + status.streams + " live clients";
+  return status;
+}
+
+function formatNumber(value) {
+  if (value === undefined || value === null) return "0";
+  return Number.isInteger(value) ? String(value) : Number(value).toPrecision(6).replace(/\.?0+$/, "");
+}
+
+function formatLabels(labels) {
+  return Object.entries(labels || {})
+    .sort(([a], [b]) => a.localeCompare(b))
+    .map(([name, value]) => name + "=" + value)
+    .join(", ");
+}
+
+async function loadMetrics() {
+  const [families, status] = await Promise.all([api("api/metrics"), refreshStatus()]);
+  $("metrics-info").textContent = status.metrics.enabled
+    ? "Prometheus exporter listening on " + status.metrics.address + "."
+    : "Prometheus exporter disabled: the metrics are still collected and persisted.";
+  const rows = [];
+  for (const family of families) {
+    for (const series of family.series) {
+      const row = el("tr");
+      const name = el("td", "", family.name);
+      if (family.help) name.title = family.help;
+      let value;
+      if (family.type === "histogram" || family.type === "summary") {
+        const count = series.count || 0;
+        const sum = series.sum || 0;
+        value = "count " + count + " · sum " + formatNumber(sum) +
+          (count ? " · avg " + formatNumber(sum / count) : "");
+      } else {
+        value = formatNumber(series.value);
+      }
+      row.append(name, el("td", "", family.type), el("td", "", formatLabels(series.labels)), el("td", "num", value));
+      rows.push(row);
+    }
+  }
+  if (rows.length === 0) {
+    const row = el("tr");
+    const cell = el("td", "muted", "No metrics yet.");
+    cell.colSpan = 4;
+    row.append(cell);
+    rows.push(row);
+  }
+  $("metrics-rows").replaceChildren(...rows);
+}
+
+async function loadNotifiers() {
+  const status = await refreshStatus();
+  const rows = (status.notifiers || []).map((notifier) => {
+    const row = el("tr");
+    row.append(
+      el("td", "", notifier.name),
+      el("td", "", notifier.type),
+      el("td", notifier.enabled ? "on" : "off", notifier.enabled ? "enabled" : "disabled"),
+      el("td", "", notifier.fromConfig ? "configuration" : "runtime"),
+      el("td", "num", notifier.queueDepth === undefined ? "—" : String(notifier.queueDepth)),
+    );
+    return row;
+  });
+  if (rows.length === 0) {
+    const row = el("tr");
+    const cell = el("td", "muted", "No notifiers configured.");
+    cell.colSpan = 5;
+    row.append(cell);
+    rows.push(row);
+  }
+  $("notifier-rows").replaceChildren(...rows);
+
+  const queues = Object.entries(status.queues || {}).sort(([a], [b]) => a.localeCompare(b));
+  $("queue-rows").replaceChildren(...queues.map(([name, depth]) => {
+    const row = el("tr");
+    row.append(el("td", "", name), el("td", "num", String(depth)));
+    return row;
+  }));
+}
+
+// Views
+
+const loaders = { metrics: loadMetrics, notifiers: loadNotifiers };
+let currentView = "";
+let refreshTimer = null;
+
+function refreshView() {
+  const loader = loaders[currentView] || refreshStatus;
+  loader().then(() => showError(null), showError);
+}
+
+function showView() {
+  const name = location.hash.slice(1);
+  currentView = document.getElementById("view-" + name) ? name : "tail";
+  for (const view of document.querySelectorAll(".view")) {
+    view.hidden = view.id !== "view-" + currentView;
+  }
+  for (const link of document.querySelectorAll("nav a")) {
+    link.classList.toggle("active", link.dataset.view === currentView);
+  }
+  clearInterval(refreshTimer);
+  refreshView();
+  refreshTimer = setInterval(refreshView, refreshInterval);
+}
+
+document.addEventListener("DOMContentLoaded", () => {
+  $("token").value = sessionStorage.getItem(tokenKey) || "";
+  $("token-form").addEventListener("submit", (event) => {
+    event.preventDefault();
+    const token = $("token").value.trim();
+    if (token) sessionStorage.setItem(tokenKey, token);
+    else sessionStorage.removeItem(tokenKey);
+    showError(null);
+    startTail();
+    refreshView();
+  });
+  $("tail-form").addEventListener("submit", (event) => {
+    event.preventDefault();
+    showError(null);
+    startTail();
+  });
+  $("tail-pause").addEventListener("click", togglePause);
+  $("tail-clear").addEventListener("click", () => $("tail-entries").replaceChildren());
+  $("search-form").addEventListener("submit", runSearch);
+  window.addEventListener("hashchange", showView);
+
+  showView();
+  startTail();
+});
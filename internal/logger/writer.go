@@ -152,10 +152,21 @@ func (w *DefaultWriter) Write(entry LogzEntry) error {
 	if err != nil {
 		return err
 	}
-	_, err = fmt.Fprintln(w.out, formatted)
+	n, err := fmt.Fprintln(w.out, formatted)
+	if err == nil {
+		recordWrite(writerName(w.out), n)
+	}
 	return err
 }
 
+// writerName names a destination for the internal metrics: the file name, or "writer".
+func writerName(out io.Writer) string {
+	if named, ok := out.(interface{ Name() string }); ok {
+		return named.Name()
+	}
+	return "writer"
+}
+
 // formatMetadata converts metadata to a JSON string.
 // Returns the JSON string or an empty string if marshalling fails.
 func formatMetadata(entry LogzEntry) string {
@@ -0,0 +1,556 @@
+package logger
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultRemoteBatchSize     = 100
+	defaultRemoteFlushInterval = time.Second
+	defaultRemoteTimeout       = 10 * time.Second
+	defaultRemoteMaxRetries    = 3
+	defaultRemoteMinBackoff    = 500 * time.Millisecond
+	defaultRemoteMaxBackoff    = 30 * time.Second
+	defaultRemoteBufferSize    = 10000
+	defaultRemoteMaxSpoolSize  = 100 << 20
+	remoteSpoolExt             = ".ndjson"
+	remoteSpoolLock            = ".lock"
+)
+
+// RemoteFormat selects the protocol a RemoteWriter speaks.
+type RemoteFormat string
+
+const (
+	RemoteFormatLogz         RemoteFormat = "logz"          // NDJSON to the ingestion endpoint of a logz service (default).
+	RemoteFormatOTLPProtobuf RemoteFormat = "otlp-protobuf" // OTLP/HTTP logs in binary protobuf.
+	RemoteFormatOTLPJSON     RemoteFormat = "otlp-json"     // OTLP/HTTP logs in JSON.
+)
+
+// ErrRemoteWriterClosed is returned when writing to a closed RemoteWriter.
+var ErrRemoteWriterClosed = errors.New("remote writer is closed")
+
+// RemoteWriterConfig configures a RemoteWriter. Only URL is required.
+type RemoteWriterConfig struct {
+	URL                string            `json:"url" mapstructure:"url"`                                         // Ingestion endpoint, e.g. http://logz:9999/billing/receive.
+	Token              string            `json:"token,omitempty" mapstructure:"token"`                           // Sent as "Authorization: Bearer <token>".
+	APIKey             string            `json:"apiKey,omitempty" mapstructure:"apiKey"`                         // Sent as "X-API-Key".
+	Headers            map[string]string `json:"headers,omitempty" mapstructure:"headers"`                       // Extra request headers.
+	BatchSize          int               `json:"batchSize,omitempty" mapstructure:"batchSize"`                   // Entries per request, 100 by default.
+	FlushInterval      time.Duration     `json:"flushInterval,omitempty" mapstructure:"flushInterval"`           // Maximum time an entry waits for its batch, 1s by default.
+	Timeout            time.Duration     `json:"timeout,omitempty" mapstructure:"timeout"`                       // Per request, 10s by default.
+	DisableCompression bool              `json:"disableCompression,omitempty" mapstructure:"disableCompression"` // Send bodies without gzip.
+	MaxRetries         int               `json:"maxRetries,omitempty" mapstructure:"maxRetries"`                 // Attempts per batch before spooling it, 3 by default.
+	MinBackoff         time.Duration     `json:"minBackoff,omitempty" mapstructure:"minBackoff"`                 // First retry delay, 500ms by default.
+	MaxBackoff         time.Duration     `json:"maxBackoff,omitempty" mapstructure:"maxBackoff"`                 // Longest retry delay, 30s by default.
+	BufferSize         int               `json:"bufferSize,omitempty" mapstructure:"bufferSize"`                 // Entries queued in memory, 10000 by default.
+	SpoolDir           string            `json:"spoolDir,omitempty" mapstructure:"spoolDir"`                     // Disk queue, in the user's cache directory by default.
+	MaxSpoolSize       int64             `json:"maxSpoolSize,omitempty" mapstructure:"maxSpoolSize"`             // Bytes kept on disk before dropping the oldest batches, 100 MiB by default.
+	Format             RemoteFormat      `json:"format,omitempty" mapstructure:"format"`                         // logz (default), otlp-protobuf or otlp-json.
+	ResourceAttributes map[string]string `json:"resourceAttributes,omitempty" mapstructure:"resourceAttributes"` // Extra OTLP resource attributes, e.g. deployment.environment.
+}
+
+// RemoteWriter is a LogWriter that ships entries to the ingestion endpoint of a logz service, or
+// to an OTLP/HTTP logs endpoint depending on Format. Entries are batched and sent (gzip-compressed),
+// and failed requests are retried with exponential backoff. While the service is unreachable,
+// batches are spooled to a disk queue that is drained, oldest first, once the service answers
+// again, so a restart of the service loses nothing.
+type RemoteWriter struct {
+	cfg    RemoteWriterConfig
+	client *http.Client
+
+	queue   chan []byte
+	flushes chan chan error
+	stop    chan struct{}
+	done    chan struct{}
+
+	mu       sync.RWMutex
+	closed   bool
+	closeErr error // Result of the last send, set when the loop stops
+
+	spoolMu  sync.Mutex // Serializes spool writes from Write and the send loop
+	offline  bool       // Set when the last request failed; batches go to the spool until it is drained
+	attempts int        // Consecutive failed requests, for the backoff
+	retryAt  time.Time  // Next attempt to drain the spool while offline
+}
+
+// NewRemoteWriter creates the writer and starts its send loop. Batches spooled by a previous
+// process for the same URL are sent first.
+func NewRemoteWriter(cfg RemoteWriterConfig) (*RemoteWriter, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("remote writer: url is required")
+	}
+	if !strings.HasPrefix(cfg.URL, "http://") && !strings.HasPrefix(cfg.URL, "https://") {
+		return nil, fmt.Errorf("remote writer: invalid url '%s'", cfg.URL)
+	}
+	switch cfg.Format {
+	case "":
+		cfg.Format = RemoteFormatLogz
+	case RemoteFormatLogz, RemoteFormatOTLPProtobuf, RemoteFormatOTLPJSON:
+	default:
+		return nil, fmt.Errorf("remote writer: unknown format '%s': use logz, otlp-protobuf or otlp-json", cfg.Format)
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultRemoteBatchSize
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = defaultRemoteFlushInterval
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultRemoteTimeout
+	}
+	if cfg.MaxRetries <= 0 {
+		cfg.MaxRetries = defaultRemoteMaxRetries
+	}
+	if cfg.MinBackoff <= 0 {
+		cfg.MinBackoff = defaultRemoteMinBackoff
+	}
+	if cfg.MaxBackoff < cfg.MinBackoff {
+		cfg.MaxBackoff = max(defaultRemoteMaxBackoff, cfg.MinBackoff)
+	}
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = defaultRemoteBufferSize
+	}
+	if cfg.MaxSpoolSize <= 0 {
+		cfg.MaxSpoolSize = defaultRemoteMaxSpoolSize
+	}
+	if cfg.SpoolDir == "" {
+		cfg.SpoolDir = defaultSpoolDir(cfg.URL)
+	}
+	if err := os.MkdirAll(cfg.SpoolDir, 0700); err != nil {
+		return nil, fmt.Errorf("remote writer: failed to create spool directory: %w", err)
+	}
+
+	w := &RemoteWriter{
+		cfg:     cfg,
+		client:  &http.Client{Timeout: cfg.Timeout},
+		queue:   make(chan []byte, cfg.BufferSize),
+		flushes: make(chan chan error),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go w.loop()
+	return w, nil
+}
+
+// NewOTLPWriter creates a RemoteWriter exporting entries as OTLP/HTTP logs, to an OpenTelemetry
+// collector or to the /v1/logs endpoint of a logz service. The format defaults to protobuf, and
+// /v1/logs is appended to a URL without a path.
+func NewOTLPWriter(cfg RemoteWriterConfig) (*RemoteWriter, error) {
+	if cfg.Format == "" {
+		cfg.Format = RemoteFormatOTLPProtobuf
+	}
+	if cfg.Format != RemoteFormatOTLPProtobuf && cfg.Format != RemoteFormatOTLPJSON {
+		return nil, fmt.Errorf("otlp writer: unknown format '%s': use otlp-protobuf or otlp-json", cfg.Format)
+	}
+	if u, err := url.Parse(cfg.URL); err == nil && strings.Trim(u.Path, "/") == "" {
+		u.Path = otlpLogsPath
+		cfg.URL = u.String()
+	}
+	return NewRemoteWriter(cfg)
+}
+
+// defaultSpoolDir returns a spool directory in the user's cache directory, one per URL.
+func defaultSpoolDir(url string) string {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		cacheDir = os.TempDir()
+	}
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(cacheDir, "kubex", "logz", "spool", hex.EncodeToString(sum[:8]))
+}
+
+// Write queues the entry. It never blocks on the network: when the in-memory queue is full the
+// entry goes straight to the spool.
+func (w *RemoteWriter) Write(entry LogzEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		return ErrRemoteWriterClosed
+	}
+	select {
+	case w.queue <- line:
+		return nil
+	default:
+		return w.spool([][]byte{line})
+	}
+}
+
+// Flush sends the queued entries, spooling them if the service is unreachable.
+func (w *RemoteWriter) Flush() error {
+	w.mu.RLock()
+	if w.closed {
+		w.mu.RUnlock()
+		return ErrRemoteWriterClosed
+	}
+	reply := make(chan error, 1)
+	w.flushes <- reply
+	w.mu.RUnlock()
+	return <-reply
+}
+
+// Close sends the queued entries and stops the writer. Entries that could not be delivered stay
+// in the spool for the next RemoteWriter with the same spool directory.
+func (w *RemoteWriter) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	close(w.stop)
+	w.mu.Unlock()
+	<-w.done
+	return w.closeErr
+}
+
+// QueueDepth returns the number of entries waiting in memory.
+func (w *RemoteWriter) QueueDepth() int { return len(w.queue) }
+
+// loop batches the queued entries and sends them on size, interval, Flush and Close.
+func (w *RemoteWriter) loop() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([][]byte, 0, w.cfg.BatchSize)
+	send := func() error {
+		err := w.send(batch)
+		batch = make([][]byte, 0, w.cfg.BatchSize)
+		return err
+	}
+	for {
+		select {
+		case line := <-w.queue:
+			batch = append(batch, line)
+			if len(batch) >= w.cfg.BatchSize {
+				_ = send()
+			}
+		case <-ticker.C:
+			_ = send()
+		case reply := <-w.flushes:
+			batch = w.drainQueue(batch)
+			reply <- send()
+		case <-w.stop:
+			batch = w.drainQueue(batch)
+			w.closeErr = send()
+			return
+		}
+	}
+}
+
+// drainQueue appends the entries waiting in the queue to the batch.
+func (w *RemoteWriter) drainQueue(batch [][]byte) [][]byte {
+	for {
+		select {
+		case line := <-w.queue:
+			batch = append(batch, line)
+		default:
+			return batch
+		}
+	}
+}
+
+// send delivers the batch, after the spooled batches so that the order is kept. A batch that
+// cannot be delivered is spooled and the writer goes offline until the spool can be drained.
+func (w *RemoteWriter) send(batch [][]byte) error {
+	if w.offline || len(w.spooled()) > 0 {
+		if len(batch) > 0 {
+			if err := w.spool(batch); err != nil {
+				return err
+			}
+		}
+		return w.drainSpool()
+	}
+	if len(batch) == 0 {
+		return nil
+	}
+	if err := w.postWithRetry(joinLines(batch)); err != nil {
+		w.goOffline()
+		if spoolErr := w.spool(batch); spoolErr != nil {
+			return errors.Join(err, spoolErr)
+		}
+		return fmt.Errorf("service unreachable, %d entries spooled: %w", len(batch), err)
+	}
+	return nil
+}
+
+// drainSpool sends the spooled batches, oldest first, once the backoff delay has passed. Processes
+// writing to the same URL share the spool: only the one holding the spool lock drains it, the
+// others leave their batches to it.
+func (w *RemoteWriter) drainSpool() error {
+	if time.Now().Before(w.retryAt) {
+		return nil
+	}
+	unlock, err := w.lockSpool()
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	for _, file := range w.spooled() {
+		body, err := os.ReadFile(file)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		if err := w.post(body); err != nil {
+			var permanent *remoteRejectError
+			if !errors.As(err, &permanent) {
+				w.goOffline()
+				return err
+			}
+			log.Printf("Remote writer: dropping spooled batch %s: %v", filepath.Base(file), err)
+		}
+		_ = os.Remove(file)
+	}
+	w.offline = false
+	w.attempts = 0
+	return nil
+}
+
+// goOffline schedules the next attempt to reach the service.
+func (w *RemoteWriter) goOffline() {
+	w.offline = true
+	w.retryAt = time.Now().Add(w.backoff(w.attempts))
+	w.attempts++
+}
+
+// backoff returns the delay before the given retry, doubling from MinBackoff up to MaxBackoff,
+// with up to 20% of jitter so that many clients do not retry in lockstep.
+func (w *RemoteWriter) backoff(attempt int) time.Duration {
+	delay := w.cfg.MinBackoff << min(attempt, 30)
+	if delay <= 0 || delay > w.cfg.MaxBackoff {
+		delay = w.cfg.MaxBackoff
+	}
+	return delay - time.Duration(rand.Int63n(int64(delay)/5+1))
+}
+
+// postWithRetry sends the body, retrying transient failures up to MaxRetries times.
+func (w *RemoteWriter) postWithRetry(body []byte) error {
+	var err error
+	for attempt := 0; attempt < w.cfg.MaxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(w.backoff(attempt - 1)):
+			case <-w.stop:
+				return err
+			}
+		}
+		if err = w.post(body); err == nil {
+			return nil
+		}
+		var permanent *remoteRejectError
+		if errors.As(err, &permanent) {
+			// Retrying a request the service rejected would fail again
+			log.Printf("Remote writer: dropping batch: %v", err)
+			return nil
+		}
+	}
+	return err
+}
+
+// remoteRejectError is a response that retrying cannot fix, such as invalid entries or bad credentials.
+type remoteRejectError struct {
+	status int
+	body   string
+}
+
+func (e *remoteRejectError) Error() string {
+	return fmt.Sprintf("service rejected the batch: %d %s", e.status, e.body)
+}
+
+// encodeBody converts an NDJSON batch to the wire format: OTLP formats re-encode the entries,
+// which are kept in NDJSON in the queue and the spool.
+func (w *RemoteWriter) encodeBody(body []byte) ([]byte, string, error) {
+	if w.cfg.Format == RemoteFormatLogz {
+		return body, "application/x-ndjson", nil
+	}
+	var entries []*LogEntry
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	for {
+		var entry LogEntry
+		if err := decoder.Decode(&entry); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, "", fmt.Errorf("invalid spooled entry: %w", err)
+		}
+		entries = append(entries, &entry)
+	}
+	data := encodeOTLPLogs(entries, w.cfg.ResourceAttributes, time.Now())
+	if w.cfg.Format == RemoteFormatOTLPJSON {
+		encoded, err := json.Marshal(data)
+		return encoded, contentTypeJSON, err
+	}
+	return data.marshalProto(), contentTypeProto, nil
+}
+
+// post sends one NDJSON body to the ingestion endpoint, in the format of the writer.
+func (w *RemoteWriter) post(body []byte) error {
+	body, contentType, err := w.encodeBody(body)
+	if err != nil {
+		return &remoteRejectError{status: 0, body: err.Error()}
+	}
+	var reader io.Reader = bytes.NewReader(body)
+	if !w.cfg.DisableCompression {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		if _, err := gz.Write(body); err != nil {
+			return err
+		}
+		if err := gz.Close(); err != nil {
+			return err
+		}
+		reader = &buf
+	}
+
+	req, err := http.NewRequest(http.MethodPost, w.cfg.URL, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if !w.cfg.DisableCompression {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	if w.cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+w.cfg.Token)
+	}
+	if w.cfg.APIKey != "" {
+		req.Header.Set("X-API-Key", w.cfg.APIKey)
+	}
+	for k, v := range w.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if w.cfg.Format != RemoteFormatLogz && resp.StatusCode >= 300 {
+		respBody = []byte(otlpStatusMessage(resp.Header.Get("Content-Type"), respBody))
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusOK && w.cfg.Format != RemoteFormatLogz:
+		if rejected, msg := otlpRejected(contentType, respBody); rejected > 0 {
+			log.Printf("Remote writer: collector rejected %d records: %s", rejected, msg)
+		}
+		return nil
+	case resp.StatusCode == http.StatusOK:
+		var result IngestResult
+		if json.Unmarshal(respBody, &result) == nil && result.Rejected > 0 {
+			log.Printf("Remote writer: service rejected %d entries: %s", result.Rejected, strings.TrimSpace(string(respBody)))
+		}
+		return nil
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode >= 500:
+		return fmt.Errorf("service answered %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	default:
+		return &remoteRejectError{status: resp.StatusCode, body: strings.TrimSpace(string(respBody))}
+	}
+}
+
+// spool appends the batch to the disk queue as a new segment, dropping the oldest segments when
+// the spool grows beyond MaxSpoolSize.
+func (w *RemoteWriter) spool(batch [][]byte) error {
+	w.spoolMu.Lock()
+	defer w.spoolMu.Unlock()
+
+	body := joinLines(batch)
+	// The pid keeps the names of segments spooled at the same time by two processes apart
+	name := filepath.Join(w.cfg.SpoolDir, fmt.Sprintf("%020d-%d%s", time.Now().UnixNano(), os.Getpid(), remoteSpoolExt))
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, body, 0600); err != nil {
+		return fmt.Errorf("failed to spool entries: %w", err)
+	}
+	if err := os.Rename(tmp, name); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to spool entries: %w", err)
+	}
+
+	files := w.spooled()
+	var size int64
+	sizes := make([]int64, len(files))
+	for i, file := range files {
+		if info, err := os.Stat(file); err == nil {
+			sizes[i] = info.Size()
+			size += sizes[i]
+		}
+	}
+	for i := 0; size > w.cfg.MaxSpoolSize && i < len(files)-1; i++ {
+		if os.Remove(files[i]) == nil {
+			size -= sizes[i]
+			log.Printf("Remote writer: spool is full, dropped %s", filepath.Base(files[i]))
+		}
+	}
+	return nil
+}
+
+// lockSpool takes an advisory flock on the lock file of the spool directory without waiting, so
+// that a segment is never sent by two processes. The returned function releases it.
+func (w *RemoteWriter) lockSpool() (func(), error) {
+	lockFile, err := os.OpenFile(filepath.Join(w.cfg.SpoolDir, remoteSpoolLock), os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open spool lock file: %w", err)
+	}
+	if err := syscall.Flock(int(lockFile.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		_ = lockFile.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to lock spool: %w", err)
+	}
+	return func() {
+		_ = syscall.Flock(int(lockFile.Fd()), syscall.LOCK_UN)
+		_ = lockFile.Close()
+	}, nil
+}
+
+// spooled returns the spool segments, oldest first.
+func (w *RemoteWriter) spooled() []string {
+	files, _ := filepath.Glob(filepath.Join(w.cfg.SpoolDir, "*"+remoteSpoolExt))
+	sort.Strings(files)
+	return files
+}
+
+// joinLines joins JSON documents into an NDJSON body.
+func joinLines(lines [][]byte) []byte {
+	var buf bytes.Buffer
+	for _, line := range lines {
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,88 @@
+package logger
+
+import (
+	"bufio"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRemoteWritersShareTheSpool(t *testing.T) {
+	var mu sync.Mutex
+	received := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		scanner := bufio.NewScanner(gz)
+		mu.Lock()
+		for scanner.Scan() {
+			received[scanner.Text()]++
+		}
+		mu.Unlock()
+		// Slow requests keep the first drain running while the second one starts
+		time.Sleep(5 * time.Millisecond)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	cfg := RemoteWriterConfig{URL: server.URL, SpoolDir: t.TempDir(), FlushInterval: time.Hour}
+	first, err := NewRemoteWriter(cfg)
+	if err != nil {
+		t.Fatalf("NewRemoteWriter: %v", err)
+	}
+	defer first.Close()
+	second, err := NewRemoteWriter(cfg)
+	if err != nil {
+		t.Fatalf("NewRemoteWriter: %v", err)
+	}
+	defer second.Close()
+
+	const segments = 20
+	for i := 0; i < segments; i++ {
+		if err := first.spool([][]byte{[]byte(`{"message":"` + string(rune('a'+i)) + `"}`)}); err != nil {
+			t.Fatalf("spool: %v", err)
+		}
+	}
+
+	// A writer finding the spool locked leaves it to the one draining it
+	unlock, err := first.lockSpool()
+	if err != nil {
+		t.Fatalf("lockSpool: %v", err)
+	}
+	if err := second.Flush(); err != nil || len(second.spooled()) != segments {
+		t.Fatalf("Flush while locked = %v, %d segments left", err, len(second.spooled()))
+	}
+	unlock()
+
+	var wg sync.WaitGroup
+	for _, w := range []*RemoteWriter{first, second} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := w.Flush(); err != nil {
+				t.Errorf("Flush: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if left := first.spooled(); len(left) != 0 {
+		t.Fatalf("%d segments left in the spool", len(left))
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) != segments {
+		t.Fatalf("received %d distinct entries, want %d", len(received), segments)
+	}
+	for line, n := range received {
+		if n != 1 {
+			t.Errorf("%s sent %d times", line, n)
+		}
+	}
+}
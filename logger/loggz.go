@@ -25,6 +25,13 @@ type LogzEntry = logger.LogzEntry
 // LogFormatter defines the contract for formatting log entries.
 type LogFormatter = logger.LogFormatter
 
+// RemoteWriter is a LogWriter that ships entries to a logz service, spooling them to disk while
+// the service is unreachable.
+type RemoteWriter = logger.RemoteWriter
+
+// RemoteWriterConfig configures a RemoteWriter.
+type RemoteWriterConfig = logger.RemoteWriterConfig
+
 // LogzCore is the interface with the basic methods of the existing logger.
 type LogzCore interface {
 	// SetMetadata sets a metadata key-value pair.
@@ -51,6 +58,8 @@ type LogzCore interface {
 	GetConfig() Config
 	// SetConfig sets the configuration.
 	SetConfig(config Config)
+	// Close flushes pending metrics pushes and closes the writer; call it before the process exits.
+	Close() error
 }
 
 // LogzLogger combines the existing logger with the standard Go log methods.
@@ -173,6 +182,9 @@ func (l *logzLogger) GetConfig() Config { return l.coreLogger.GetConfig() }
 // SetConfig sets the configuration.
 func (l *logzLogger) SetConfig(config Config) { l.coreLogger.SetConfig(config) }
 
+// Close flushes pending metrics pushes and closes the writer.
+func (l *logzLogger) Close() error { return l.coreLogger.Close() }
+
 // NewLogger creates a new instance of logzLogger with an optional prefix.
 func NewLogger(prefix string) LogzLogger {
 	configManager := logger.NewConfigManager()
@@ -196,3 +208,12 @@ func NewLogger(prefix string) LogzLogger {
 		coreLogger: logr,
 	}
 }
+
+// NewRemoteWriter creates a writer sending entries to the ingestion endpoint of a logz service:
+//
+//	w, err := logger.NewRemoteWriter(logger.RemoteWriterConfig{URL: "http://logz:9999/billing/receive", APIKey: key})
+//	log.SetWriter(w)
+//	defer log.Close()
+func NewRemoteWriter(cfg RemoteWriterConfig) (*RemoteWriter, error) {
+	return logger.NewRemoteWriter(cfg)
+}